@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"git.cto.ai/provision/internal/awsclients"
+	"git.cto.ai/provision/internal/awseb"
+	"git.cto.ai/provision/internal/awsiam"
+	"git.cto.ai/provision/internal/awsrds"
+	"git.cto.ai/provision/internal/awss3"
+	"git.cto.ai/provision/internal/awsvpc"
+	"git.cto.ai/provision/internal/config"
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/setup"
+	"git.cto.ai/provision/internal/state"
+	"github.com/aws/aws-sdk-go/aws"
+	ctoai "github.com/cto-ai/sdk-go"
+)
+
+// ebBucketPrefix starts the name of the bucket Elastic Beanstalk keeps for
+// itself in each region. It is never deleted, even when it is empty.
+const ebBucketPrefix = "elasticbeanstalk-"
+
+// teardown is everything Destroy removes for an application. It is worked
+// out with read-only calls, so that it can be shown before anything is
+// deleted.
+type teardown struct {
+	appName    string
+	appExists  bool
+	versions   int
+	envs       []string
+	profiles   []string
+	ingress    []state.IngressRule
+	bundles    map[string][]string
+	databases  []awsrds.RDSDetails
+	placements map[string]awsrds.Placement
+	store      state.Store
+	stateName  string
+	stateSaved bool
+}
+
+// destroyApp tears down an application and what was created for it, once the
+// user has seen what will be deleted and agreed to it.
+func destroyApp(ctx context.Context, opsClients *setup.SDKClients, svc services, awsRegion string, cfg config.Config) error {
+	appName, err := awseb.PromptEBAppName(opsClients, svc.aws.EB, cfg.EB.AppName, "Choose the Elastic Beanstalk app that you want to destroy, or enter the name of the app")
+	if err != nil {
+		return err
+	}
+
+	logger.LogSlack(opsClients.Ux, fmt.Sprintf("🔄 Looking up the resources of %s...", appName))
+
+	found, err := planTeardown(svc.aws, appName, awsRegion, cfg)
+	if err != nil {
+		return err
+	}
+
+	if found.empty() {
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Nothing was found to destroy for %s.", appName))
+		return nil
+	}
+
+	logger.LogSlack(opsClients.Ux, found.describe())
+
+	confirmDestroy, err := opsClients.Prompt.Confirm("DESTROY_CONFIRM", "Do you want to delete everything listed above? This cannot be undone.", ctoai.OptConfirmFlag("y"), ctoai.OptConfirmDefault(false))
+	if err != nil {
+		return err
+	}
+	if !confirmDestroy {
+		logger.LogSlack(opsClients.Ux, "ℹ️  Nothing was deleted.")
+		return nil
+	}
+
+	err = found.run(ctx, opsClients, svc.aws)
+	if err != nil {
+		return err
+	}
+
+	logger.LogSlack(opsClients.Ux, fmt.Sprintf("✅ %s was destroyed.", appName))
+	return nil
+}
+
+// planTeardown finds the resources of appName without changing any of them.
+func planTeardown(clients awsclients.Clients, appName, awsRegion string, cfg config.Config) (teardown, error) {
+	found := teardown{
+		appName:    appName,
+		bundles:    map[string][]string{},
+		placements: map[string]awsrds.Placement{},
+		stateName:  fmt.Sprintf("%s-%s", appName, awsRegion),
+	}
+
+	var err error
+	found.appExists, err = awseb.ApplicationExists(clients.EB, appName)
+	if err != nil {
+		return found, err
+	}
+
+	if found.appExists {
+		envs, err := awseb.ListEnvironments(clients.EB, appName)
+		if err != nil {
+			return found, err
+		}
+
+		for _, env := range envs {
+			envName := aws.StringValue(env.EnvironmentName)
+			found.envs = append(found.envs, envName)
+
+			// The instance profile is only needed to remove the access it
+			// was given to database credentials, so an environment without
+			// one is not an error.
+			profile, err := awseb.EnvInstanceProfile(clients.EB, appName, envName)
+			if _, ok := err.(*awseb.NoInstanceProfileError); !ok {
+				if err != nil {
+					return found, err
+				}
+				if !containsString(found.profiles, profile) {
+					found.profiles = append(found.profiles, profile)
+				}
+			}
+
+			ebSG, err := awsvpc.DescribeEBEnvSecurityGroupID(clients.EC2, envName)
+			if _, ok := err.(*awsvpc.SecurityGroupNotFoundError); ok {
+				continue
+			}
+			if err != nil {
+				return found, err
+			}
+
+			rules, err := awsvpc.ManagedIngressRules(clients.EC2, ebSG)
+			if err != nil {
+				return found, err
+			}
+			for _, rule := range rules {
+				found.ingress = append(found.ingress, state.IngressRule{
+					GroupID:       aws.StringValue(rule.GroupId),
+					SourceGroupID: ebSG,
+					Port:          aws.Int64Value(rule.FromPort),
+				})
+			}
+		}
+
+		versions, err := awseb.ListApplicationVersions(clients.EB, appName)
+		if err != nil {
+			return found, err
+		}
+		found.versions = len(versions)
+
+		for _, version := range versions {
+			if version.SourceBundle != nil {
+				found.addBundle(aws.StringValue(version.SourceBundle.S3Bucket), aws.StringValue(version.SourceBundle.S3Key))
+			}
+		}
+	}
+
+	artifactBucket, err := awss3.ArtifactBucketName(clients.STS, awsRegion)
+	if err != nil {
+		return found, err
+	}
+
+	// Bundles uploaded by deploys that failed before their version was
+	// created are only found under the application's prefix.
+	artifactBucketExists, err := awss3.BucketExists(clients.S3, artifactBucket)
+	if err != nil {
+		return found, err
+	}
+	if artifactBucketExists {
+		keys, err := awss3.ListObjects(clients.S3, artifactBucket, appName+"/")
+		if err != nil {
+			return found, err
+		}
+		for _, key := range keys {
+			found.addBundle(artifactBucket, key)
+		}
+	}
+
+	for bucket := range found.bundles {
+		if bucket == artifactBucket {
+			continue
+		}
+		exists, err := awss3.BucketExists(clients.S3, bucket)
+		if err != nil {
+			return found, err
+		}
+		if !exists {
+			delete(found.bundles, bucket)
+		}
+	}
+
+	var deployment *state.Deployment
+	if cfg.State.Backend == state.BackendLocal || artifactBucketExists {
+		found.store = stateStore(clients, artifactBucket, cfg)
+
+		deployment, err = found.store.Load(found.stateName)
+		if err != nil {
+			return found, err
+		}
+		found.stateSaved = deployment != nil
+	}
+
+	// The databases the application was connected to are found through the
+	// security groups it was let into, along with the one the deploy
+	// recorded, if that still exists.
+	recorded := deployment.Get().RDS
+
+	var groupIDs []string
+	if recorded != nil {
+		groupIDs = append(groupIDs, recorded.SecurityGroupID)
+	}
+	for _, rule := range found.ingress {
+		if !containsString(groupIDs, rule.GroupID) {
+			groupIDs = append(groupIDs, rule.GroupID)
+		}
+	}
+
+	for _, groupID := range groupIDs {
+		databases, err := awsrds.FindRDSBySecurityGroup(clients.RDS, groupID)
+		if err != nil {
+			return found, err
+		}
+		for _, database := range databases {
+			// Only the recorded database knows where its credentials are
+			// kept.
+			if recorded != nil && database.DBName == recorded.DBName {
+				database = recorded.Details()
+			}
+			found.addDatabase(database)
+		}
+	}
+
+	// The DB subnet group and security group created for a database go with
+	// it; ones that were named in the config or made by hand are kept.
+	for _, database := range found.databases {
+		placement, err := awsrds.OwnPlacement(clients.EC2, database)
+		if err != nil {
+			return found, err
+		}
+		found.placements[database.DBName] = placement
+	}
+
+	return found, nil
+}
+
+func (t *teardown) addBundle(bucket, key string) {
+	if bucket == "" || key == "" || containsString(t.bundles[bucket], key) {
+		return
+	}
+	t.bundles[bucket] = append(t.bundles[bucket], key)
+}
+
+func (t *teardown) addDatabase(rdsDetails awsrds.RDSDetails) {
+	for _, database := range t.databases {
+		if database.DBName == rdsDetails.DBName {
+			return
+		}
+	}
+	t.databases = append(t.databases, rdsDetails)
+}
+
+func (t teardown) empty() bool {
+	return !t.appExists && len(t.bundles) == 0 && len(t.databases) == 0 && !t.stateSaved
+}
+
+// buckets returns the buckets holding bundles, in a stable order.
+func (t teardown) buckets() []string {
+	var buckets []string
+	for bucket := range t.bundles {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+// describe lists what run deletes.
+func (t teardown) describe() string {
+	var lines []string
+	if t.appExists {
+		lines = append(lines, fmt.Sprintf("Elastic Beanstalk application %s and its application versions (%d)", t.appName, t.versions))
+	}
+	for _, envName := range t.envs {
+		lines = append(lines, fmt.Sprintf("Elastic Beanstalk environment %s", envName))
+	}
+	for _, rule := range t.ingress {
+		lines = append(lines, fmt.Sprintf("ingress from %s to %s on port %d", rule.SourceGroupID, rule.GroupID, rule.Port))
+	}
+	for _, bucket := range t.buckets() {
+		line := fmt.Sprintf("bundles in S3 bucket %s (%d)", bucket, len(t.bundles[bucket]))
+		if !strings.HasPrefix(bucket, ebBucketPrefix) {
+			line += ", and the bucket once it is empty"
+		}
+		lines = append(lines, line)
+	}
+	if t.stateSaved {
+		lines = append(lines, fmt.Sprintf("deploy state of %s", t.stateName))
+	}
+
+	description := fmt.Sprintf("ℹ️  Destroying %s deletes:\n   %s", t.appName, strings.Join(lines, "\n   "))
+
+	if len(t.databases) > 0 {
+		var databases []string
+		for _, database := range t.databases {
+			line := fmt.Sprintf("RDS database %s", database.DBName)
+			if placement := t.placements[database.DBName]; !placement.Empty() {
+				line += fmt.Sprintf(", then its %s", placement.Description())
+			}
+			databases = append(databases, line)
+		}
+		description += fmt.Sprintf("\nℹ️  You are asked separately whether to delete each of these, after taking a final snapshot:\n   %s", strings.Join(databases, "\n   "))
+	}
+
+	return description
+}
+
+// run deletes the resources in t. Resources that depend on others are
+// removed first, so that a run that stops partway can be repeated.
+func (t teardown) run(ctx context.Context, opsClients *setup.SDKClients, clients awsclients.Clients) error {
+	// Elastic Beanstalk cannot delete the security group of an environment
+	// while another group still refers to it.
+	for _, rule := range t.ingress {
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("🔄 Revoking ingress from %s to %s...", rule.SourceGroupID, rule.GroupID))
+		err := awsvpc.RevokeEBSGFromRDSSG(clients.EC2, rule.SourceGroupID, rule.GroupID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, envName := range t.envs {
+		err := awseb.TerminateEnvironment(ctx, opsClients.Ux, clients.EB, envName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if t.appExists {
+		err := awseb.DeleteApplication(opsClients.Ux, clients.EB, t.appName)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rdsDetails := range t.databases {
+		err := t.deleteDatabase(ctx, opsClients, clients, rdsDetails)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, bucket := range t.buckets() {
+		err := awss3.DeleteObjects(opsClients.Ux, clients.S3, bucket, t.bundles[bucket])
+		if err != nil {
+			return err
+		}
+	}
+
+	// The state is kept in the artifact bucket by default, so it has to go
+	// before the bucket can.
+	if t.stateSaved {
+		err := t.store.Delete(t.stateName)
+		if err != nil {
+			return fmt.Errorf("❗ Unable to delete the state of deployment %s: %v", t.stateName, err)
+		}
+	}
+
+	for _, bucket := range t.buckets() {
+		if strings.HasPrefix(bucket, ebBucketPrefix) {
+			continue
+		}
+		err := awss3.DeleteBucketIfEmpty(opsClients.Ux, clients.S3, bucket)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteDatabase deletes a database of the application with its credentials
+// and the access the instance profiles had to them, if the user agrees. The
+// DB subnet group and security group created for it are deleted once it is
+// gone.
+func (t teardown) deleteDatabase(ctx context.Context, opsClients *setup.SDKClients, clients awsclients.Clients, rdsDetails awsrds.RDSDetails) error {
+	confirmDelete, err := opsClients.Prompt.Confirm("DESTROY_RDS", fmt.Sprintf("Delete RDS database %s? A final snapshot is taken before it is deleted.", rdsDetails.DBName), ctoai.OptConfirmFlag("d"), ctoai.OptConfirmDefault(false))
+	if err != nil {
+		return err
+	}
+	if !confirmDelete {
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Keeping RDS database %s and its credentials.", rdsDetails.DBName))
+		return nil
+	}
+
+	_, err = awsrds.DeleteRDS(ctx, opsClients.Ux, clients.RDS, rdsDetails)
+	if err != nil {
+		return err
+	}
+
+	// A database found through its security group could have had its
+	// credentials saved in either store.
+	credentialStores := []string{rdsDetails.CredentialStore}
+	if rdsDetails.CredentialStore == "" {
+		credentialStores = []string{awsrds.CredentialStoreSSM, awsrds.CredentialStoreSecretsManager}
+	}
+	for _, credentialStore := range credentialStores {
+		rdsDetails.CredentialStore = credentialStore
+		err = awsrds.DeleteCredentials(opsClients.Ux, clients, rdsDetails)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, profile := range t.profiles {
+		err = awsiam.DeleteInstanceProfilePolicy(opsClients.Ux, clients.IAM, profile, credentialPolicyName(rdsDetails))
+		if err != nil {
+			return err
+		}
+	}
+
+	return awsrds.DeletePlacement(ctx, opsClients.Ux, clients.RDS, clients.EC2, rdsDetails, t.placements[rdsDetails.DBName])
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Package awsclients groups the AWS service clients the Op talks to behind the
+// SDK's interfaces, so that in-memory fakes can stand in for AWS.
+package awsclients
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk/elasticbeanstalkiface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// Clients are the AWS service clients used to provision an application.
+type Clients struct {
+	EB             elasticbeanstalkiface.ElasticBeanstalkAPI
+	S3             s3iface.S3API
+	Uploader       s3manageriface.UploaderAPI
+	STS            stsiface.STSAPI
+	RDS            rdsiface.RDSAPI
+	EC2            ec2iface.EC2API
+	IAM            iamiface.IAMAPI
+	SecretsManager secretsmanageriface.SecretsManagerAPI
+	SSM            ssmiface.SSMAPI
+}
+
+// New returns clients backed by awsSess. Regional clients are pinned to
+// awsRegion, whatever region the session was configured with; IAM is global.
+func New(awsSess *session.Session, awsRegion string) Clients {
+	regional := aws.NewConfig().WithRegion(awsRegion)
+	s3Client := s3.New(awsSess, regional)
+
+	return Clients{
+		EB:             elasticbeanstalk.New(awsSess, regional),
+		S3:             s3Client,
+		Uploader:       s3manager.NewUploaderWithClient(s3Client),
+		STS:            sts.New(awsSess, regional),
+		RDS:            rds.New(awsSess, regional),
+		EC2:            ec2.New(awsSess, regional),
+		IAM:            iam.New(awsSess),
+		SecretsManager: secretsmanager.New(awsSess, regional),
+		SSM:            ssm.New(awsSess, regional),
+	}
+}
@@ -0,0 +1,46 @@
+package awsclients
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestNewPinsRegionalClients(t *testing.T) {
+	// The session's own region, as AWS_REGION or the shared config would set
+	// it, differs from the region the Op deploys to.
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.AnonymousCredentials,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := New(sess, "eu-central-1")
+
+	regional := map[string]*client.Client{
+		"EB":             clients.EB.(*elasticbeanstalk.ElasticBeanstalk).Client,
+		"S3":             clients.S3.(*s3.S3).Client,
+		"STS":            clients.STS.(*sts.STS).Client,
+		"RDS":            clients.RDS.(*rds.RDS).Client,
+		"EC2":            clients.EC2.(*ec2.EC2).Client,
+		"SecretsManager": clients.SecretsManager.(*secretsmanager.SecretsManager).Client,
+		"SSM":            clients.SSM.(*ssm.SSM).Client,
+	}
+	for name, c := range regional {
+		if region := aws.StringValue(c.Config.Region); region != "eu-central-1" {
+			t.Errorf("%s client is in region %s, want eu-central-1", name, region)
+		}
+	}
+}
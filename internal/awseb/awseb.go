@@ -1,61 +1,241 @@
 package awseb
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/platform"
+	"git.cto.ai/provision/internal/rollback"
 	"git.cto.ai/provision/internal/setup"
+	"git.cto.ai/provision/internal/state"
+	"git.cto.ai/provision/internal/wait"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk/elasticbeanstalkiface"
 	ctoai "github.com/cto-ai/sdk-go"
 )
 
-func NewEBAppSetup(ux *ctoai.Ux, awsSess *session.Session, bucketName, unzippedRepo, repoPlatform, awsRegion string) (string, string, error) {
-	ebClient := elasticbeanstalk.New(awsSess, aws.NewConfig().WithRegion(awsRegion))
+// AppVersion describes an application version and the S3 bundle it is created from.
+type AppVersion struct {
+	Label     string
+	CommitSHA string
+	S3Bucket  string
+	S3Key     string
+}
+
+// DefaultInstanceProfile is the instance profile Elastic Beanstalk creates for
+// environments launched from the console.
+const DefaultInstanceProfile = "aws-elasticbeanstalk-ec2-role"
+
+// InstanceProfile returns the instance profile new environments are launched with.
+func InstanceProfile(ebDetails setup.EBDetails) string {
+	if ebDetails.InstanceProfile != "" {
+		return ebDetails.InstanceProfile
+	}
+	return DefaultInstanceProfile
+}
+
+// NoInstanceProfileError is returned when an Elastic Beanstalk environment
+// runs without an instance profile.
+type NoInstanceProfileError struct {
+	EnvName string
+}
+
+func (e *NoInstanceProfileError) Error() string {
+	return fmt.Sprintf("❗ Environment %s has no instance profile", e.EnvName)
+}
 
-	EBAppName, err := createApp(ux, ebClient, unzippedRepo)
+// EnvInstanceProfile returns the instance profile the environment envName of
+// appName runs with. A *NoInstanceProfileError is returned when there is none.
+func EnvInstanceProfile(ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, appName, envName string) (string, error) {
+	result, err := ebClient.DescribeConfigurationSettings(&elasticbeanstalk.DescribeConfigurationSettingsInput{
+		ApplicationName: aws.String(appName),
+		EnvironmentName: aws.String(envName),
+	})
 	if err != nil {
-		return "", EBAppName, err
+		if aerr, ok := err.(awserr.Error); ok {
+			return "", aerr
+		}
+		return "", err
+	}
+
+	for _, settings := range result.ConfigurationSettings {
+		for _, option := range settings.OptionSettings {
+			if aws.StringValue(option.Namespace) == "aws:autoscaling:launchconfiguration" && aws.StringValue(option.OptionName) == "IamInstanceProfile" && aws.StringValue(option.Value) != "" {
+				return aws.StringValue(option.Value), nil
+			}
+		}
 	}
 
-	envName, err := createEnviro(ux, ebClient, bucketName, EBAppName, repoPlatform)
+	return "", &NoInstanceProfileError{EnvName: envName}
+}
+
+// AppName returns the application name for a deploy of unzippedRepo, preferring
+// the name given in ebDetails.
+func AppName(unzippedRepo string, ebDetails setup.EBDetails) string {
+	if ebDetails.AppName != "" {
+		return ebDetails.AppName
+	}
+
+	unzippedRepoSplit := strings.Split(filepath.Base(unzippedRepo), "-")
+	return strings.Join(unzippedRepoSplit[:(len(unzippedRepoSplit)-1)], "-")
+}
+
+// NewVersionLabel returns a unique version label for a deploy of unzippedRepo.
+func NewVersionLabel(unzippedRepo string) string {
+	return fmt.Sprintf("%s-%v", strings.ToLower(filepath.Base(unzippedRepo)), time.Now().Format("20060102150405"))
+}
+
+// NewEBAppSetup creates the application and an environment, and deploys
+// appVersion to it. When beforeDeploy is set, it is called with the environment
+// name once the new environment is ready, before the version is deployed.
+// Steps already recorded in deployment are skipped, and each step is recorded
+// as it completes, with a way to undo it pushed onto undo.
+func NewEBAppSetup(ctx context.Context, ux logger.UX, ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, appVersion AppVersion, repoPlatform string, ebDetails setup.EBDetails, deployment *state.Deployment, undo *rollback.Stack, beforeDeploy func(envName string) error) (string, string, error) {
+	EBAppName := ebDetails.AppName
+	appCreated := false
+	if deployment.Done(state.StepAppCreated) {
+		logger.LogSlack(ux, fmt.Sprintf("ℹ️  Application %s was created by an earlier run. \nℹ️  Skipping to next step...", EBAppName))
+	} else {
+		var err error
+		EBAppName, appCreated, err = createApp(ux, ebClient, ebDetails.AppName)
+		if err != nil {
+			return "", EBAppName, err
+		}
+
+		if appCreated {
+			// Deleting the application also deletes its versions.
+			undo.Push(fmt.Sprintf("Elastic Beanstalk application %s", EBAppName), func(ctx context.Context) error {
+				err := DeleteApplication(ux, ebClient, EBAppName)
+				if err != nil {
+					return err
+				}
+				return deployment.Undo(nil, state.StepAppCreated, state.StepVersionCreated)
+			})
+		}
+
+		err = deployment.Complete(state.StepAppCreated, func(r *state.Resources) {
+			r.AppName = EBAppName
+		})
+		if err != nil {
+			return "", EBAppName, err
+		}
+	}
+
+	if deployment.Done(state.StepEnvCreated) {
+		ebDetails.EnvName = deployment.Get().EnvName
+	}
+
+	stopEvents := streamEvents(ux, ebClient, EBAppName, ebDetails.EnvName)
+	defer stopEvents()
+
+	envName := ebDetails.EnvName
+	if deployment.Done(state.StepEnvCreated) {
+		logger.LogSlack(ux, fmt.Sprintf("ℹ️  Environment %s was created by an earlier run. \nℹ️  Skipping to next step...", envName))
+	} else {
+		var err error
+		envName, err = createEnviro(ux, ebClient, appVersion.Label, EBAppName, repoPlatform, ebDetails)
+		if err != nil {
+			return envName, EBAppName, err
+		}
+
+		undo.Push(fmt.Sprintf("Elastic Beanstalk environment %s", envName), func(ctx context.Context) error {
+			err := TerminateEnvironment(ctx, ux, ebClient, envName)
+			if err != nil {
+				return err
+			}
+			return deployment.Undo(func(r *state.Resources) {
+				r.EnvName = ""
+			}, state.StepEnvCreated)
+		})
+
+		err = deployment.Complete(state.StepEnvCreated, func(r *state.Resources) {
+			r.EnvName = envName
+		})
+		if err != nil {
+			return envName, EBAppName, err
+		}
+	}
+
+	if !deployment.Done(state.StepVersionCreated) {
+		err := createAppVersion(ux, ebClient, EBAppName, appVersion)
+		if err != nil {
+			return envName, EBAppName, err
+		}
+
+		if !appCreated {
+			undo.Push(fmt.Sprintf("Elastic Beanstalk application version %s", appVersion.Label), func(ctx context.Context) error {
+				err := DeleteApplicationVersion(ux, ebClient, EBAppName, appVersion.Label)
+				if err != nil {
+					return err
+				}
+				return deployment.Undo(nil, state.StepVersionCreated)
+			})
+		}
+
+		err = deployment.Complete(state.StepVersionCreated, nil)
+		if err != nil {
+			return envName, EBAppName, err
+		}
+	}
+
+	if beforeDeploy != nil {
+		err := waitForEnvironment(ctx, ux, ebClient, envName)
+		if err != nil {
+			return envName, EBAppName, err
+		}
+
+		err = beforeDeploy(envName)
+		if err != nil {
+			return envName, EBAppName, err
+		}
+	}
+
+	err := updateEnvironment(ctx, ux, ebClient, appVersion.Label, envName)
 	if err != nil {
 		return envName, EBAppName, err
 	}
 
-	err = createAppVersion(ux, ebClient, EBAppName, bucketName, unzippedRepo)
+	err = waitForEnvironment(ctx, ux, ebClient, envName)
 	if err != nil {
 		return envName, EBAppName, err
 	}
+	stopEvents()
 
-	err = updateEnvironment(ux, ebClient, bucketName, envName, 0)
+	err = deployment.Complete(state.StepVersionDeployed, nil)
 	if err != nil {
 		return envName, EBAppName, err
 	}
 
-	logger.LogSlack(ux, fmt.Sprintf("ℹ️  EB Application Name: %s\nℹ️  EB Environment Name: %s\nℹ️  EB Application Version Name: %s", EBAppName, envName, bucketName))
+	logger.LogSlack(ux, fmt.Sprintf("ℹ️  EB Application Name: %s\nℹ️  EB Environment Name: %s\nℹ️  EB Application Version Name: %s", EBAppName, envName, appVersion.Label))
 
 	return envName, EBAppName, nil
 }
 
-func PromptEBInfo(opsClients *setup.SDKClients, ebClient *elasticbeanstalk.ElasticBeanstalk) (string, string, error) {
-	EBAppNameMatches, err := GetSpecifiedEBApps(ebClient)
+// UpdateEBInfo resolves the application and environment to update, prompting
+// for whichever of them preset leaves out.
+func UpdateEBInfo(opsClients *setup.SDKClients, ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, preset setup.EBDetails) (setup.EBDetails, error) {
+	EBAppName, EBAppEnvName, err := PromptEBInfo(opsClients, ebClient, preset)
 	if err != nil {
-		return "", "", err
+		return preset, err
 	}
 
-	EBAppName, err := opsClients.Prompt.List("EB_APP_NAME", "Choose the Elastic Beanstalk app that you want to update, or enter the name of the app", EBAppNameMatches, ctoai.OptListDefaultValue("Enter a value"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
-	if err != nil {
-		return EBAppName, "", err
-	}
+	preset.AppName = EBAppName
+	preset.EnvName = EBAppEnvName
+	return preset, nil
+}
 
-	if EBAppName == "Enter a value" {
-		EBAppName, err = opsClients.Prompt.Input("EB_APP_NAME", "Enter the name of the app", ctoai.OptInputAllowEmpty(false))
+func PromptEBInfo(opsClients *setup.SDKClients, ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, preset setup.EBDetails) (string, string, error) {
+	if preset.AppName != "" && preset.EnvName != "" {
+		return preset.AppName, preset.EnvName, nil
 	}
+
+	EBAppName, err := PromptEBAppName(opsClients, ebClient, preset.AppName, "Choose the Elastic Beanstalk app that you want to update, or enter the name of the app")
 	if err != nil {
 		return EBAppName, "", err
 	}
@@ -65,9 +245,12 @@ func PromptEBInfo(opsClients *setup.SDKClients, ebClient *elasticbeanstalk.Elast
 		return EBAppName, "", err
 	}
 
-	EBAppEnvName, err := opsClients.Prompt.List("EB_ENV_NAME", "Choose the Elastic Beanstalk app environment that you want to update, or enter the name of the environment", EBAppEnvMatches, ctoai.OptListDefaultValue("Enter a value"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
-	if err != nil {
-		return EBAppName, EBAppEnvName, err
+	EBAppEnvName := preset.EnvName
+	if EBAppEnvName == "" {
+		EBAppEnvName, err = opsClients.Prompt.List("EB_ENV_NAME", "Choose the Elastic Beanstalk app environment that you want to update, or enter the name of the environment", EBAppEnvMatches, ctoai.OptListDefaultValue("Enter a value"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
+		if err != nil {
+			return EBAppName, EBAppEnvName, err
+		}
 	}
 	if EBAppEnvName == "Enter a value" {
 		EBAppEnvName, err = opsClients.Prompt.Input("EB_ENV_NAME", "Enter the name of the app environment", ctoai.OptInputAllowEmpty(false))
@@ -79,30 +262,59 @@ func PromptEBInfo(opsClients *setup.SDKClients, ebClient *elasticbeanstalk.Elast
 	return EBAppName, EBAppEnvName, nil
 }
 
-func UpdateEBAppSetup(opsClients *setup.SDKClients, awsSess *session.Session, bucketName, unzippedRepo, awsRegion string) (string, error) {
-	ebClient := elasticbeanstalk.New(awsSess, aws.NewConfig().WithRegion(awsRegion))
+// PromptEBAppName returns preset, or asks for the application with msg when
+// preset is empty.
+func PromptEBAppName(opsClients *setup.SDKClients, ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, preset, msg string) (string, error) {
+	if preset != "" {
+		return preset, nil
+	}
 
-	EBAppName, EBAppEnvName, err := PromptEBInfo(opsClients, ebClient)
+	EBAppNameMatches, err := GetSpecifiedEBApps(ebClient)
 	if err != nil {
-		return EBAppName, err
+		return "", err
 	}
 
-	err = createAppVersion(opsClients.Ux, ebClient, EBAppName, bucketName, unzippedRepo)
+	EBAppName, err := opsClients.Prompt.List("EB_APP_NAME", msg, EBAppNameMatches, ctoai.OptListDefaultValue("Enter a value"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
 	if err != nil {
 		return EBAppName, err
 	}
 
-	err = updateEnvironment(opsClients.Ux, ebClient, bucketName, EBAppEnvName, 0)
+	if EBAppName == "Enter a value" {
+		EBAppName, err = opsClients.Prompt.Input("EB_APP_NAME", "Enter the name of the app", ctoai.OptInputAllowEmpty(false))
+	}
 	if err != nil {
 		return EBAppName, err
 	}
 
-	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  EB Application Name: %s\nℹ️  EB Environment Name: %s\nℹ️  EB Application Version Name: %s", EBAppName, EBAppEnvName, bucketName))
-
 	return EBAppName, nil
 }
 
-func GetSpecifiedEBApps(ebClient *elasticbeanstalk.ElasticBeanstalk) ([]string, error) {
+func UpdateEBAppSetup(ctx context.Context, opsClients *setup.SDKClients, ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, appVersion AppVersion, ebDetails setup.EBDetails) (string, error) {
+	stopEvents := streamEvents(opsClients.Ux, ebClient, ebDetails.AppName, ebDetails.EnvName)
+	defer stopEvents()
+
+	err := createAppVersion(opsClients.Ux, ebClient, ebDetails.AppName, appVersion)
+	if err != nil {
+		return ebDetails.AppName, err
+	}
+
+	err = updateEnvironment(ctx, opsClients.Ux, ebClient, appVersion.Label, ebDetails.EnvName)
+	if err != nil {
+		return ebDetails.AppName, err
+	}
+
+	err = waitForEnvironment(ctx, opsClients.Ux, ebClient, ebDetails.EnvName)
+	if err != nil {
+		return ebDetails.AppName, err
+	}
+	stopEvents()
+
+	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  EB Application Name: %s\nℹ️  EB Environment Name: %s\nℹ️  EB Application Version Name: %s", ebDetails.AppName, ebDetails.EnvName, appVersion.Label))
+
+	return ebDetails.AppName, nil
+}
+
+func GetSpecifiedEBApps(ebClient elasticbeanstalkiface.ElasticBeanstalkAPI) ([]string, error) {
 	EBAppNameMatches := []string{"Enter a value"}
 
 	result, err := ebClient.DescribeApplications(&elasticbeanstalk.DescribeApplicationsInput{})
@@ -117,7 +329,38 @@ func GetSpecifiedEBApps(ebClient *elasticbeanstalk.ElasticBeanstalk) ([]string,
 	return EBAppNameMatches, nil
 }
 
-func getSpecifiedEBAppEnv(ebClient *elasticbeanstalk.ElasticBeanstalk, ebAppName string) ([]string, error) {
+// ApplicationExists reports whether the application appName exists.
+func ApplicationExists(ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, appName string) (bool, error) {
+	result, err := ebClient.DescribeApplications(&elasticbeanstalk.DescribeApplicationsInput{
+		ApplicationNames: []*string{aws.String(appName)},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return false, aerr
+		}
+		return false, err
+	}
+
+	return len(result.Applications) > 0, nil
+}
+
+// FindEnvironment returns the environment envName of appName, or nil if it
+// does not exist or has been terminated.
+func FindEnvironment(ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, appName, envName string) (*elasticbeanstalk.EnvironmentDescription, error) {
+	envs, err := ListEnvironments(ebClient, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, env := range envs {
+		if aws.StringValue(env.EnvironmentName) == envName {
+			return env, nil
+		}
+	}
+	return nil, nil
+}
+
+func getSpecifiedEBAppEnv(ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, ebAppName string) ([]string, error) {
 	EBEnvNameMatches := []string{"Enter a value"}
 
 	input := &elasticbeanstalk.DescribeEnvironmentsInput{
@@ -136,12 +379,11 @@ func getSpecifiedEBAppEnv(ebClient *elasticbeanstalk.ElasticBeanstalk, ebAppName
 	return EBEnvNameMatches, nil
 }
 
-func createApp(ux *ctoai.Ux, ebClient *elasticbeanstalk.ElasticBeanstalk, unzippedRepo string) (string, error) {
+// createApp creates the application EBAppName and reports whether it did not
+// exist yet.
+func createApp(ux logger.UX, ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, EBAppName string) (string, bool, error) {
 	logger.LogSlack(ux, "🔄 Creating Elastic Beanstalk application...")
 
-	unzippedRepoSplit := strings.Split(unzippedRepo, "-")
-	EBAppName := strings.Join(unzippedRepoSplit[:(len(unzippedRepoSplit)-1)], "-")
-
 	input := &elasticbeanstalk.CreateApplicationInput{
 		ApplicationName: aws.String(EBAppName),
 		Description:     aws.String(EBAppName),
@@ -153,47 +395,61 @@ func createApp(ux *ctoai.Ux, ebClient *elasticbeanstalk.ElasticBeanstalk, unzipp
 		if aerr, ok := err.(awserr.Error); ok {
 			if aerr.Message() == fmt.Sprintf("Application %s already exists.", EBAppName) {
 				logger.LogSlack(ux, fmt.Sprintf("ℹ️  Application %s already exists. \nℹ️  Skipping to next step...", EBAppName))
-				return EBAppName, nil
+				return EBAppName, false, nil
 			} else {
-				return EBAppName, aerr
+				return EBAppName, false, aerr
 			}
 		} else {
-			return EBAppName, err
+			return EBAppName, false, err
 		}
 	}
 
 	logger.LogSlack(ux, "✅ Elastic Beanstalk application created.")
-	return EBAppName, nil
+	return EBAppName, true, nil
 }
 
-func createEnviro(ux *ctoai.Ux, ebClient *elasticbeanstalk.ElasticBeanstalk, bucketName, EBAppName, envPlatform string) (string, error) {
+func createEnviro(ux logger.UX, ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, versionLabel, EBAppName, envPlatform string, ebDetails setup.EBDetails) (string, error) {
 	logger.LogSlack(ux, "🔄 Creating Elastic Beanstalk application environment...")
 
-	bucketNameSplit := strings.Split(bucketName, "-")
-	envName := bucketNameSplit[len(bucketNameSplit)-1]
+	envName := ebDetails.EnvName
+	if envName == "" {
+		versionLabelSplit := strings.Split(versionLabel, "-")
+		envName = versionLabelSplit[len(versionLabelSplit)-1]
+	}
 
-	input := &elasticbeanstalk.CreateEnvironmentInput{
-		ApplicationName:   aws.String(EBAppName),
-		CNAMEPrefix:       aws.String(bucketName),
-		EnvironmentName:   aws.String(envName),
-		SolutionStackName: aws.String("64bit Amazon Linux 2018.03 v2.14.2 running Go 1.13.6"),
+	repoPlatform, ok := platform.Lookup(envPlatform)
+	if !ok {
+		return envName, fmt.Errorf("❗ Unsupported Elastic Beanstalk platform %s", envPlatform)
+	}
+
+	platformArn, err := selectPlatformArn(ux, ebClient, repoPlatform, ebDetails)
+	if err != nil {
+		return envName, err
 	}
 
-	switch envPlatform {
-	case "Go":
-		input.SolutionStackName = aws.String("64bit Amazon Linux 2018.03 v2.14.2 running Go 1.13.6")
+	input := &elasticbeanstalk.CreateEnvironmentInput{
+		ApplicationName: aws.String(EBAppName),
+		CNAMEPrefix:     aws.String(versionLabel),
+		EnvironmentName: aws.String(envName),
+		PlatformArn:     aws.String(platformArn),
+		OptionSettings: []*elasticbeanstalk.ConfigurationOptionSetting{
+			{
+				Namespace:  aws.String("aws:autoscaling:launchconfiguration"),
+				OptionName: aws.String("IamInstanceProfile"),
+				Value:      aws.String(InstanceProfile(ebDetails)),
+			},
+		},
+	}
 
-	case "Node":
-		configOptionSetting := elasticbeanstalk.ConfigurationOptionSetting{
-			Namespace:  aws.String("aws:elasticbeanstalk:container:nodejs"),
-			OptionName: aws.String("NodeCommand"),
-			Value:      aws.String("npm start"),
-		}
-		input.SolutionStackName = aws.String("64bit Amazon Linux 2018.03 v4.13.0 running Node.js")
-		input.OptionSettings = []*elasticbeanstalk.ConfigurationOptionSetting{&configOptionSetting}
+	for _, option := range repoPlatform.OptionSettings {
+		input.OptionSettings = append(input.OptionSettings, &elasticbeanstalk.ConfigurationOptionSetting{
+			Namespace:  aws.String(option.Namespace),
+			OptionName: aws.String(option.OptionName),
+			Value:      aws.String(option.Value),
+		})
 	}
 
-	_, err := ebClient.CreateEnvironment(input)
+	_, err = ebClient.CreateEnvironment(input)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			return envName, aerr
@@ -206,19 +462,19 @@ func createEnviro(ux *ctoai.Ux, ebClient *elasticbeanstalk.ElasticBeanstalk, buc
 	return envName, nil
 }
 
-func createAppVersion(ux *ctoai.Ux, ebClient *elasticbeanstalk.ElasticBeanstalk, EBAppName, bucketName, unzippedRepo string) error {
+func createAppVersion(ux logger.UX, ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, EBAppName string, appVersion AppVersion) error {
 	logger.LogSlack(ux, "🔄 Creating Elastic Beanstalk application version...")
 
 	input := &elasticbeanstalk.CreateApplicationVersionInput{
 		ApplicationName:       aws.String(EBAppName),
 		AutoCreateApplication: aws.Bool(true),
-		Description:           aws.String(bucketName),
+		Description:           aws.String(fmt.Sprintf("commit %s", appVersion.CommitSHA)),
 		Process:               aws.Bool(true),
 		SourceBundle: &elasticbeanstalk.S3Location{
-			S3Bucket: aws.String(bucketName),
-			S3Key:    aws.String(fmt.Sprintf("%s.zip", unzippedRepo)),
+			S3Bucket: aws.String(appVersion.S3Bucket),
+			S3Key:    aws.String(appVersion.S3Key),
 		},
-		VersionLabel: aws.String(bucketName),
+		VersionLabel: aws.String(appVersion.Label),
 	}
 
 	_, err := ebClient.CreateApplicationVersion(input)
@@ -233,35 +489,48 @@ func createAppVersion(ux *ctoai.Ux, ebClient *elasticbeanstalk.ElasticBeanstalk,
 	return nil
 }
 
-func updateEnvironment(ux *ctoai.Ux, svc *elasticbeanstalk.ElasticBeanstalk, bucketName, envName string, retries int) error {
-	if retries%2 == 0 {
-		logger.LogSlack(ux, "🔄 Preparing to update Elastic Beanstalk application environment...")
-	}
+// envUpdateTimeout bounds the wait for an environment to accept an update.
+const envUpdateTimeout = 15 * time.Minute
+
+// updateEnvironment deploys versionLabel to envName, retrying while the
+// environment is busy with a previous operation.
+func updateEnvironment(ctx context.Context, ux logger.UX, svc elasticbeanstalkiface.ElasticBeanstalkAPI, versionLabel, envName string) error {
+	logger.LogSlack(ux, "🔄 Preparing to update Elastic Beanstalk application environment...")
 
 	input := &elasticbeanstalk.UpdateEnvironmentInput{
 		EnvironmentName: aws.String(envName),
-		VersionLabel:    aws.String(bucketName),
+		VersionLabel:    aws.String(versionLabel),
 	}
-	_, err := svc.UpdateEnvironment(input)
-	if aerr, ok := err.(awserr.Error); ok {
-		if aerr.Code() == "InvalidParameterValue" && aerr.Message() == fmt.Sprintf("Environment named %s is in an invalid state for this operation. Must be Ready.", envName) && retries <= 20 {
-			time.Sleep(30 * time.Second)
 
-			err := updateEnvironment(ux, svc, bucketName, envName, retries+1)
-			if err != nil {
-				return aerr
-			}
-		} else {
-			return aerr
-		}
-	} else {
-		return err
+	poller := wait.Poller{
+		Backoff: wait.Backoff{Initial: 10 * time.Second, Max: time.Minute, Multiplier: 2, Jitter: 0.2},
+		Timeout: envUpdateTimeout,
+		Progress: func(attempt int, elapsed, next time.Duration) {
+			logger.LogSlack(ux, fmt.Sprintf("🔄 Waiting for Elastic Beanstalk environment %s to become Ready before updating (%v elapsed)...", envName, elapsed.Round(time.Second)))
+		},
 	}
 
-	if retries == 0 {
-		logger.LogSlack(ux, "✅ Elastic Beanstalk application environment has started to update, please wait for it to finish.")
+	err := poller.Until(ctx, func(int) (bool, error) {
+		_, err := svc.UpdateEnvironment(input)
+		if err == nil {
+			return true, nil
+		}
 
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == "InvalidParameterValue" && strings.Contains(aerr.Message(), "is in an invalid state for this operation") {
+				return false, nil
+			}
+			return false, aerr
+		}
+		return false, err
+	})
+	if _, ok := err.(*wait.TimeoutError); ok {
+		return fmt.Errorf("❗ Elastic Beanstalk environment %s was not Ready to update after %v", envName, envUpdateTimeout)
+	}
+	if err != nil {
+		return err
 	}
 
+	logger.LogSlack(ux, "✅ Elastic Beanstalk application environment has started to update.")
 	return nil
 }
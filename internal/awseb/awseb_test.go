@@ -0,0 +1,384 @@
+package awseb_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"git.cto.ai/provision/internal/awseb"
+	"git.cto.ai/provision/internal/fakeaws"
+	"git.cto.ai/provision/internal/fakeops"
+	"git.cto.ai/provision/internal/setup"
+	"git.cto.ai/provision/internal/wait"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var ebDetails = setup.EBDetails{AppName: "demo", EnvName: "production"}
+
+// newEnvironment creates the application and environment of ebDetails in
+// fake, running version v1, and uploads the bundle of version v2.
+func newEnvironment(t *testing.T, fake *fakeaws.AWS) awseb.AppVersion {
+	t.Helper()
+
+	appVersion := awseb.AppVersion{Label: "v2", CommitSHA: "abc123", S3Bucket: "artifacts", S3Key: "demo/v2.zip"}
+
+	_, err := fake.S3.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(appVersion.S3Bucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fake.S3.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(appVersion.S3Bucket),
+		Key:    aws.String(appVersion.S3Key),
+		Body:   bytes.NewReader([]byte("bundle")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fake.EB.CreateApplication(&elasticbeanstalk.CreateApplicationInput{ApplicationName: aws.String(ebDetails.AppName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fake.EB.CreateEnvironment(&elasticbeanstalk.CreateEnvironmentInput{
+		ApplicationName: aws.String(ebDetails.AppName),
+		EnvironmentName: aws.String(ebDetails.EnvName),
+		VersionLabel:    aws.String("v1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return appVersion
+}
+
+// busyAfterUpdate leaves environments Updating once an update has started.
+type busyAfterUpdate struct {
+	*fakeaws.ElasticBeanstalk
+}
+
+func (b busyAfterUpdate) UpdateEnvironment(input *elasticbeanstalk.UpdateEnvironmentInput) (*elasticbeanstalk.EnvironmentDescription, error) {
+	output, err := b.ElasticBeanstalk.UpdateEnvironment(input)
+	if err == nil {
+		b.SetEnvironmentStatus(aws.StringValue(input.EnvironmentName), elasticbeanstalk.EnvironmentStatusUpdating, elasticbeanstalk.EnvironmentHealthGrey, elasticbeanstalk.EnvironmentHealthStatusPending)
+	}
+	return output, err
+}
+
+// slowTermination reports terminated environments as Terminating for the
+// given number of polls, or forever when it is negative.
+type slowTermination struct {
+	*fakeaws.ElasticBeanstalk
+	polls int
+}
+
+func (s *slowTermination) DescribeEnvironments(input *elasticbeanstalk.DescribeEnvironmentsInput) (*elasticbeanstalk.EnvironmentDescriptionsMessage, error) {
+	if s.polls == 0 {
+		return s.ElasticBeanstalk.DescribeEnvironments(input)
+	}
+	s.polls--
+
+	var environments []*elasticbeanstalk.EnvironmentDescription
+	for _, name := range input.EnvironmentNames {
+		environments = append(environments, &elasticbeanstalk.EnvironmentDescription{
+			EnvironmentName: name,
+			Status:          aws.String(elasticbeanstalk.EnvironmentStatusTerminating),
+		})
+	}
+	return &elasticbeanstalk.EnvironmentDescriptionsMessage{Environments: environments}, nil
+}
+
+func TestUpdateEBAppSetupWaitsForBusyEnvironment(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	appVersion := newEnvironment(t, fake)
+	fake.EB.SetEnvironmentStatus(ebDetails.EnvName, elasticbeanstalk.EnvironmentStatusUpdating, elasticbeanstalk.EnvironmentHealthGrey, elasticbeanstalk.EnvironmentHealthStatusPending)
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx := wait.WithClock(context.Background(), clock)
+	opsClients, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := awseb.UpdateEBAppSetup(ctx, opsClients, fake.EB, appVersion, ebDetails)
+		done <- err
+	}()
+
+	// The update is retried while an earlier operation is in progress.
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(2)
+		clock.Advance(time.Minute)
+	}
+	clock.BlockUntil(2)
+	if label := aws.StringValue(fake.EB.Environment(ebDetails.EnvName).VersionLabel); label != "v1" {
+		t.Fatalf("environment runs %s while it is busy, want v1", label)
+	}
+
+	fake.EB.SetEnvironmentStatus(ebDetails.EnvName, elasticbeanstalk.EnvironmentStatusReady, elasticbeanstalk.EnvironmentHealthGreen, elasticbeanstalk.EnvironmentHealthStatusOk)
+	clock.Advance(time.Minute)
+
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := aws.StringValue(fake.EB.Environment(ebDetails.EnvName).VersionLabel); label != "v2" {
+		t.Errorf("environment runs %s, want v2", label)
+	}
+	if !strings.Contains(ux.Output(), "Waiting for Elastic Beanstalk environment production to become Ready before updating") {
+		t.Errorf("output does not report the wait for the busy environment:\n%s", ux.Output())
+	}
+}
+
+func TestUpdateEBAppSetupTimesOutWhileBusy(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	appVersion := newEnvironment(t, fake)
+	fake.EB.SetEnvironmentStatus(ebDetails.EnvName, elasticbeanstalk.EnvironmentStatusUpdating, elasticbeanstalk.EnvironmentHealthGrey, elasticbeanstalk.EnvironmentHealthStatusPending)
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx := wait.WithClock(context.Background(), clock)
+	opsClients, _ := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := awseb.UpdateEBAppSetup(ctx, opsClients, fake.EB, appVersion, ebDetails)
+		done <- err
+	}()
+
+	err := clock.AdvanceWhileWaiting(time.Minute, done)
+	want := "environment production was not Ready to update after 15m0s"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("UpdateEBAppSetup() error = %v, want one containing %q", err, want)
+	}
+}
+
+func TestUpdateEBAppSetupTimesOutWaitingForHealth(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	appVersion := newEnvironment(t, fake)
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx := wait.WithClock(context.Background(), clock)
+	opsClients, _ := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := awseb.UpdateEBAppSetup(ctx, opsClients, busyAfterUpdate{fake.EB}, appVersion, ebDetails)
+		done <- err
+	}()
+
+	err := clock.AdvanceWhileWaiting(time.Minute, done)
+	want := "Timed out after 30m0s waiting for Elastic Beanstalk environment production"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("UpdateEBAppSetup() error = %v, want one containing %q", err, want)
+	}
+}
+
+func TestTerminateEnvironmentWaitsUntilTerminated(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	newEnvironment(t, fake)
+	svc := &slowTermination{ElasticBeanstalk: fake.EB, polls: 3}
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx := wait.WithClock(context.Background(), clock)
+	_, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- awseb.TerminateEnvironment(ctx, ux, svc, ebDetails.EnvName)
+	}()
+
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(2)
+		clock.Advance(time.Minute)
+	}
+
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(ux.Output(), "Elastic Beanstalk environment production terminated") {
+		t.Errorf("output does not report the environment as terminated:\n%s", ux.Output())
+	}
+}
+
+func TestTerminateEnvironmentTimesOut(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	newEnvironment(t, fake)
+	svc := &slowTermination{ElasticBeanstalk: fake.EB, polls: -1}
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx := wait.WithClock(context.Background(), clock)
+	_, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- awseb.TerminateEnvironment(ctx, ux, svc, ebDetails.EnvName)
+	}()
+
+	err := clock.AdvanceWhileWaiting(time.Minute, done)
+	want := "environment production was not terminated after 30m0s"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("TerminateEnvironment() error = %v, want one containing %q", err, want)
+	}
+}
+
+// versionDates are the creation dates of the versions newVersions creates.
+var versionDates = map[string]time.Time{
+	"v1": time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	"v2": time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+	"v3": time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+}
+
+// newVersions creates versions v1, v2 and v3 of the application of ebDetails
+// in fake, and leaves its environment running v3.
+func newVersions(t *testing.T, fake *fakeaws.AWS) {
+	t.Helper()
+
+	appVersion := newEnvironment(t, fake)
+	for _, label := range []string{"v1", "v2", "v3"} {
+		_, err := fake.EB.CreateApplicationVersion(&elasticbeanstalk.CreateApplicationVersionInput{
+			ApplicationName: aws.String(ebDetails.AppName),
+			Description:     aws.String("commit " + label + "sha"),
+			SourceBundle:    &elasticbeanstalk.S3Location{S3Bucket: aws.String(appVersion.S3Bucket), S3Key: aws.String(appVersion.S3Key)},
+			VersionLabel:    aws.String(label),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := fake.EB.UpdateEnvironment(&elasticbeanstalk.UpdateEnvironmentInput{
+		EnvironmentName: aws.String(ebDetails.EnvName),
+		VersionLabel:    aws.String("v3"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// oldestFirst lists application versions oldest first, dated by
+// versionDates, as Elastic Beanstalk may across pages.
+type oldestFirst struct {
+	*fakeaws.ElasticBeanstalk
+}
+
+func (o oldestFirst) DescribeApplicationVersions(input *elasticbeanstalk.DescribeApplicationVersionsInput) (*elasticbeanstalk.DescribeApplicationVersionsOutput, error) {
+	output, err := o.ElasticBeanstalk.DescribeApplicationVersions(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []*elasticbeanstalk.ApplicationVersionDescription
+	for _, version := range output.ApplicationVersions {
+		dated := *version
+		dated.DateCreated = aws.Time(versionDates[aws.StringValue(version.VersionLabel)])
+		versions = append([]*elasticbeanstalk.ApplicationVersionDescription{&dated}, versions...)
+	}
+	return &elasticbeanstalk.DescribeApplicationVersionsOutput{ApplicationVersions: versions}, nil
+}
+
+func TestListApplicationVersionsNewestFirst(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	newVersions(t, fake)
+
+	versions, err := awseb.ListApplicationVersions(oldestFirst{fake.EB}, ebDetails.AppName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var labels []string
+	for _, version := range versions {
+		labels = append(labels, aws.StringValue(version.VersionLabel))
+	}
+	if got, want := strings.Join(labels, ","), "v3,v2,v1"; got != want {
+		t.Errorf("ListApplicationVersions() = %s, want %s", got, want)
+	}
+}
+
+func TestPromptRollbackInfo(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	newVersions(t, fake)
+
+	choice := "v2 (commit v2sha, 2020-01-02 00:00 UTC)"
+	prompt := fakeops.NewPrompt().Answer("EB_VERSION", choice)
+	opsClients, ux := fakeops.NewSDKClients(prompt)
+
+	got, err := awseb.PromptRollbackInfo(opsClients, oldestFirst{fake.EB}, ebDetails)
+	if err != nil {
+		t.Fatalf("PromptRollbackInfo() error = %v", err)
+	}
+	if got.VersionLabel != "v2" {
+		t.Errorf("PromptRollbackInfo() version = %s, want v2", got.VersionLabel)
+	}
+	if len(prompt.Unused()) != 0 {
+		t.Errorf("prompts %v were not asked", prompt.Unused())
+	}
+
+	listed := strings.Join([]string{
+		"ℹ️  Versions of demo, newest first:",
+		"   v3 (commit v3sha, 2020-01-03 00:00 UTC), running on production",
+		"   " + choice,
+		"   v1 (commit v1sha, 2020-01-01 00:00 UTC)",
+	}, "\n")
+	if !strings.Contains(ux.Output(), listed) {
+		t.Errorf("output does not list the versions newest first:\n%s", ux.Output())
+	}
+}
+
+func TestPromptRollbackInfoRejectsCurrentVersion(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	newVersions(t, fake)
+	opsClients, _ := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	preset := ebDetails
+	preset.VersionLabel = "v3"
+	_, err := awseb.PromptRollbackInfo(opsClients, fake.EB, preset)
+	want := "environment production already runs version v3"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("PromptRollbackInfo() error = %v, want one containing %q", err, want)
+	}
+}
+
+func TestRollbackEnvironmentWaitsForHealth(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	newVersions(t, fake)
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx := wait.WithClock(context.Background(), clock)
+	_, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- awseb.RollbackEnvironment(ctx, ux, busyAfterUpdate{fake.EB}, ebDetails.AppName, ebDetails.EnvName, "v2")
+	}()
+
+	// The environment is still updating after a few polls.
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(2)
+		clock.Advance(time.Minute)
+	}
+	clock.BlockUntil(2)
+	select {
+	case err := <-done:
+		t.Fatalf("RollbackEnvironment() = %v before the environment was healthy", err)
+	default:
+	}
+
+	fake.EB.SetEnvironmentStatus(ebDetails.EnvName, elasticbeanstalk.EnvironmentStatusReady, elasticbeanstalk.EnvironmentHealthGreen, elasticbeanstalk.EnvironmentHealthStatusOk)
+	clock.Advance(time.Minute)
+
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := aws.StringValue(fake.EB.Environment(ebDetails.EnvName).VersionLabel); label != "v2" {
+		t.Errorf("environment runs %s, want v2", label)
+	}
+	if !strings.Contains(ux.Output(), "Waiting for Elastic Beanstalk environment production to become ready") {
+		t.Errorf("output does not report the wait for the environment:\n%s", ux.Output())
+	}
+	if !strings.Contains(ux.Output(), "Elastic Beanstalk environment production now runs version v2") {
+		t.Errorf("output does not report the rollback:\n%s", ux.Output())
+	}
+}
@@ -0,0 +1,103 @@
+package awseb
+
+import (
+	"context"
+	"fmt"
+
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/wait"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk/elasticbeanstalkiface"
+)
+
+// TerminateEnvironment terminates envName and waits until it is gone, so that
+// the resources it used, such as its security group, are released.
+func TerminateEnvironment(ctx context.Context, ux logger.UX, svc elasticbeanstalkiface.ElasticBeanstalkAPI, envName string) error {
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Terminating Elastic Beanstalk environment %s...", envName))
+
+	_, err := svc.TerminateEnvironment(&elasticbeanstalk.TerminateEnvironmentInput{
+		EnvironmentName: aws.String(envName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	poller := wait.Poller{
+		Backoff: wait.Backoff{Initial: envReadyPollInterval, Max: envReadyMaxPollInterval, Multiplier: 1.5, Jitter: 0.2},
+		Timeout: envReadyTimeout,
+	}
+
+	err = poller.Until(ctx, func(int) (bool, error) {
+		result, err := svc.DescribeEnvironments(&elasticbeanstalk.DescribeEnvironmentsInput{
+			EnvironmentNames: []*string{aws.String(envName)},
+			IncludeDeleted:   aws.Bool(false),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				return false, aerr
+			}
+			return false, err
+		}
+
+		for _, env := range result.Environments {
+			if aws.StringValue(env.Status) != elasticbeanstalk.EnvironmentStatusTerminated {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if _, ok := err.(*wait.TimeoutError); ok {
+		return fmt.Errorf("❗ Elastic Beanstalk environment %s was not terminated after %v", envName, envReadyTimeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("✅ Elastic Beanstalk environment %s terminated.", envName))
+	return nil
+}
+
+// DeleteApplication deletes appName together with its application versions.
+// The bundles the versions were created from are left in S3.
+func DeleteApplication(ux logger.UX, svc elasticbeanstalkiface.ElasticBeanstalkAPI, appName string) error {
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Deleting Elastic Beanstalk application %s...", appName))
+
+	_, err := svc.DeleteApplication(&elasticbeanstalk.DeleteApplicationInput{
+		ApplicationName: aws.String(appName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("✅ Elastic Beanstalk application %s deleted.", appName))
+	return nil
+}
+
+// DeleteApplicationVersion deletes the version label of appName. Its bundle
+// is left in S3.
+func DeleteApplicationVersion(ux logger.UX, svc elasticbeanstalkiface.ElasticBeanstalkAPI, appName, label string) error {
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Deleting Elastic Beanstalk application version %s...", label))
+
+	_, err := svc.DeleteApplicationVersion(&elasticbeanstalk.DeleteApplicationVersionInput{
+		ApplicationName:    aws.String(appName),
+		DeleteSourceBundle: aws.Bool(false),
+		VersionLabel:       aws.String(label),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	logger.LogSlack(ux, "✅ Elastic Beanstalk application version deleted.")
+	return nil
+}
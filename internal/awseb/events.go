@@ -0,0 +1,124 @@
+package awseb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/wait"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk/elasticbeanstalkiface"
+)
+
+const eventPollInterval = 10 * time.Second
+
+// eventTail follows the Elastic Beanstalk events of an application, and
+// optionally a single environment, from a point in time onwards.
+type eventTail struct {
+	svc     elasticbeanstalkiface.ElasticBeanstalkAPI
+	appName string
+	envName string
+	since   time.Time
+	seen    map[string]bool
+	errors  []*elasticbeanstalk.EventDescription
+}
+
+// streamEvents forwards new events for appName (and envName, if set) to ux
+// until the returned stop function is called. Stopping flushes any remaining
+// events and repeats the ERROR events; it is safe to call more than once.
+func streamEvents(ux logger.UX, svc elasticbeanstalkiface.ElasticBeanstalkAPI, appName, envName string) func() {
+	tail := &eventTail{
+		svc:     svc,
+		appName: appName,
+		envName: envName,
+		since:   time.Now().UTC(),
+		seen:    map[string]bool{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		poller := wait.Poller{Backoff: wait.Constant(eventPollInterval)}
+		poller.Until(ctx, func(int) (bool, error) {
+			tail.poll(ux)
+			return false, nil
+		})
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-finished
+			tail.poll(ux)
+			tail.summary(ux)
+		})
+	}
+}
+
+// poll logs every event since the last poll that has not been logged yet, oldest first.
+func (t *eventTail) poll(ux logger.UX) {
+	input := &elasticbeanstalk.DescribeEventsInput{
+		ApplicationName: aws.String(t.appName),
+		StartTime:       aws.Time(t.since),
+	}
+	if t.envName != "" {
+		input.EnvironmentName = aws.String(t.envName)
+	}
+
+	var events []*elasticbeanstalk.EventDescription
+	err := t.svc.DescribeEventsPages(input, func(page *elasticbeanstalk.DescribeEventsOutput, lastPage bool) bool {
+		events = append(events, page.Events...)
+		return true
+	})
+	if err != nil {
+		logger.LogSlack(ux, fmt.Sprintf("⚠️  Unable to fetch Elastic Beanstalk events: %v", err))
+		return
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return aws.TimeValue(events[i].EventDate).Before(aws.TimeValue(events[j].EventDate))
+	})
+
+	for _, event := range events {
+		key := fmt.Sprintf("%d|%s|%s", aws.TimeValue(event.EventDate).UnixNano(), aws.StringValue(event.EnvironmentName), aws.StringValue(event.Message))
+		if t.seen[key] {
+			continue
+		}
+		t.seen[key] = true
+
+		if eventDate := aws.TimeValue(event.EventDate); eventDate.After(t.since) {
+			t.since = eventDate
+		}
+
+		switch aws.StringValue(event.Severity) {
+		case elasticbeanstalk.EventSeverityError, elasticbeanstalk.EventSeverityFatal:
+			t.errors = append(t.errors, event)
+		}
+
+		logger.LogSlack(ux, formatEvent(event))
+	}
+}
+
+// summary repeats the ERROR and FATAL events seen while tailing.
+func (t *eventTail) summary(ux logger.UX) {
+	if len(t.errors) == 0 {
+		return
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("❗ Elastic Beanstalk reported %d error event(s) during the deploy:", len(t.errors)))
+	for _, event := range t.errors {
+		logger.LogSlack(ux, formatEvent(event))
+	}
+}
+
+func formatEvent(event *elasticbeanstalk.EventDescription) string {
+	return fmt.Sprintf("📋 [%s] %s %s", aws.StringValue(event.Severity), aws.TimeValue(event.EventDate).Format("2006-01-02 15:04:05 MST"), aws.StringValue(event.Message))
+}
@@ -0,0 +1,158 @@
+package awseb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/wait"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk/elasticbeanstalkiface"
+)
+
+const (
+	envReadyTimeout         = 30 * time.Minute
+	envReadyPollInterval    = 15 * time.Second
+	envReadyMaxPollInterval = time.Minute
+)
+
+// envHealth is a point-in-time view of an environment's status and health.
+type envHealth struct {
+	Status       string
+	Health       string
+	HealthStatus string
+	Causes       []string
+}
+
+func (h envHealth) String() string {
+	if h.HealthStatus == "" {
+		return fmt.Sprintf("Status %s, Health %s", h.Status, h.Health)
+	}
+	return fmt.Sprintf("Status %s, Health %s (%s)", h.Status, h.Health, h.HealthStatus)
+}
+
+// failed reports whether the environment ended up unhealthy.
+func (h envHealth) failed() bool {
+	switch h.HealthStatus {
+	case elasticbeanstalk.EnvironmentHealthStatusDegraded, elasticbeanstalk.EnvironmentHealthStatusSevere:
+		return true
+	}
+	return h.Health == elasticbeanstalk.EnvironmentHealthRed
+}
+
+// settled reports whether the environment has finished deploying and its
+// health has been assessed.
+func (h envHealth) settled() bool {
+	if h.Status != elasticbeanstalk.EnvironmentStatusReady {
+		return false
+	}
+	switch h.HealthStatus {
+	case elasticbeanstalk.EnvironmentHealthStatusPending, elasticbeanstalk.EnvironmentHealthStatusUnknown:
+		return false
+	}
+	return h.Health != elasticbeanstalk.EnvironmentHealthGrey
+}
+
+// waitForEnvironment polls envName until it is Ready with a known health,
+// reporting every change along the way. It fails if the environment ends up
+// Red or Degraded, is terminated, or does not settle within envReadyTimeout,
+// and returns ctx's error once ctx is done.
+func waitForEnvironment(ctx context.Context, ux logger.UX, svc elasticbeanstalkiface.ElasticBeanstalkAPI, envName string) error {
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Waiting for Elastic Beanstalk environment %s to become ready...", envName))
+
+	poller := wait.Poller{
+		Backoff: wait.Backoff{Initial: envReadyPollInterval, Max: envReadyMaxPollInterval, Multiplier: 1.5, Jitter: 0.2},
+		Timeout: envReadyTimeout,
+	}
+
+	var health envHealth
+	var lastReport string
+
+	err := poller.Until(ctx, func(int) (bool, error) {
+		var err error
+		health, err = describeEnvHealth(svc, envName)
+		if err != nil {
+			return false, err
+		}
+
+		if report := health.String(); report != lastReport {
+			logger.LogSlack(ux, fmt.Sprintf("ℹ️  Environment %s: %s", envName, report))
+			lastReport = report
+		}
+
+		switch health.Status {
+		case elasticbeanstalk.EnvironmentStatusTerminating, elasticbeanstalk.EnvironmentStatusTerminated:
+			return false, fmt.Errorf("❗ Elastic Beanstalk environment %s is %s", envName, strings.ToLower(health.Status))
+		}
+
+		if !health.settled() {
+			return false, nil
+		}
+		if health.failed() {
+			return false, fmt.Errorf("❗ Elastic Beanstalk environment %s finished with %s%s", envName, health, formatCauses(health.Causes))
+		}
+		return true, nil
+	})
+	if _, ok := err.(*wait.TimeoutError); ok {
+		return fmt.Errorf("❗ Timed out after %v waiting for Elastic Beanstalk environment %s, last seen with %s", envReadyTimeout, envName, health)
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("✅ Elastic Beanstalk environment %s is ready with health %s.", envName, health.Health))
+	return nil
+}
+
+// describeEnvHealth returns the environment's status and health, including the
+// enhanced health status and causes when enhanced health reporting is enabled.
+func describeEnvHealth(svc elasticbeanstalkiface.ElasticBeanstalkAPI, envName string) (envHealth, error) {
+	result, err := svc.DescribeEnvironments(&elasticbeanstalk.DescribeEnvironmentsInput{
+		EnvironmentNames: []*string{aws.String(envName)},
+		IncludeDeleted:   aws.Bool(false),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return envHealth{}, aerr
+		}
+		return envHealth{}, err
+	}
+
+	if len(result.Environments) == 0 {
+		return envHealth{}, fmt.Errorf("❗ Elastic Beanstalk environment %s could not be found", envName)
+	}
+
+	env := result.Environments[0]
+	health := envHealth{
+		Status:       aws.StringValue(env.Status),
+		Health:       aws.StringValue(env.Health),
+		HealthStatus: aws.StringValue(env.HealthStatus),
+	}
+
+	enhanced, err := svc.DescribeEnvironmentHealth(&elasticbeanstalk.DescribeEnvironmentHealthInput{
+		EnvironmentName: aws.String(envName),
+		AttributeNames:  []*string{aws.String("HealthStatus"), aws.String("Causes")},
+	})
+	if err != nil {
+		// Basic health reporting does not support DescribeEnvironmentHealth.
+		return health, nil
+	}
+
+	if enhanced.HealthStatus != nil {
+		health.HealthStatus = *enhanced.HealthStatus
+	}
+	health.Causes = aws.StringValueSlice(enhanced.Causes)
+
+	return health, nil
+}
+
+func formatCauses(causes []string) string {
+	if len(causes) == 0 {
+		return ""
+	}
+	return "\n   " + strings.Join(causes, "\n   ")
+}
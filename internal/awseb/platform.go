@@ -0,0 +1,190 @@
+package awseb
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/platform"
+	"git.cto.ai/provision/internal/setup"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk/elasticbeanstalkiface"
+)
+
+var versionNumberRegexp = regexp.MustCompile(`\d+`)
+
+// selectPlatformArn returns the ARN of the platform version to create envPlatform
+// environments on. Unless ebDetails pins a branch or version, the newest version
+// of the newest supported branch in the client's region is used, preferring
+// branches that run ebDetails.RuntimeVersion.
+func selectPlatformArn(ux logger.UX, svc elasticbeanstalkiface.ElasticBeanstalkAPI, envPlatform platform.Platform, ebDetails setup.EBDetails) (string, error) {
+	summaries, err := listPlatformVersions(svc, envPlatform.BranchPrefix)
+	if err != nil {
+		return "", err
+	}
+	if len(summaries) == 0 {
+		return "", fmt.Errorf("❗ No %s platforms are available in this region", envPlatform.Name)
+	}
+
+	branch := ebDetails.PlatformBranch
+	if branch == "" && ebDetails.RuntimeVersion != "" {
+		var runtimeSummaries []*elasticbeanstalk.PlatformSummary
+		for _, summary := range summaries {
+			if envPlatform.MatchesBranch(aws.StringValue(summary.PlatformBranchName), ebDetails.RuntimeVersion) {
+				runtimeSummaries = append(runtimeSummaries, summary)
+			}
+		}
+
+		branch = newestSupportedBranch(runtimeSummaries)
+		if branch == "" {
+			logger.LogSlack(ux, fmt.Sprintf("⚠️  No supported %s platform branch runs version %s, using the newest branch instead.", envPlatform.Name, ebDetails.RuntimeVersion))
+		}
+	}
+	if branch == "" {
+		branch = newestSupportedBranch(summaries)
+		if branch == "" {
+			return "", fmt.Errorf("❗ Every %s platform branch in this region is deprecated or retired", envPlatform.Name)
+		}
+	}
+
+	var candidates []*elasticbeanstalk.PlatformSummary
+	for _, summary := range summaries {
+		if aws.StringValue(summary.PlatformBranchName) == branch {
+			candidates = append(candidates, summary)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("❗ Platform branch %q is not available in this region. Supported branches:%s", branch, formatBranches(summaries))
+	}
+
+	if isDeprecated(candidates[0]) {
+		return "", fmt.Errorf("❗ Platform branch %q is %s and cannot be used for new environments. Supported branches:%s", branch, aws.StringValue(candidates[0].PlatformBranchLifecycleState), formatBranches(summaries))
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return compareVersions(aws.StringValue(candidates[i].PlatformVersion), aws.StringValue(candidates[j].PlatformVersion)) > 0
+	})
+
+	selected := candidates[0]
+	if ebDetails.PlatformVersion != "" {
+		selected = nil
+		for _, candidate := range candidates {
+			if aws.StringValue(candidate.PlatformVersion) == ebDetails.PlatformVersion {
+				selected = candidate
+				break
+			}
+		}
+		if selected == nil {
+			return "", fmt.Errorf("❗ Platform version %s of %q is not available in this region. The newest is %s", ebDetails.PlatformVersion, branch, aws.StringValue(candidates[0].PlatformVersion))
+		}
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("ℹ️  Elastic Beanstalk Platform: %s, version %s", branch, aws.StringValue(selected.PlatformVersion)))
+
+	return aws.StringValue(selected.PlatformArn), nil
+}
+
+// listPlatformVersions returns every ready, AWS managed platform version whose
+// branch name starts with branchPrefix.
+func listPlatformVersions(svc elasticbeanstalkiface.ElasticBeanstalkAPI, branchPrefix string) ([]*elasticbeanstalk.PlatformSummary, error) {
+	input := &elasticbeanstalk.ListPlatformVersionsInput{
+		Filters: []*elasticbeanstalk.PlatformFilter{
+			{
+				Type:     aws.String("PlatformOwner"),
+				Operator: aws.String("="),
+				Values:   []*string{aws.String("AWSElasticBeanstalk")},
+			},
+			{
+				Type:     aws.String("PlatformStatus"),
+				Operator: aws.String("="),
+				Values:   []*string{aws.String(elasticbeanstalk.PlatformStatusReady)},
+			},
+			{
+				Type:     aws.String("PlatformBranchName"),
+				Operator: aws.String("begins_with"),
+				Values:   []*string{aws.String(branchPrefix)},
+			},
+		},
+	}
+
+	var summaries []*elasticbeanstalk.PlatformSummary
+	err := svc.ListPlatformVersionsPages(input, func(page *elasticbeanstalk.ListPlatformVersionsOutput, lastPage bool) bool {
+		summaries = append(summaries, page.PlatformSummaryList...)
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return nil, aerr
+		}
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+// newestSupportedBranch returns the branch with the highest runtime and
+// operating system versions that is neither deprecated nor retired.
+func newestSupportedBranch(summaries []*elasticbeanstalk.PlatformSummary) string {
+	var newest string
+	for _, summary := range summaries {
+		if isDeprecated(summary) {
+			continue
+		}
+
+		branch := aws.StringValue(summary.PlatformBranchName)
+		if newest == "" || compareVersions(branch, newest) > 0 {
+			newest = branch
+		}
+	}
+	return newest
+}
+
+func isDeprecated(summary *elasticbeanstalk.PlatformSummary) bool {
+	switch strings.ToLower(aws.StringValue(summary.PlatformBranchLifecycleState)) {
+	case "deprecated", "retired":
+		return true
+	}
+	return false
+}
+
+// compareVersions compares the sequences of numbers found in a and b, so that
+// "Node.js 18 running on 64bit Amazon Linux 2023" sorts after
+// "Node.js 18 running on 64bit Amazon Linux 2" and "6.1.10" after "6.1.9".
+func compareVersions(a, b string) int {
+	aNumbers := versionNumberRegexp.FindAllString(a, -1)
+	bNumbers := versionNumberRegexp.FindAllString(b, -1)
+
+	for i := 0; i < len(aNumbers) && i < len(bNumbers); i++ {
+		aNumber, _ := strconv.Atoi(aNumbers[i])
+		bNumber, _ := strconv.Atoi(bNumbers[i])
+		if aNumber != bNumber {
+			if aNumber > bNumber {
+				return 1
+			}
+			return -1
+		}
+	}
+
+	return len(aNumbers) - len(bNumbers)
+}
+
+func formatBranches(summaries []*elasticbeanstalk.PlatformSummary) string {
+	seen := map[string]bool{}
+	var branches []string
+	for _, summary := range summaries {
+		branch := aws.StringValue(summary.PlatformBranchName)
+		if seen[branch] || isDeprecated(summary) {
+			continue
+		}
+		seen[branch] = true
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+
+	return "\n   " + strings.Join(branches, "\n   ")
+}
@@ -0,0 +1,238 @@
+package awseb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/setup"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk/elasticbeanstalkiface"
+	ctoai "github.com/cto-ai/sdk-go"
+)
+
+// ListEnvironments returns the environments of appName that have not been
+// terminated.
+func ListEnvironments(ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, appName string) ([]*elasticbeanstalk.EnvironmentDescription, error) {
+	result, err := ebClient.DescribeEnvironments(&elasticbeanstalk.DescribeEnvironmentsInput{
+		ApplicationName: aws.String(appName),
+		IncludeDeleted:  aws.Bool(false),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return nil, aerr
+		}
+		return nil, err
+	}
+
+	var envs []*elasticbeanstalk.EnvironmentDescription
+	for _, env := range result.Environments {
+		if aws.StringValue(env.Status) != elasticbeanstalk.EnvironmentStatusTerminated {
+			envs = append(envs, env)
+		}
+	}
+
+	return envs, nil
+}
+
+// ListApplicationVersions returns every version of appName, newest first.
+func ListApplicationVersions(ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, appName string) ([]*elasticbeanstalk.ApplicationVersionDescription, error) {
+	input := &elasticbeanstalk.DescribeApplicationVersionsInput{
+		ApplicationName: aws.String(appName),
+	}
+
+	var versions []*elasticbeanstalk.ApplicationVersionDescription
+	for {
+		result, err := ebClient.DescribeApplicationVersions(input)
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				return nil, aerr
+			}
+			return nil, err
+		}
+
+		versions = append(versions, result.ApplicationVersions...)
+
+		if aws.StringValue(result.NextToken) == "" {
+			break
+		}
+		input.NextToken = result.NextToken
+	}
+
+	// Elastic Beanstalk does not promise any order across pages.
+	sort.SliceStable(versions, func(i, j int) bool {
+		return aws.TimeValue(versions[i].DateCreated).After(aws.TimeValue(versions[j].DateCreated))
+	})
+
+	return versions, nil
+}
+
+// VersionCommit returns the commit SHA createAppVersion recorded in the
+// description of version, or an empty string for versions created otherwise.
+func VersionCommit(version *elasticbeanstalk.ApplicationVersionDescription) string {
+	description := aws.StringValue(version.Description)
+	if !strings.HasPrefix(description, "commit ") {
+		return ""
+	}
+	return strings.TrimPrefix(description, "commit ")
+}
+
+// describeVersion returns a line describing version and the environments in
+// running that run it.
+func describeVersion(version *elasticbeanstalk.ApplicationVersionDescription, running map[string][]string) string {
+	commit := VersionCommit(version)
+	if commit == "" {
+		commit = "unknown"
+	}
+
+	line := fmt.Sprintf("%s (commit %s, %s)", aws.StringValue(version.VersionLabel), commit, aws.TimeValue(version.DateCreated).UTC().Format("2006-01-02 15:04 UTC"))
+	if envNames := running[aws.StringValue(version.VersionLabel)]; len(envNames) > 0 {
+		line += fmt.Sprintf(", running on %s", strings.Join(envNames, ", "))
+	}
+	return line
+}
+
+// PromptRollbackInfo resolves the application, environment and version to roll
+// back to, prompting for whichever of them preset leaves out. The versions of
+// the application are listed first, along with the environments that run
+// them.
+func PromptRollbackInfo(opsClients *setup.SDKClients, ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, preset setup.EBDetails) (setup.EBDetails, error) {
+	ebDetails := preset
+
+	var err error
+	ebDetails.AppName, err = PromptEBAppName(opsClients, ebClient, preset.AppName, "Choose the Elastic Beanstalk app that you want to roll back, or enter the name of the app")
+	if err != nil {
+		return ebDetails, err
+	}
+
+	envs, err := ListEnvironments(ebClient, ebDetails.AppName)
+	if err != nil {
+		return ebDetails, err
+	}
+	if len(envs) == 0 {
+		return ebDetails, fmt.Errorf("❗ Elastic Beanstalk application %s has no environments", ebDetails.AppName)
+	}
+
+	allVersions, err := ListApplicationVersions(ebClient, ebDetails.AppName)
+	if err != nil {
+		return ebDetails, err
+	}
+
+	// Versions that failed to process cannot be deployed.
+	var versions []*elasticbeanstalk.ApplicationVersionDescription
+	for _, version := range allVersions {
+		if aws.StringValue(version.Status) != elasticbeanstalk.ApplicationVersionStatusFailed {
+			versions = append(versions, version)
+		}
+	}
+
+	running := map[string][]string{}
+	var envNames []string
+	for _, env := range envs {
+		envName := aws.StringValue(env.EnvironmentName)
+		envNames = append(envNames, envName)
+		running[aws.StringValue(env.VersionLabel)] = append(running[aws.StringValue(env.VersionLabel)], envName)
+	}
+
+	var lines []string
+	for _, version := range versions {
+		lines = append(lines, describeVersion(version, running))
+	}
+	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Versions of %s, newest first:\n   %s", ebDetails.AppName, strings.Join(lines, "\n   ")))
+
+	if ebDetails.EnvName == "" {
+		ebDetails.EnvName, err = opsClients.Prompt.List("EB_ENV_NAME", "Choose the Elastic Beanstalk app environment that you want to roll back", envNames, ctoai.OptListDefaultValue(envNames[0]), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
+		if err != nil {
+			return ebDetails, err
+		}
+	}
+
+	var currentLabel string
+	found := false
+	for _, env := range envs {
+		if aws.StringValue(env.EnvironmentName) == ebDetails.EnvName {
+			currentLabel = aws.StringValue(env.VersionLabel)
+			found = true
+		}
+	}
+	if !found {
+		return ebDetails, fmt.Errorf("❗ Elastic Beanstalk application %s has no environment %s", ebDetails.AppName, ebDetails.EnvName)
+	}
+
+	if ebDetails.VersionLabel != "" {
+		for _, version := range versions {
+			if aws.StringValue(version.VersionLabel) != ebDetails.VersionLabel {
+				continue
+			}
+			if ebDetails.VersionLabel == currentLabel {
+				return ebDetails, fmt.Errorf("❗ Elastic Beanstalk environment %s already runs version %s", ebDetails.EnvName, currentLabel)
+			}
+			return ebDetails, nil
+		}
+		return ebDetails, fmt.Errorf("❗ Elastic Beanstalk application %s has no version %s that can be deployed", ebDetails.AppName, ebDetails.VersionLabel)
+	}
+
+	// The version deployed before the current one is offered first.
+	var choices, labels []string
+	defaultChoice := ""
+	pastCurrent := false
+	for _, version := range versions {
+		label := aws.StringValue(version.VersionLabel)
+		if label == currentLabel {
+			pastCurrent = true
+			continue
+		}
+
+		choice := describeVersion(version, running)
+		choices = append(choices, choice)
+		labels = append(labels, label)
+		if pastCurrent && defaultChoice == "" {
+			defaultChoice = choice
+		}
+	}
+	if len(choices) == 0 {
+		return ebDetails, fmt.Errorf("❗ Elastic Beanstalk application %s has no other version to roll back to", ebDetails.AppName)
+	}
+	if defaultChoice == "" {
+		defaultChoice = choices[0]
+	}
+
+	choice, err := opsClients.Prompt.List("EB_VERSION", fmt.Sprintf("Choose the version to roll %s back to (it runs %s)", ebDetails.EnvName, currentLabel), choices, ctoai.OptListDefaultValue(defaultChoice), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
+	if err != nil {
+		return ebDetails, err
+	}
+
+	for i := range choices {
+		if choices[i] == choice {
+			ebDetails.VersionLabel = labels[i]
+		}
+	}
+	return ebDetails, nil
+}
+
+// RollbackEnvironment deploys the existing version label of appName to
+// envName, and waits for the environment to be healthy on it.
+func RollbackEnvironment(ctx context.Context, ux logger.UX, ebClient elasticbeanstalkiface.ElasticBeanstalkAPI, appName, envName, label string) error {
+	stopEvents := streamEvents(ux, ebClient, appName, envName)
+	defer stopEvents()
+
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Rolling back Elastic Beanstalk environment %s to version %s...", envName, label))
+
+	err := updateEnvironment(ctx, ux, ebClient, label, envName)
+	if err != nil {
+		return err
+	}
+
+	err = waitForEnvironment(ctx, ux, ebClient, envName)
+	if err != nil {
+		return err
+	}
+	stopEvents()
+
+	logger.LogSlack(ux, fmt.Sprintf("✅ Elastic Beanstalk environment %s now runs version %s.", envName, label))
+	return nil
+}
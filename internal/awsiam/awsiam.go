@@ -0,0 +1,111 @@
+package awsiam
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"git.cto.ai/provision/internal/logger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+type policyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []policyStatement `json:"Statement"`
+}
+
+type policyStatement struct {
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource string   `json:"Resource"`
+}
+
+// PutInstanceProfilePolicy allows the roles of instanceProfile to perform
+// actions on resource, through an inline policy called policyName. An existing
+// policy of the same name is replaced.
+func PutInstanceProfilePolicy(ux logger.UX, iamClient iamiface.IAMAPI, instanceProfile, policyName string, actions []string, resource string) error {
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Granting instance profile %s access to %s...", instanceProfile, resource))
+
+	profile, err := iamClient.GetInstanceProfile(&iam.GetInstanceProfileInput{
+		InstanceProfileName: aws.String(instanceProfile),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	if len(profile.InstanceProfile.Roles) == 0 {
+		return fmt.Errorf("❗ Instance profile %s has no role to grant access to", instanceProfile)
+	}
+
+	document, err := json.Marshal(policyDocument{
+		Version: "2012-10-17",
+		Statement: []policyStatement{
+			{
+				Effect:   "Allow",
+				Action:   actions,
+				Resource: resource,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, role := range profile.InstanceProfile.Roles {
+		_, err := iamClient.PutRolePolicy(&iam.PutRolePolicyInput{
+			PolicyDocument: aws.String(string(document)),
+			PolicyName:     aws.String(policyName),
+			RoleName:       role.RoleName,
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				return aerr
+			}
+			return err
+		}
+	}
+
+	logger.LogSlack(ux, "✅ Instance profile access granted.")
+	return nil
+}
+
+// DeleteInstanceProfilePolicy removes the inline policy policyName that
+// PutInstanceProfilePolicy added to the roles of instanceProfile. Roles
+// without the policy are skipped.
+func DeleteInstanceProfilePolicy(ux logger.UX, iamClient iamiface.IAMAPI, instanceProfile, policyName string) error {
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Removing policy %s from instance profile %s...", policyName, instanceProfile))
+
+	profile, err := iamClient.GetInstanceProfile(&iam.GetInstanceProfileInput{
+		InstanceProfileName: aws.String(instanceProfile),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	for _, role := range profile.InstanceProfile.Roles {
+		_, err := iamClient.DeleteRolePolicy(&iam.DeleteRolePolicyInput{
+			PolicyName: aws.String(policyName),
+			RoleName:   role.RoleName,
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				if aerr.Code() == iam.ErrCodeNoSuchEntityException {
+					continue
+				}
+				return aerr
+			}
+			return err
+		}
+	}
+
+	logger.LogSlack(ux, "✅ Instance profile policy removed.")
+	return nil
+}
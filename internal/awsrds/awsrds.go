@@ -1,175 +1,345 @@
 package awsrds
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws/session"
 	ctoai "github.com/cto-ai/sdk-go"
 
+	"git.cto.ai/provision/internal/awsclients"
 	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/rollback"
 	"git.cto.ai/provision/internal/setup"
+	"git.cto.ai/provision/internal/wait"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
 )
 
 type RDSDetails struct {
-	Username        string
-	Password        string
-	Host            string
-	Port            string
-	DBName          string
-	SubnetGroup     string
-	SecurityGroupID string
-	Platform        string
+	Enabled         *bool  `yaml:"enabled"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	Host            string `yaml:"-"`
+	Port            string `yaml:"port"`
+	DBName          string `yaml:"name"`
+	SubnetGroup     string `yaml:"subnet_group"`
+	SecurityGroupID string `yaml:"-"`
+	Platform        string `yaml:"platform"`
+	EngineVersion   string `yaml:"engine_version"`
+	ClusterID       string `yaml:"-"`
+	CredentialStore string `yaml:"credential_store"`
+	// GeneratePassword generates the master password instead of asking for one.
+	GeneratePassword *bool  `yaml:"generate_password"`
+	SecretARN        string `yaml:"-"`
+
+	// AllowPublicSubnets builds the DB subnet group from the public subnets of
+	// a VPC that has no private ones. The database is still not publicly
+	// accessible.
+	AllowPublicSubnets bool `yaml:"allow_public_subnets"`
+
+	InstanceOptions `yaml:",inline"`
 }
 
-func confirmRDSPassword(opsClients *setup.SDKClients, statement string) (string, error) {
-	var confirmedPassword string
-
-	password, err := opsClients.Prompt.Secret("RDS_DB_PASSWORD", statement, ctoai.OptSecretFlag("s"))
-	if err != nil {
-		return confirmedPassword, err
+// complete reports whether every value needed to create an RDS instance was provided up front.
+func (r RDSDetails) complete() bool {
+	if r.Enabled == nil {
+		return false
+	}
+	if !*r.Enabled {
+		return true
 	}
+	return r.DBName != "" && r.Platform != "" && r.Username != "" && (r.Password != "" || aws.BoolValue(r.GeneratePassword))
+}
 
-	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Please confirm the password."))
+// confirmRDSPassword asks for a password twice, giving up after
+// maxPasswordAttempts mismatches.
+func confirmRDSPassword(opsClients *setup.SDKClients, statement string) (string, error) {
+	for attempt := 1; attempt <= maxPasswordAttempts; attempt++ {
+		password, err := opsClients.Prompt.Secret("RDS_DB_PASSWORD", statement, ctoai.OptSecretFlag("s"))
+		if err != nil {
+			return "", err
+		}
 
-	confirmPassword, err := opsClients.Prompt.Secret("RDS_DB_PASSWORD", statement, ctoai.OptSecretFlag("s"))
-	if err != nil {
-		return confirmedPassword, err
-	}
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Please confirm the password."))
 
-	if password != confirmPassword {
-		logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  The passwords did not match. Please try again."))
-		confirmedPassword, err = confirmRDSPassword(opsClients, statement)
+		confirmPassword, err := opsClients.Prompt.Secret("RDS_DB_PASSWORD", statement, ctoai.OptSecretFlag("s"))
 		if err != nil {
-			return confirmPassword, err
+			return "", err
+		}
+
+		if password == confirmPassword {
+			return password, nil
+		}
+
+		if attempt < maxPasswordAttempts {
+			logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  The passwords did not match. Please try again."))
 		}
-	} else {
-		confirmedPassword = password
 	}
 
-	return confirmedPassword, nil
+	return "", fmt.Errorf("❗ The passwords did not match after %d attempts", maxPasswordAttempts)
 }
 
-func NewRDSSetup(opsClients *setup.SDKClients, awsSess *session.Session) (RDSDetails, bool, error) {
-	rdsDetails, rdsBool, err := setRDSInfo(opsClients)
+// NewRDSSetup asks for the database to create and starts creating it. The
+// resources it creates along the way are pushed on undo; the database itself
+// is left for the caller to push, since deleting it needs confirming.
+func NewRDSSetup(opsClients *setup.SDKClients, clients awsclients.Clients, preset RDSDetails, undo *rollback.Stack) (RDSDetails, bool, error) {
+	var rdsDetails RDSDetails
+	var rdsBool bool
+	var engine Engine
+	for attempt := 1; ; attempt++ {
+		var err error
+		rdsDetails, rdsBool, err = setRDSInfo(opsClients, clients.RDS, preset)
+		if err != nil {
+			return rdsDetails, rdsBool, err
+		}
+
+		if !rdsBool {
+			return rdsDetails, rdsBool, nil
+		}
+
+		engineVersion := rdsDetails.EngineVersion
+		if engineVersion == "" {
+			engineVersion = "(default)"
+		}
+
+		engine, _ = LookupEngine(rdsDetails.Platform)
+
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  RDS Information: \n   DBName: %s\n   MasterUsername: %s\n   Platform: %s\n   EngineVersion: %s\n   Port: %s%s", rdsDetails.DBName, rdsDetails.Username, rdsDetails.Platform, engineVersion, rdsDetails.Port, rdsDetails.InstanceOptions.summary(engine)))
+
+		if preset.complete() {
+			break
+		}
+
+		confirmRDSInfo, err := opsClients.Prompt.Confirm("RDS_BOOL", "Please confirm your RDS Information", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
+		if err != nil {
+			return rdsDetails, rdsBool, err
+		}
+		if confirmRDSInfo {
+			break
+		}
+
+		if attempt == maxConfirmAttempts {
+			return rdsDetails, rdsBool, fmt.Errorf("❗ The RDS information was not confirmed after %d attempts", maxConfirmAttempts)
+		}
+	}
+
+	err := validateInstanceOptions(opsClients.Ux, clients.RDS, engine, rdsDetails.EngineVersion, rdsDetails.InstanceOptions)
 	if err != nil {
 		return rdsDetails, rdsBool, err
 	}
 
-	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  RDS Information: \n   DBName: %s\n   MasterUsername: %s\n   Platform: %s", rdsDetails.DBName, rdsDetails.Username, rdsDetails.Platform))
+	ownSubnetGroup := rdsDetails.SubnetGroup == ""
+	rdsDetails, err = placeRDS(opsClients.Ux, clients.RDS, clients.EC2, rdsDetails)
 
-	confirmRDSInfo, err := opsClients.Prompt.Confirm("RDS_BOOL", "Please confirm your RDS Information", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
+	placement := Placement{SecurityGroupID: rdsDetails.SecurityGroupID}
+	if ownSubnetGroup {
+		placement.SubnetGroup = rdsDetails.SubnetGroup
+	}
+	if !placement.Empty() {
+		placed := rdsDetails
+		undo.Push(placement.Description(), func(ctx context.Context) error {
+			return DeletePlacement(ctx, opsClients.Ux, clients.RDS, clients.EC2, placed, placement)
+		})
+	}
 	if err != nil {
 		return rdsDetails, rdsBool, err
 	}
 
-	if !confirmRDSInfo {
-		rdsDetails, rdsBool, err = NewRDSSetup(opsClients, awsSess)
+	if engine.Cluster {
+		rdsDetails, err = createRDSCluster(opsClients.Ux, clients.RDS, rdsDetails, undo)
 		if err != nil {
 			return rdsDetails, rdsBool, err
 		}
-	}
 
-	rdsClient := rds.New(awsSess)
+		return rdsDetails, rdsBool, nil
+	}
 
-	RDSSecurityGroupID, err := createRDSInstance(opsClients.Ux, rdsClient, rdsDetails)
+	err = createRDSInstance(opsClients.Ux, clients.RDS, rdsDetails)
 	if err != nil {
 		return rdsDetails, rdsBool, err
 	}
-	rdsDetails.SecurityGroupID = RDSSecurityGroupID
-
-	dbHost, dbPort, err := getSpecifiedDBInstanceEndpoint(opsClients.Ux, rdsClient, rdsDetails.DBName, 0)
-	rdsDetails.Host = dbHost
-	rdsDetails.Port = dbPort
 
 	return rdsDetails, rdsBool, nil
 }
 
-func setRDSInfo(opsClients *setup.SDKClients) (RDSDetails, bool, error) {
-	rdsDetails := RDSDetails{}
+// WaitForRDS waits for the database created by NewRDSSetup to become available
+// and fills in its endpoint. It returns early with ctx's error once ctx is done.
+func WaitForRDS(ctx context.Context, ux logger.UX, rdsClient rdsiface.RDSAPI, rdsDetails RDSDetails) (RDSDetails, error) {
+	if rdsDetails.ClusterID != "" {
+		dbHost, dbPort, err := getSpecifiedDBClusterEndpoint(ctx, ux, rdsClient, rdsDetails.ClusterID)
+		if err != nil {
+			return rdsDetails, err
+		}
+		rdsDetails.Host = dbHost
+		rdsDetails.Port = dbPort
 
-	rdsBool, err := opsClients.Prompt.Confirm("RDS_BOOL", "Does your app require a RDS database instance?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
+		_, _, err = getSpecifiedDBInstanceEndpoint(ctx, ux, rdsClient, clusterInstanceID(rdsDetails.ClusterID))
+		if err != nil {
+			return rdsDetails, err
+		}
+
+		return rdsDetails, nil
+	}
+
+	dbHost, dbPort, err := getSpecifiedDBInstanceEndpoint(ctx, ux, rdsClient, rdsDetails.DBName)
 	if err != nil {
-		return rdsDetails, rdsBool, err
+		return rdsDetails, err
 	}
+	rdsDetails.Host = dbHost
+	rdsDetails.Port = dbPort
 
-	if rdsBool {
-		rdsBool, err = opsClients.Prompt.Confirm("RDS_BOOL", "A directory and a file containing the RDS details variables will be added to your repository in order to connect to the RDS database instance. If this is acceptable, press 'Y' to continue, otherwise you may continue without an RDS database instance.", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
+	return rdsDetails, nil
+}
+
+func setRDSInfo(opsClients *setup.SDKClients, rdsClient rdsiface.RDSAPI, preset RDSDetails) (RDSDetails, bool, error) {
+	rdsDetails := preset
+
+	var err error
+	var rdsBool bool
+	if preset.Enabled != nil {
+		rdsBool = *preset.Enabled
+	} else {
+		rdsBool, err = opsClients.Prompt.Confirm("RDS_BOOL", "Does your app require a RDS database instance?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
 		if err != nil {
 			return rdsDetails, rdsBool, err
 		}
+
+		if rdsBool {
+			rdsBool, err = opsClients.Prompt.Confirm("RDS_BOOL", "A directory and a file containing the RDS details variables will be added to your repository in order to connect to the RDS database instance. If this is acceptable, press 'Y' to continue, otherwise you may continue without an RDS database instance.", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
+			if err != nil {
+				return rdsDetails, rdsBool, err
+			}
+		}
 	}
 
 	if rdsBool {
-		dbIdentifierID, err := opsClients.Prompt.Input("DB_INSTANCE_IDENTIFIER", "RDS Instance Name", ctoai.OptInputAllowEmpty(false))
-		if err != nil {
-			return rdsDetails, rdsBool, err
+		if rdsDetails.DBName == "" {
+			rdsDetails.DBName, err = opsClients.Prompt.Input("DB_INSTANCE_IDENTIFIER", "RDS Instance Name", ctoai.OptInputAllowEmpty(false))
+			if err != nil {
+				return rdsDetails, rdsBool, err
+			}
 		}
-		rdsDetails.DBName = dbIdentifierID
 
-		rdsPlatformChoices := []string{
-			"postgres",
+		if rdsDetails.Platform == "" {
+			rdsDetails.Platform, err = opsClients.Prompt.List("RDS_PLATFORM", "RDS Platform", PlatformChoices, ctoai.OptListDefaultValue("postgres"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(true))
+			if err != nil {
+				return rdsDetails, rdsBool, err
+			}
 		}
-		rdsPlatform, err := opsClients.Prompt.List("RDS_PLATFORM", "RDS Platform", rdsPlatformChoices, ctoai.OptListDefaultValue("postgres"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(true))
-		if err != nil {
-			return rdsDetails, rdsBool, err
+
+		engine, ok := LookupEngine(rdsDetails.Platform)
+		if !ok {
+			return rdsDetails, rdsBool, fmt.Errorf("❗ Unsupported RDS platform %s", rdsDetails.Platform)
+		}
+
+		if rdsDetails.EngineVersion == "" && !preset.complete() {
+			engineVersions, defaultVersion, err := getEngineVersions(rdsClient, engine.Name)
+			if err != nil {
+				return rdsDetails, rdsBool, err
+			}
+
+			rdsDetails.EngineVersion, err = opsClients.Prompt.List("RDS_ENGINE_VERSION", "RDS Engine Version", engineVersions, ctoai.OptListDefaultValue(defaultVersion), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(true))
+			if err != nil {
+				return rdsDetails, rdsBool, err
+			}
+		}
+
+		if rdsDetails.Port == "" {
+			rdsDetails.Port = fmt.Sprintf("%d", engine.DefaultPort)
+		}
+
+		if preset.complete() {
+			rdsDetails.InstanceOptions = rdsDetails.InstanceOptions.withDefaults(engine)
+		} else {
+			rdsDetails.InstanceOptions, err = promptInstanceOptions(opsClients, rdsClient, engine, rdsDetails.EngineVersion, preset.InstanceOptions)
+			if err != nil {
+				return rdsDetails, rdsBool, err
+			}
 		}
-		rdsDetails.Platform = rdsPlatform
 
-		dbUsername, err := opsClients.Prompt.Input("RDS_DB_USERNAME", "RDS DB Username", ctoai.OptInputAllowEmpty(false))
+		if rdsDetails.Username == "" {
+			rdsDetails.Username, err = opsClients.Prompt.Input("RDS_DB_USERNAME", "RDS DB Username", ctoai.OptInputAllowEmpty(false))
+			if err != nil {
+				return rdsDetails, rdsBool, err
+			}
+		}
+
+		if rdsDetails.CredentialStore == "" && preset.complete() {
+			rdsDetails.CredentialStore = CredentialStoreSecretsManager
+		}
+		rdsDetails.CredentialStore, err = promptCredentialStore(opsClients, rdsDetails.CredentialStore)
 		if err != nil {
 			return rdsDetails, rdsBool, err
 		}
-		rdsDetails.Username = dbUsername
 
-		dbPassword, err := confirmRDSPassword(opsClients, "RDS DB Password")
+		switch {
+		case rdsDetails.Password != "":
+			err = engine.validatePassword(rdsDetails.Password)
+		case aws.BoolValue(rdsDetails.GeneratePassword):
+			rdsDetails.Password, err = generateRDSPassword(opsClients.Ux, engine, rdsDetails.CredentialStore)
+		default:
+			rdsDetails.Password, err = newRDSPassword(opsClients, engine, rdsDetails.CredentialStore)
+		}
 		if err != nil {
 			return rdsDetails, rdsBool, err
 		}
-		rdsDetails.Password = dbPassword
 	}
 
 	return rdsDetails, rdsBool, nil
 }
 
-func UpdateRDSSetup(opsClients *setup.SDKClients, awsSess *session.Session, awsRegion string) (RDSDetails, bool, error) {
-	rdsDetails, rdsBool, err := getRDSInfo(opsClients, awsSess, awsRegion)
-	if err != nil {
-		return rdsDetails, rdsBool, err
-	}
+func UpdateRDSSetup(opsClients *setup.SDKClients, rdsClient rdsiface.RDSAPI, preset RDSDetails) (RDSDetails, bool, error) {
+	for attempt := 1; ; attempt++ {
+		rdsDetails, rdsBool, err := getRDSInfo(opsClients, rdsClient, preset)
+		if err != nil {
+			return rdsDetails, rdsBool, err
+		}
 
-	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  RDS Information: \n   DBName: %s\n   MasterUsername: %s\n   Host: %s\n   Port: %s", rdsDetails.DBName, rdsDetails.Username, rdsDetails.Host, rdsDetails.Port))
+		if !rdsBool {
+			return rdsDetails, rdsBool, nil
+		}
 
-	confirmRDSInfo, err := opsClients.Prompt.Confirm("RDS_BOOL", "Please confirm your RDS Information", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
-	if err != nil {
-		return rdsDetails, rdsBool, err
-	}
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  RDS Information: \n   DBName: %s\n   MasterUsername: %s\n   Host: %s\n   Port: %s", rdsDetails.DBName, rdsDetails.Username, rdsDetails.Host, rdsDetails.Port))
+
+		if preset.Enabled != nil && preset.DBName != "" && preset.Password != "" {
+			return rdsDetails, rdsBool, nil
+		}
 
-	if !confirmRDSInfo {
-		rdsDetails, rdsBool, err = UpdateRDSSetup(opsClients, awsSess, awsRegion)
+		confirmRDSInfo, err := opsClients.Prompt.Confirm("RDS_BOOL", "Please confirm your RDS Information", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
 		if err != nil {
 			return rdsDetails, rdsBool, err
 		}
-	}
+		if confirmRDSInfo {
+			return rdsDetails, rdsBool, nil
+		}
 
-	return rdsDetails, rdsBool, nil
+		if attempt == maxConfirmAttempts {
+			return rdsDetails, rdsBool, fmt.Errorf("❗ The RDS information was not confirmed after %d attempts", maxConfirmAttempts)
+		}
+	}
 }
 
-func getRDSInfo(opsClients *setup.SDKClients, awsSess *session.Session, awsRegion string) (RDSDetails, bool, error) {
-	rdsBool, err := opsClients.Prompt.Confirm("RDS_BOOL", "Does your app require a RDS database?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
-	if err != nil {
-		return RDSDetails{}, rdsBool, err
+func getRDSInfo(opsClients *setup.SDKClients, rdsClient rdsiface.RDSAPI, preset RDSDetails) (RDSDetails, bool, error) {
+	var err error
+	var rdsBool bool
+	if preset.Enabled != nil {
+		rdsBool = *preset.Enabled
+	} else {
+		rdsBool, err = opsClients.Prompt.Confirm("RDS_BOOL", "Does your app require a RDS database?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
+		if err != nil {
+			return RDSDetails{}, rdsBool, err
+		}
 	}
 
 	rdsDetails := RDSDetails{}
 
-	var rdsExisting bool
-	rdsClient := rds.New(awsSess)
+	rdsExisting := rdsBool && preset.DBName != ""
 
-	if rdsBool {
+	if rdsBool && !rdsExisting {
 		rdsExisting, err = opsClients.Prompt.Confirm("RDS_BOOL", "Does your already have an existing RDS database?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
 		if err != nil {
 			return RDSDetails{}, rdsBool, err
@@ -177,13 +347,19 @@ func getRDSInfo(opsClients *setup.SDKClients, awsSess *session.Session, awsRegio
 	}
 
 	if rdsExisting {
-		rdsInstanceNameMatches, rdsInstances, err := getAllRDSInstanceNames(rdsClient)
-
-		rdsInstanceName, err := opsClients.Prompt.List("RDS_INSTANCE_NAME", "Please choose the RDS instance that is connected to the app", rdsInstanceNameMatches, ctoai.OptListDefaultValue("Enter a value"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
+		rdsInstanceNameMatches, databases, err := getAllRDSInstanceNames(rdsClient)
 		if err != nil {
 			return RDSDetails{}, rdsBool, err
 		}
 
+		rdsInstanceName := preset.DBName
+		if rdsInstanceName == "" {
+			rdsInstanceName, err = opsClients.Prompt.List("RDS_INSTANCE_NAME", "Please choose the RDS instance that is connected to the app", rdsInstanceNameMatches, ctoai.OptListDefaultValue("Enter a value"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
+			if err != nil {
+				return RDSDetails{}, rdsBool, err
+			}
+		}
+
 		if rdsInstanceName == "Enter a value" {
 			rdsInstanceName, err = opsClients.Prompt.Input("RDS_INSTANCE_NAME", "Enter the name of the RDS instance that is connected to the app", ctoai.OptInputAllowEmpty(false))
 		}
@@ -191,115 +367,366 @@ func getRDSInfo(opsClients *setup.SDKClients, awsSess *session.Session, awsRegio
 			return RDSDetails{}, rdsBool, err
 		}
 
-		for _, k := range rdsInstances {
-			rdsInstanceNameMatches = append(rdsInstanceNameMatches, *k.DBInstanceIdentifier)
+		for _, database := range databases {
+			if database.DBName == rdsInstanceName {
+				rdsDetails = database
+			}
+		}
 
-			if rdsInstanceName == *k.DBInstanceIdentifier {
-				rdsDetails.DBName = *k.DBInstanceIdentifier
-				rdsDetails.Username = *k.MasterUsername
-				rdsDetails.Host = *k.Endpoint.Address
-				rdsDetails.Port = fmt.Sprintf("%v", *k.Endpoint.Port)
+		if rdsDetails.DBName == "" {
+			return rdsDetails, rdsBool, fmt.Errorf("RDS instance %s could not be found", rdsInstanceName)
+		}
+		if rdsDetails.Host == "" {
+			return rdsDetails, rdsBool, fmt.Errorf("❗ RDS database %s has no endpoint yet. Please try again once it is available", rdsInstanceName)
+		}
+
+		rdsDetails.Password = preset.Password
+		if rdsDetails.Password == "" {
+			rdsDetails.Password, err = confirmRDSPassword(opsClients, "Please enter the master password for the chosen RDS instance")
+			if err != nil {
+				return rdsDetails, rdsBool, err
 			}
-			continue
 		}
 
-		dbPassword, err := confirmRDSPassword(opsClients, "Please enter the master password for the chosen RDS instance")
+		rdsDetails.CredentialStore = preset.CredentialStore
+		if rdsDetails.CredentialStore == "" && preset.DBName != "" && preset.Password != "" {
+			rdsDetails.CredentialStore = CredentialStoreSecretsManager
+		}
+		rdsDetails.CredentialStore, err = promptCredentialStore(opsClients, rdsDetails.CredentialStore)
 		if err != nil {
 			return rdsDetails, rdsBool, err
 		}
-		rdsDetails.Password = dbPassword
 	}
 
 	return rdsDetails, rdsBool, err
 }
 
-func createRDSInstance(ux *ctoai.Ux, rdsClient *rds.RDS, rdsDetails RDSDetails) (string, error) {
+func createRDSInstance(ux logger.UX, rdsClient rdsiface.RDSAPI, rdsDetails RDSDetails) error {
 	logger.LogSlack(ux, "🔄 Creating RDS database...")
 
+	port, err := strconv.ParseInt(rdsDetails.Port, 10, 64)
+	if err != nil {
+		return fmt.Errorf("❗ Invalid RDS port %s", rdsDetails.Port)
+	}
+
+	options := rdsDetails.InstanceOptions
+
 	input := &rds.CreateDBInstanceInput{
-		AllocatedStorage:     aws.Int64(5),
-		DBInstanceClass:      aws.String("db.t2.micro"),
-		DBInstanceIdentifier: aws.String(rdsDetails.DBName),
-		Engine:               aws.String(rdsDetails.Platform),
-		MasterUserPassword:   aws.String(rdsDetails.Password),
-		MasterUsername:       aws.String(rdsDetails.Username),
+		AllocatedStorage:      aws.Int64(options.AllocatedStorage),
+		BackupRetentionPeriod: options.BackupRetentionDays,
+		DBInstanceClass:       aws.String(options.InstanceClass),
+		DBInstanceIdentifier:  aws.String(rdsDetails.DBName),
+		DBSubnetGroupName:     aws.String(rdsDetails.SubnetGroup),
+		DeletionProtection:    options.DeletionProtection,
+		Engine:                aws.String(rdsDetails.Platform),
+		MasterUserPassword:    aws.String(rdsDetails.Password),
+		MasterUsername:        aws.String(rdsDetails.Username),
+		MultiAZ:               options.MultiAZ,
+		Port:                  aws.Int64(port),
+		PubliclyAccessible:    aws.Bool(false),
+		StorageEncrypted:      options.StorageEncrypted,
+		StorageType:           aws.String(options.StorageType),
+		VpcSecurityGroupIds:   aws.StringSlice([]string{rdsDetails.SecurityGroupID}),
+	}
+	if rdsDetails.EngineVersion != "" {
+		input.EngineVersion = aws.String(rdsDetails.EngineVersion)
+	}
+	if options.MaxAllocatedStorage > options.AllocatedStorage {
+		input.MaxAllocatedStorage = aws.Int64(options.MaxAllocatedStorage)
+	}
+	if options.MaintenanceWindow != "" {
+		input.PreferredMaintenanceWindow = aws.String(options.MaintenanceWindow)
+	}
+	if aws.BoolValue(options.StorageEncrypted) && options.KMSKeyID != "" {
+		input.KmsKeyId = aws.String(options.KMSKeyID)
 	}
 
-	results, err := rdsClient.CreateDBInstance(input)
+	_, err = rdsClient.CreateDBInstance(input)
 
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
-			return "", aerr
+			return aerr
 		}
-		return "", err
+		return err
 	}
 
 	logger.LogSlack(ux, "✅ RDS database created.")
 	logger.LogSlack(ux, "ℹ️  Beginning to set up RDS database. This may take around 5 minutes.")
 	logger.LogSlack(ux, "🔄 Setting up RDS database...")
 
-	return *results.DBInstance.VpcSecurityGroups[0].VpcSecurityGroupId, nil
+	return nil
 }
 
-func getSpecifiedDBInstanceEndpoint(ux *ctoai.Ux, rdsClient *rds.RDS, DBIdentifierID string, retries int64) (string, string, error) {
-	input := &rds.DescribeDBInstancesInput{
-		DBInstanceIdentifier: aws.String(DBIdentifierID),
+// createRDSCluster creates an Aurora DB cluster named after rdsDetails.DBName
+// together with its writer instance. A cluster left without its instance is
+// pushed on undo, as it holds no data yet.
+func createRDSCluster(ux logger.UX, rdsClient rdsiface.RDSAPI, rdsDetails RDSDetails, undo *rollback.Stack) (RDSDetails, error) {
+	logger.LogSlack(ux, "🔄 Creating RDS database cluster...")
+
+	port, err := strconv.ParseInt(rdsDetails.Port, 10, 64)
+	if err != nil {
+		return rdsDetails, fmt.Errorf("❗ Invalid RDS port %s", rdsDetails.Port)
 	}
 
-	result, err := rdsClient.DescribeDBInstances(input)
+	options := rdsDetails.InstanceOptions
+
+	clusterInput := &rds.CreateDBClusterInput{
+		BackupRetentionPeriod: options.BackupRetentionDays,
+		DBClusterIdentifier:   aws.String(rdsDetails.DBName),
+		DBSubnetGroupName:     aws.String(rdsDetails.SubnetGroup),
+		DeletionProtection:    options.DeletionProtection,
+		Engine:                aws.String(rdsDetails.Platform),
+		MasterUserPassword:    aws.String(rdsDetails.Password),
+		MasterUsername:        aws.String(rdsDetails.Username),
+		Port:                  aws.Int64(port),
+		StorageEncrypted:      options.StorageEncrypted,
+		VpcSecurityGroupIds:   aws.StringSlice([]string{rdsDetails.SecurityGroupID}),
+	}
+	if rdsDetails.EngineVersion != "" {
+		clusterInput.EngineVersion = aws.String(rdsDetails.EngineVersion)
+	}
+	if options.MaintenanceWindow != "" {
+		clusterInput.PreferredMaintenanceWindow = aws.String(options.MaintenanceWindow)
+	}
+	if aws.BoolValue(options.StorageEncrypted) && options.KMSKeyID != "" {
+		clusterInput.KmsKeyId = aws.String(options.KMSKeyID)
+	}
+
+	clusterResult, err := rdsClient.CreateDBCluster(clusterInput)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
-			return "", "", aerr
+			return rdsDetails, aerr
 		}
-		return "", "", err
+		return rdsDetails, err
 	}
+	rdsDetails.ClusterID = aws.StringValue(clusterResult.DBCluster.DBClusterIdentifier)
 
-	var dbHost string
-	var dbPort string
+	instanceInput := &rds.CreateDBInstanceInput{
+		DBClusterIdentifier:  aws.String(rdsDetails.ClusterID),
+		DBInstanceClass:      aws.String(options.InstanceClass),
+		DBInstanceIdentifier: aws.String(clusterInstanceID(rdsDetails.ClusterID)),
+		Engine:               aws.String(rdsDetails.Platform),
+		PubliclyAccessible:   aws.Bool(false),
+	}
 
-	if *result.DBInstances[0].DBInstanceStatus != "available" {
-		time.Sleep(15 * time.Second)
+	_, err = rdsClient.CreateDBInstance(instanceInput)
+	if err != nil {
+		created := rdsDetails
+		undo.Push(fmt.Sprintf("RDS database cluster %s", created.ClusterID), func(ctx context.Context) error {
+			_, err := DeleteRDS(ctx, ux, rdsClient, created)
+			return err
+		})
 
-		if retries%4 == 0 {
-			logger.LogSlack(ux, "🔄 Setting up RDS database...")
+		if aerr, ok := err.(awserr.Error); ok {
+			return rdsDetails, aerr
 		}
+		return rdsDetails, err
+	}
+
+	logger.LogSlack(ux, "✅ RDS database cluster created.")
+	logger.LogSlack(ux, "ℹ️  Beginning to set up RDS database cluster. This may take around 10 minutes.")
+	logger.LogSlack(ux, "🔄 Setting up RDS database cluster...")
+
+	return rdsDetails, nil
+}
+
+// clusterInstanceID returns the identifier of the writer instance of a cluster.
+func clusterInstanceID(clusterID string) string {
+	return fmt.Sprintf("%s-instance-1", clusterID)
+}
+
+// rdsReadyTimeout bounds the wait for a new database to become available.
+const rdsReadyTimeout = 60 * time.Minute
+
+// rdsPoller returns the poller used to wait for databases, which reports
+// progress as message.
+func rdsPoller(ux logger.UX, message string) wait.Poller {
+	return wait.Poller{
+		Backoff: wait.Backoff{Initial: 15 * time.Second, Max: time.Minute, Multiplier: 1.5, Jitter: 0.2},
+		Timeout: rdsReadyTimeout,
+		Progress: func(attempt int, elapsed, next time.Duration) {
+			if attempt%4 == 1 {
+				logger.LogSlack(ux, fmt.Sprintf("🔄 %s (%v elapsed)", message, elapsed.Round(time.Second)))
+			}
+		},
+	}
+}
 
-		retryHost, retryPort, err := getSpecifiedDBInstanceEndpoint(ux, rdsClient, DBIdentifierID, retries+1)
+func getSpecifiedDBClusterEndpoint(ctx context.Context, ux logger.UX, rdsClient rdsiface.RDSAPI, DBClusterID string) (string, string, error) {
+	input := &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: aws.String(DBClusterID),
+	}
+
+	var dbHost, dbPort string
+	err := rdsPoller(ux, "Setting up RDS database cluster...").Until(ctx, func(int) (bool, error) {
+		result, err := rdsClient.DescribeDBClusters(input)
 		if err != nil {
-			return "", "", err
+			if aerr, ok := err.(awserr.Error); ok {
+				return false, aerr
+			}
+			return false, err
 		}
 
-		dbHost = retryHost
-		dbPort = retryPort
+		if len(result.DBClusters) == 0 {
+			return false, fmt.Errorf("❗ RDS database cluster %s was not found", DBClusterID)
+		}
+		cluster := result.DBClusters[0]
+		if aws.StringValue(cluster.Status) != "available" {
+			return false, nil
+		}
 
-	} else {
-		logger.LogSlack(ux, "✅ RDS database setup completed.")
+		dbHost = aws.StringValue(cluster.Endpoint)
+		dbPort = fmt.Sprintf("%v", aws.Int64Value(cluster.Port))
+		return true, nil
+	})
+	if _, ok := err.(*wait.TimeoutError); ok {
+		return "", "", fmt.Errorf("❗ RDS database cluster %s was not available after %v", DBClusterID, rdsReadyTimeout)
+	}
+	if err != nil {
+		return "", "", err
+	}
 
-		host := fmt.Sprintf("%v", *result.DBInstances[0].Endpoint.Address)
-		port := fmt.Sprintf("%v", *result.DBInstances[0].Endpoint.Port)
+	logger.LogSlack(ux, "✅ RDS database cluster setup completed.")
+	return dbHost, dbPort, nil
+}
 
-		return host, port, nil
+func getSpecifiedDBInstanceEndpoint(ctx context.Context, ux logger.UX, rdsClient rdsiface.RDSAPI, DBIdentifierID string) (string, string, error) {
+	input := &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: aws.String(DBIdentifierID),
+	}
+
+	var dbHost, dbPort string
+	err := rdsPoller(ux, "Setting up RDS database...").Until(ctx, func(int) (bool, error) {
+		result, err := rdsClient.DescribeDBInstances(input)
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				return false, aerr
+			}
+			return false, err
+		}
+
+		if len(result.DBInstances) == 0 {
+			return false, fmt.Errorf("❗ RDS database %s was not found", DBIdentifierID)
+		}
+		instance := result.DBInstances[0]
+		if aws.StringValue(instance.DBInstanceStatus) != "available" || instance.Endpoint == nil {
+			return false, nil
+		}
+
+		dbHost = aws.StringValue(instance.Endpoint.Address)
+		dbPort = fmt.Sprintf("%v", aws.Int64Value(instance.Endpoint.Port))
+		return true, nil
+	})
+	if _, ok := err.(*wait.TimeoutError); ok {
+		return "", "", fmt.Errorf("❗ RDS database %s was not available after %v", DBIdentifierID, rdsReadyTimeout)
+	}
+	if err != nil {
+		return "", "", err
 	}
 
-	return dbHost, dbPort, err
+	logger.LogSlack(ux, "✅ RDS database setup completed.")
+	return dbHost, dbPort, nil
 }
 
-func getAllRDSInstanceNames(rdsClient *rds.RDS) ([]string, []*rds.DBInstance, error) {
-	input := &rds.DescribeDBInstancesInput{}
+// RDSExists reports whether the database in rdsDetails, or the cluster when
+// its engine runs one, exists.
+func RDSExists(rdsClient rdsiface.RDSAPI, rdsDetails RDSDetails) (bool, error) {
+	status, err := rdsStatus(rdsClient, rdsDetails)
+	return status != "", err
+}
+
+// rdsStatus returns the status of the database in rdsDetails, or of the
+// cluster when its engine runs one, or an empty string if it does not exist.
+func rdsStatus(rdsClient rdsiface.RDSAPI, rdsDetails RDSDetails) (string, error) {
+	var status *string
+	var err error
+	if engine, _ := LookupEngine(rdsDetails.Platform); engine.Cluster || rdsDetails.ClusterID != "" {
+		var result *rds.DescribeDBClustersOutput
+		result, err = rdsClient.DescribeDBClusters(&rds.DescribeDBClustersInput{
+			DBClusterIdentifier: aws.String(rdsDetails.DBName),
+		})
+		if err == nil && len(result.DBClusters) > 0 {
+			status = result.DBClusters[0].Status
+		}
+	} else {
+		var result *rds.DescribeDBInstancesOutput
+		result, err = rdsClient.DescribeDBInstances(&rds.DescribeDBInstancesInput{
+			DBInstanceIdentifier: aws.String(rdsDetails.DBName),
+		})
+		if err == nil && len(result.DBInstances) > 0 {
+			status = result.DBInstances[0].DBInstanceStatus
+		}
+	}
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == rds.ErrCodeDBInstanceNotFoundFault || aerr.Code() == rds.ErrCodeDBClusterNotFoundFault {
+				return "", nil
+			}
+			return "", aerr
+		}
+		return "", err
+	}
 
+	return aws.StringValue(status), nil
+}
+
+// getAllRDSInstanceNames lists the databases an app can be connected to: DB
+// clusters, with their cluster endpoint, and DB instances that are not part of
+// a cluster. Databases that are still being created have no Host yet.
+func getAllRDSInstanceNames(rdsClient rdsiface.RDSAPI) ([]string, []RDSDetails, error) {
 	rdsInstanceNameMatches := []string{"Enter a value"}
+	var databases []RDSDetails
+
+	err := rdsClient.DescribeDBClustersPages(&rds.DescribeDBClustersInput{}, func(page *rds.DescribeDBClustersOutput, lastPage bool) bool {
+		for _, cluster := range page.DBClusters {
+			databases = append(databases, RDSDetails{
+				DBName:    aws.StringValue(cluster.DBClusterIdentifier),
+				ClusterID: aws.StringValue(cluster.DBClusterIdentifier),
+				Username:  aws.StringValue(cluster.MasterUsername),
+				Host:      aws.StringValue(cluster.Endpoint),
+				Port:      fmt.Sprintf("%v", aws.Int64Value(cluster.Port)),
+				Platform:  aws.StringValue(cluster.Engine),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return rdsInstanceNameMatches, nil, aerr
+		}
+		return rdsInstanceNameMatches, nil, err
+	}
+
+	err = rdsClient.DescribeDBInstancesPages(&rds.DescribeDBInstancesInput{}, func(page *rds.DescribeDBInstancesOutput, lastPage bool) bool {
+		for _, instance := range page.DBInstances {
+			// Instances of a cluster are reached through its cluster endpoint.
+			if instance.DBClusterIdentifier != nil {
+				continue
+			}
 
-	result, err := rdsClient.DescribeDBInstances(input)
+			database := RDSDetails{
+				DBName:   aws.StringValue(instance.DBInstanceIdentifier),
+				Username: aws.StringValue(instance.MasterUsername),
+				Platform: aws.StringValue(instance.Engine),
+			}
+			if instance.Endpoint != nil {
+				database.Host = aws.StringValue(instance.Endpoint.Address)
+				database.Port = fmt.Sprintf("%v", aws.Int64Value(instance.Endpoint.Port))
+			}
+			databases = append(databases, database)
+		}
+		return true
+	})
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
-			return rdsInstanceNameMatches, result.DBInstances, aerr
+			return rdsInstanceNameMatches, nil, aerr
 		}
-		return rdsInstanceNameMatches, result.DBInstances, err
+		return rdsInstanceNameMatches, nil, err
 	}
 
-	for _, k := range result.DBInstances {
-		rdsInstanceNameMatches = append(rdsInstanceNameMatches, *k.DBInstanceIdentifier)
+	for _, database := range databases {
+		rdsInstanceNameMatches = append(rdsInstanceNameMatches, database.DBName)
 	}
 
-	return rdsInstanceNameMatches, result.DBInstances, nil
+	return rdsInstanceNameMatches, databases, nil
 }
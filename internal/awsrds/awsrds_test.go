@@ -0,0 +1,292 @@
+package awsrds_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"git.cto.ai/provision/internal/awsrds"
+	"git.cto.ai/provision/internal/awsvpc"
+	"git.cto.ai/provision/internal/fakeaws"
+	"git.cto.ai/provision/internal/fakeops"
+	"git.cto.ai/provision/internal/rollback"
+	"git.cto.ai/provision/internal/wait"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// createInstance creates the database demodb in fake, in status "creating".
+func createInstance(t *testing.T, fake *fakeaws.AWS) {
+	t.Helper()
+
+	fake.RDS.InitialStatus = "creating"
+	_, err := fake.RDS.CreateDBInstance(&rds.CreateDBInstanceInput{
+		DBInstanceIdentifier: aws.String("demodb"),
+		DBInstanceClass:      aws.String("db.t3.micro"),
+		Engine:               aws.String("postgres"),
+		MasterUsername:       aws.String("demo"),
+		MasterUserPassword:   aws.String("secret-password"),
+		Port:                 aws.Int64(5432),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForRDSWaitsUntilAvailable(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	createInstance(t, fake)
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx := wait.WithClock(context.Background(), clock)
+	_, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	var details awsrds.RDSDetails
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		details, err = awsrds.WaitForRDS(ctx, ux, fake.RDS, awsrds.RDSDetails{DBName: "demodb"})
+		done <- err
+	}()
+
+	// The database is still being created after a few polls.
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(2)
+		clock.Advance(time.Minute)
+	}
+	clock.BlockUntil(2)
+	fake.RDS.SetStatus("demodb", "available")
+	clock.Advance(time.Minute)
+
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Host == "" || details.Port != "5432" {
+		t.Errorf("WaitForRDS() = %+v, want the endpoint of demodb", details)
+	}
+	if !strings.Contains(ux.Output(), "RDS database setup completed") {
+		t.Errorf("output does not report the database as set up:\n%s", ux.Output())
+	}
+}
+
+func TestWaitForRDSTimesOut(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	createInstance(t, fake)
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx := wait.WithClock(context.Background(), clock)
+	_, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := awsrds.WaitForRDS(ctx, ux, fake.RDS, awsrds.RDSDetails{DBName: "demodb"})
+		done <- err
+	}()
+
+	err := clock.AdvanceWhileWaiting(time.Minute, done)
+	want := "RDS database demodb was not available after 1h0m0s"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("WaitForRDS() error = %v, want one containing %q", err, want)
+	}
+}
+
+func TestWaitForRDSStopsWhenCancelled(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	createInstance(t, fake)
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx, cancel := context.WithCancel(wait.WithClock(context.Background(), clock))
+	_, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := awsrds.WaitForRDS(ctx, ux, fake.RDS, awsrds.RDSDetails{DBName: "demodb"})
+		done <- err
+	}()
+
+	clock.BlockUntil(2)
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Errorf("WaitForRDS() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+// emptyDescribe answers describe calls as if nothing matched, without the
+// not-found error AWS normally returns.
+type emptyDescribe struct {
+	*fakeaws.RDS
+}
+
+func (emptyDescribe) DescribeDBClusters(*rds.DescribeDBClustersInput) (*rds.DescribeDBClustersOutput, error) {
+	return &rds.DescribeDBClustersOutput{}, nil
+}
+
+func (emptyDescribe) DescribeDBInstances(*rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+	return &rds.DescribeDBInstancesOutput{}, nil
+}
+
+func (emptyDescribe) DescribeDBSubnetGroups(*rds.DescribeDBSubnetGroupsInput) (*rds.DescribeDBSubnetGroupsOutput, error) {
+	return &rds.DescribeDBSubnetGroupsOutput{}, nil
+}
+
+func TestPlacementVPCWithEmptySubnetGroupDescription(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+
+	_, err := awsrds.PlacementVPC(emptyDescribe{fake.RDS}, fake.EC2, "shared-subnets")
+	want := "DB subnet group shared-subnets was not found"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("PlacementVPC() error = %v, want one containing %q", err, want)
+	}
+}
+
+func TestWaitForRDSWithEmptyInstanceDescription(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	_, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	_, err := awsrds.WaitForRDS(context.Background(), ux, emptyDescribe{fake.RDS}, awsrds.RDSDetails{DBName: "demodb"})
+	want := "RDS database demodb was not found"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("WaitForRDS() error = %v, want one containing %q", err, want)
+	}
+}
+
+func TestWaitForRDSWithEmptyClusterDescription(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	_, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	_, err := awsrds.WaitForRDS(context.Background(), ux, emptyDescribe{fake.RDS}, awsrds.RDSDetails{DBName: "demodb", ClusterID: "democluster"})
+	want := "RDS database cluster democluster was not found"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("WaitForRDS() error = %v, want one containing %q", err, want)
+	}
+}
+
+// vanishingCluster describes clusters once, then as if nothing matched.
+type vanishingCluster struct {
+	*fakeaws.RDS
+	described bool
+}
+
+func (v *vanishingCluster) DescribeDBClusters(input *rds.DescribeDBClustersInput) (*rds.DescribeDBClustersOutput, error) {
+	if v.described {
+		return &rds.DescribeDBClustersOutput{}, nil
+	}
+	v.described = true
+	return v.RDS.DescribeDBClusters(input)
+}
+
+func TestDeleteRDSWithEmptyClusterDescription(t *testing.T) {
+	fake := fakeaws.New("us-east-1")
+	_, err := fake.RDS.CreateDBCluster(&rds.CreateDBClusterInput{
+		DBClusterIdentifier: aws.String("democluster"),
+		Engine:              aws.String("aurora-postgresql"),
+		MasterUsername:      aws.String("demo"),
+		MasterUserPassword:  aws.String("secret-password"),
+		Port:                aws.Int64(5432),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+	_, err = awsrds.DeleteRDS(context.Background(), ux, &vanishingCluster{RDS: fake.RDS}, awsrds.RDSDetails{DBName: "demodb", ClusterID: "democluster"})
+	want := "RDS database cluster democluster was not found"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("DeleteRDS() error = %v, want one containing %q", err, want)
+	}
+}
+
+// failingInstances fails to create any DB instance.
+type failingInstances struct {
+	*fakeaws.RDS
+}
+
+func (failingInstances) CreateDBInstance(*rds.CreateDBInstanceInput) (*rds.CreateDBInstanceOutput, error) {
+	return nil, errors.New("instance limit exceeded")
+}
+
+func TestNewRDSSetupUndoesWhatItCreated(t *testing.T) {
+	tests := []struct {
+		name            string
+		platform        string
+		subnetGroup     string
+		wantUndo        []string
+		wantSubnetGroup string
+	}{
+		{
+			name:     "cluster without its instance",
+			platform: "aurora-postgresql",
+			wantUndo: []string{"RDS database cluster demodb", "DB subnet group demodb-subnets and security group "},
+		},
+		{
+			name:            "instance in a named subnet group",
+			platform:        "postgres",
+			subnetGroup:     "shared",
+			wantUndo:        []string{"security group "},
+			wantSubnetGroup: "shared",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeaws.New("us-east-1")
+			fake.EC2.AddPrivateSubnet(fakeaws.DefaultVPCID, "a")
+			fake.EC2.AddPrivateSubnet(fakeaws.DefaultVPCID, "b")
+			fake.RDS.AddDBSubnetGroup("shared", fakeaws.DefaultVPCID)
+
+			clients := fake.Clients()
+			clients.RDS = failingInstances{fake.RDS}
+			opsClients, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+
+			preset := awsrds.RDSDetails{
+				Enabled:     aws.Bool(true),
+				DBName:      "demodb",
+				Platform:    tt.platform,
+				Username:    "demo",
+				Password:    "secret-password",
+				SubnetGroup: tt.subnetGroup,
+			}
+			undo := &rollback.Stack{}
+			_, _, err := awsrds.NewRDSSetup(opsClients, clients, preset, undo)
+			if err == nil || !strings.Contains(err.Error(), "instance limit exceeded") {
+				t.Fatalf("NewRDSSetup() error = %v, want the instance creation error", err)
+			}
+
+			descriptions := undo.Descriptions()
+			if len(descriptions) != len(tt.wantUndo) {
+				t.Fatalf("undo = %q, want %d actions", descriptions, len(tt.wantUndo))
+			}
+			for i, want := range tt.wantUndo {
+				if !strings.HasPrefix(descriptions[i], want) {
+					t.Errorf("undo[%d] = %q, want one starting with %q", i, descriptions[i], want)
+				}
+			}
+
+			err = undo.Run(context.Background(), ux)
+			if err != nil {
+				t.Fatalf("Run() error = %v\n%s", err, ux.Output())
+			}
+
+			if fake.RDS.DBCluster("demodb") != nil {
+				t.Error("cluster demodb was not deleted")
+			}
+			if fake.RDS.SubnetGroup(awsrds.SubnetGroupName("demodb")) != nil {
+				t.Error("DB subnet group demodb-subnets was not deleted")
+			}
+			if tt.wantSubnetGroup != "" && fake.RDS.SubnetGroup(tt.wantSubnetGroup) == nil {
+				t.Errorf("DB subnet group %s was deleted", tt.wantSubnetGroup)
+			}
+			groupID, err := awsvpc.FindSecurityGroup(fake.EC2, fakeaws.DefaultVPCID, awsrds.SecurityGroupName("demodb"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if groupID != "" {
+				t.Errorf("security group %s was not deleted", groupID)
+			}
+		})
+	}
+}
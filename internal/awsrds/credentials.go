@@ -0,0 +1,236 @@
+package awsrds
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"git.cto.ai/provision/internal/awsclients"
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/setup"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	ctoai "github.com/cto-ai/sdk-go"
+)
+
+// Credential stores the RDS master credentials can be kept in. Only
+// CredentialStorePlaintext writes the password into the application bundle.
+const (
+	CredentialStoreSecretsManager = "secretsmanager"
+	CredentialStoreSSM            = "ssm"
+	CredentialStorePlaintext      = "plaintext"
+)
+
+// CredentialStores are the credential stores that can be chosen, safest first.
+var CredentialStores = []string{
+	CredentialStoreSecretsManager,
+	CredentialStoreSSM,
+	CredentialStorePlaintext,
+}
+
+// secretValue is the JSON document saved in the credential store. It follows
+// the layout RDS uses for the secrets it manages itself.
+type secretValue struct {
+	Engine   string `json:"engine"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	DBName   string `json:"dbname"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func promptCredentialStore(opsClients *setup.SDKClients, preset string) (string, error) {
+	if preset != "" {
+		return preset, nil
+	}
+
+	credentialStore, err := opsClients.Prompt.List("RDS_CREDENTIAL_STORE", "Where should the RDS credentials be stored? 'plaintext' writes the password into the application bundle", CredentialStores, ctoai.OptListDefaultValue(CredentialStoreSecretsManager), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
+	if err != nil {
+		return "", err
+	}
+
+	return credentialStore, nil
+}
+
+// SecretName returns the name the credentials of the DB instance dbName are
+// stored under in credentialStore.
+func SecretName(credentialStore, dbName string) string {
+	if credentialStore == CredentialStoreSSM {
+		return fmt.Sprintf("/beanstalk/rds/%s", dbName)
+	}
+	return fmt.Sprintf("beanstalk/rds/%s", dbName)
+}
+
+// CredentialReadActions returns the IAM actions the application needs to read
+// credentials kept in credentialStore.
+func CredentialReadActions(credentialStore string) []string {
+	switch credentialStore {
+	case CredentialStoreSecretsManager:
+		return []string{"secretsmanager:GetSecretValue", "secretsmanager:DescribeSecret"}
+	case CredentialStoreSSM:
+		return []string{"ssm:GetParameter"}
+	}
+	return nil
+}
+
+// StoreCredentials saves the connection details of the database in the chosen
+// credential store and records the ARN they can be read from. Plaintext
+// credentials are left untouched.
+func StoreCredentials(ux logger.UX, clients awsclients.Clients, rdsDetails RDSDetails) (RDSDetails, error) {
+	if rdsDetails.CredentialStore == CredentialStorePlaintext {
+		logger.LogSlack(ux, "⚠️  The RDS password will be stored in plaintext in the application bundle.")
+		return rdsDetails, nil
+	}
+
+	value, err := json.Marshal(secretValue{
+		Engine:   rdsDetails.Platform,
+		Host:     rdsDetails.Host,
+		Port:     rdsDetails.Port,
+		DBName:   rdsDetails.DBName,
+		Username: rdsDetails.Username,
+		Password: rdsDetails.Password,
+	})
+	if err != nil {
+		return rdsDetails, err
+	}
+
+	name := SecretName(rdsDetails.CredentialStore, rdsDetails.DBName)
+
+	switch rdsDetails.CredentialStore {
+	case CredentialStoreSSM:
+		logger.LogSlack(ux, "🔄 Saving RDS credentials to SSM Parameter Store...")
+		rdsDetails.SecretARN, err = putParameter(clients.SSM, name, string(value))
+	default:
+		logger.LogSlack(ux, "🔄 Saving RDS credentials to Secrets Manager...")
+		rdsDetails.SecretARN, err = putSecret(clients.SecretsManager, name, string(value))
+	}
+	if err != nil {
+		return rdsDetails, err
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("✅ RDS credentials saved to %s.", rdsDetails.SecretARN))
+	return rdsDetails, nil
+}
+
+// putSecret creates the secret name, or adds a new version to it if it
+// exists, and returns its ARN.
+func putSecret(svc secretsmanageriface.SecretsManagerAPI, name, value string) (string, error) {
+	result, err := svc.CreateSecret(&secretsmanager.CreateSecretInput{
+		Description:  aws.String("RDS master credentials managed by the beanstalk Op"),
+		Name:         aws.String(name),
+		SecretString: aws.String(value),
+	})
+	if err == nil {
+		return aws.StringValue(result.ARN), nil
+	}
+
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return "", err
+	}
+	if aerr.Code() != secretsmanager.ErrCodeResourceExistsException {
+		return "", aerr
+	}
+
+	putResult, err := svc.PutSecretValue(&secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(name),
+		SecretString: aws.String(value),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return "", aerr
+		}
+		return "", err
+	}
+
+	return aws.StringValue(putResult.ARN), nil
+}
+
+// putParameter writes the SecureString parameter name and returns its ARN.
+func putParameter(svc ssmiface.SSMAPI, name, value string) (string, error) {
+	_, err := svc.PutParameter(&ssm.PutParameterInput{
+		Description: aws.String("RDS master credentials managed by the beanstalk Op"),
+		Name:        aws.String(name),
+		Overwrite:   aws.Bool(true),
+		Type:        aws.String(ssm.ParameterTypeSecureString),
+		Value:       aws.String(value),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return "", aerr
+		}
+		return "", err
+	}
+
+	result, err := svc.GetParameter(&ssm.GetParameterInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return "", aerr
+		}
+		return "", err
+	}
+
+	return aws.StringValue(result.Parameter.ARN), nil
+}
+
+// RecoverPassword fills in the master password of a database created by an
+// earlier run. It is read back from the credential store, or asked for when
+// it was never saved in one.
+func RecoverPassword(opsClients *setup.SDKClients, clients awsclients.Clients, rdsDetails RDSDetails) (RDSDetails, error) {
+	if rdsDetails.CredentialStore == CredentialStorePlaintext || rdsDetails.SecretARN == "" {
+		var err error
+		rdsDetails.Password, err = confirmRDSPassword(opsClients, fmt.Sprintf("Please enter the master password of RDS database %s", rdsDetails.DBName))
+		return rdsDetails, err
+	}
+
+	return loadPassword(clients, rdsDetails)
+}
+
+// loadPassword reads the master password of the database back from the
+// credential store it was saved in by StoreCredentials.
+func loadPassword(clients awsclients.Clients, rdsDetails RDSDetails) (RDSDetails, error) {
+	name := SecretName(rdsDetails.CredentialStore, rdsDetails.DBName)
+
+	var value string
+	switch rdsDetails.CredentialStore {
+	case CredentialStoreSSM:
+		result, err := clients.SSM.GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				return rdsDetails, aerr
+			}
+			return rdsDetails, err
+		}
+		value = aws.StringValue(result.Parameter.Value)
+	case CredentialStoreSecretsManager:
+		result, err := clients.SecretsManager.GetSecretValue(&secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(name),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				return rdsDetails, aerr
+			}
+			return rdsDetails, err
+		}
+		value = aws.StringValue(result.SecretString)
+	default:
+		return rdsDetails, fmt.Errorf("❗ RDS credentials kept in %s cannot be read back", rdsDetails.CredentialStore)
+	}
+
+	var secret secretValue
+	err := json.Unmarshal([]byte(value), &secret)
+	if err != nil {
+		return rdsDetails, fmt.Errorf("❗ Unable to parse the RDS credentials in %s: %v", name, err)
+	}
+
+	rdsDetails.Password = secret.Password
+	return rdsDetails, nil
+}
@@ -0,0 +1,217 @@
+package awsrds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"git.cto.ai/provision/internal/awsclients"
+	"git.cto.ai/provision/internal/logger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// FinalSnapshotID returns the identifier of the snapshot taken of the
+// database identifier before it is deleted.
+func FinalSnapshotID(identifier string) string {
+	return fmt.Sprintf("%s-final-%s", identifier, time.Now().UTC().Format("20060102150405"))
+}
+
+// DeleteRDS deletes the database in rdsDetails after taking a final snapshot
+// of it, and returns the snapshot identifier. RDS only snapshots available
+// databases, so one that is still being created is waited for first.
+func DeleteRDS(ctx context.Context, ux logger.UX, rdsClient rdsiface.RDSAPI, rdsDetails RDSDetails) (string, error) {
+	if rdsDetails.ClusterID != "" {
+		_, _, err := getSpecifiedDBClusterEndpoint(ctx, ux, rdsClient, rdsDetails.ClusterID)
+		if err != nil {
+			return "", err
+		}
+
+		result, err := rdsClient.DescribeDBClusters(&rds.DescribeDBClustersInput{
+			DBClusterIdentifier: aws.String(rdsDetails.ClusterID),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				return "", aerr
+			}
+			return "", err
+		}
+
+		if len(result.DBClusters) == 0 {
+			return "", fmt.Errorf("❗ RDS database cluster %s was not found", rdsDetails.ClusterID)
+		}
+
+		snapshotID := FinalSnapshotID(rdsDetails.ClusterID)
+		logger.LogSlack(ux, fmt.Sprintf("🔄 Deleting RDS database cluster %s after taking final snapshot %s...", rdsDetails.ClusterID, snapshotID))
+
+		// The final snapshot is taken of the cluster, so its instances are
+		// deleted without one.
+		for _, member := range result.DBClusters[0].DBClusterMembers {
+			_, err = rdsClient.DeleteDBInstance(&rds.DeleteDBInstanceInput{
+				DBInstanceIdentifier: member.DBInstanceIdentifier,
+			})
+			if err != nil {
+				if aerr, ok := err.(awserr.Error); ok {
+					return "", aerr
+				}
+				return "", err
+			}
+		}
+
+		_, err = rdsClient.DeleteDBCluster(&rds.DeleteDBClusterInput{
+			DBClusterIdentifier:       aws.String(rdsDetails.ClusterID),
+			FinalDBSnapshotIdentifier: aws.String(snapshotID),
+			SkipFinalSnapshot:         aws.Bool(false),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				return "", aerr
+			}
+			return "", err
+		}
+
+		logger.LogSlack(ux, fmt.Sprintf("✅ RDS database cluster %s is being deleted. Final snapshot: %s", rdsDetails.ClusterID, snapshotID))
+		return snapshotID, nil
+	}
+
+	_, _, err := getSpecifiedDBInstanceEndpoint(ctx, ux, rdsClient, rdsDetails.DBName)
+	if err != nil {
+		return "", err
+	}
+
+	snapshotID := FinalSnapshotID(rdsDetails.DBName)
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Deleting RDS database %s after taking final snapshot %s...", rdsDetails.DBName, snapshotID))
+
+	_, err = rdsClient.DeleteDBInstance(&rds.DeleteDBInstanceInput{
+		DBInstanceIdentifier:      aws.String(rdsDetails.DBName),
+		FinalDBSnapshotIdentifier: aws.String(snapshotID),
+		SkipFinalSnapshot:         aws.Bool(false),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return "", aerr
+		}
+		return "", err
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("✅ RDS database %s is being deleted. Final snapshot: %s", rdsDetails.DBName, snapshotID))
+	return snapshotID, nil
+}
+
+// DeleteCredentials removes the credentials StoreCredentials saved for the
+// database. Credentials that are already gone are not an error.
+func DeleteCredentials(ux logger.UX, clients awsclients.Clients, rdsDetails RDSDetails) error {
+	name := SecretName(rdsDetails.CredentialStore, rdsDetails.DBName)
+
+	var err error
+	switch rdsDetails.CredentialStore {
+	case CredentialStoreSSM:
+		logger.LogSlack(ux, fmt.Sprintf("🔄 Deleting SSM parameter %s...", name))
+		_, err = clients.SSM.DeleteParameter(&ssm.DeleteParameterInput{
+			Name: aws.String(name),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterNotFound {
+			err = nil
+		}
+	case CredentialStoreSecretsManager:
+		// The secret is removed right away rather than scheduled for
+		// deletion, so that a later deploy can create it again.
+		logger.LogSlack(ux, fmt.Sprintf("🔄 Deleting secret %s...", name))
+		_, err = clients.SecretsManager.DeleteSecret(&secretsmanager.DeleteSecretInput{
+			ForceDeleteWithoutRecovery: aws.Bool(true),
+			SecretId:                   aws.String(name),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+			err = nil
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	logger.LogSlack(ux, "✅ RDS credentials deleted.")
+	return nil
+}
+
+// FindRDSBySecurityGroup returns the databases and database clusters that use
+// the security group groupID. The credential store of a database found this
+// way is not known.
+func FindRDSBySecurityGroup(rdsClient rdsiface.RDSAPI, groupID string) ([]RDSDetails, error) {
+	var found []RDSDetails
+
+	err := rdsClient.DescribeDBClustersPages(&rds.DescribeDBClustersInput{}, func(page *rds.DescribeDBClustersOutput, lastPage bool) bool {
+		for _, cluster := range page.DBClusters {
+			if usesSecurityGroup(cluster.VpcSecurityGroups, groupID) {
+				found = append(found, RDSDetails{
+					DBName:          aws.StringValue(cluster.DBClusterIdentifier),
+					ClusterID:       aws.StringValue(cluster.DBClusterIdentifier),
+					Platform:        aws.StringValue(cluster.Engine),
+					Username:        aws.StringValue(cluster.MasterUsername),
+					Port:            fmt.Sprintf("%v", aws.Int64Value(cluster.Port)),
+					SubnetGroup:     aws.StringValue(cluster.DBSubnetGroup),
+					SecurityGroupID: groupID,
+				})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return nil, aerr
+		}
+		return nil, err
+	}
+
+	err = rdsClient.DescribeDBInstancesPages(&rds.DescribeDBInstancesInput{}, func(page *rds.DescribeDBInstancesOutput, lastPage bool) bool {
+		for _, instance := range page.DBInstances {
+			// Instances of a cluster are deleted together with it.
+			if instance.DBClusterIdentifier != nil || !usesSecurityGroup(instance.VpcSecurityGroups, groupID) {
+				continue
+			}
+
+			var port int64
+			if instance.Endpoint != nil {
+				port = aws.Int64Value(instance.Endpoint.Port)
+			}
+			var subnetGroup string
+			if instance.DBSubnetGroup != nil {
+				subnetGroup = aws.StringValue(instance.DBSubnetGroup.DBSubnetGroupName)
+			}
+			found = append(found, RDSDetails{
+				DBName:          aws.StringValue(instance.DBInstanceIdentifier),
+				Platform:        aws.StringValue(instance.Engine),
+				Username:        aws.StringValue(instance.MasterUsername),
+				Port:            fmt.Sprintf("%v", port),
+				SubnetGroup:     subnetGroup,
+				SecurityGroupID: groupID,
+			})
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return nil, aerr
+		}
+		return nil, err
+	}
+
+	return found, nil
+}
+
+func usesSecurityGroup(memberships []*rds.VpcSecurityGroupMembership, groupID string) bool {
+	for _, membership := range memberships {
+		if aws.StringValue(membership.VpcSecurityGroupId) == groupID {
+			return true
+		}
+	}
+	return false
+}
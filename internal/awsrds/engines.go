@@ -0,0 +1,86 @@
+package awsrds
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+)
+
+// Engine describes an RDS database engine the Op can create.
+type Engine struct {
+	// Name is the RDS engine identifier, e.g. "aurora-mysql".
+	Name string
+	// DefaultPort is the port the engine listens on unless configured otherwise.
+	DefaultPort int64
+	// Cluster is set for Aurora engines, whose instances belong to a DB cluster.
+	Cluster bool
+	// MaxPasswordLength is the longest master password the engine accepts.
+	MaxPasswordLength int
+}
+
+var engines = []Engine{
+	{Name: "postgres", DefaultPort: 5432, MaxPasswordLength: 128},
+	{Name: "mysql", DefaultPort: 3306, MaxPasswordLength: 41},
+	{Name: "mariadb", DefaultPort: 3306, MaxPasswordLength: 41},
+	{Name: "aurora-mysql", DefaultPort: 3306, Cluster: true, MaxPasswordLength: 41},
+	{Name: "aurora-postgresql", DefaultPort: 5432, Cluster: true, MaxPasswordLength: 99},
+}
+
+// PlatformChoices are the RDS database engines that can be created.
+var PlatformChoices = engineNames()
+
+func engineNames() []string {
+	names := make([]string, 0, len(engines))
+	for _, engine := range engines {
+		names = append(names, engine.Name)
+	}
+	return names
+}
+
+// LookupEngine returns the engine with the RDS identifier name.
+func LookupEngine(name string) (Engine, bool) {
+	for _, engine := range engines {
+		if engine.Name == name {
+			return engine, true
+		}
+	}
+	return Engine{}, false
+}
+
+// getEngineVersions returns the available versions of engine, newest first,
+// along with the version RDS uses by default.
+func getEngineVersions(rdsClient rdsiface.RDSAPI, engine string) ([]string, string, error) {
+	var versions []string
+	err := rdsClient.DescribeDBEngineVersionsPages(&rds.DescribeDBEngineVersionsInput{
+		Engine: aws.String(engine),
+	}, func(page *rds.DescribeDBEngineVersionsOutput, lastPage bool) bool {
+		for _, version := range page.DBEngineVersions {
+			versions = append([]string{aws.StringValue(version.EngineVersion)}, versions...)
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return nil, "", aerr
+		}
+		return nil, "", err
+	}
+
+	if len(versions) == 0 {
+		return nil, "", fmt.Errorf("❗ No versions of the %s engine are available in this region", engine)
+	}
+
+	defaultVersion := versions[0]
+	result, err := rdsClient.DescribeDBEngineVersions(&rds.DescribeDBEngineVersionsInput{
+		Engine:      aws.String(engine),
+		DefaultOnly: aws.Bool(true),
+	})
+	if err == nil && len(result.DBEngineVersions) > 0 {
+		defaultVersion = aws.StringValue(result.DBEngineVersions[0].EngineVersion)
+	}
+
+	return versions, defaultVersion, nil
+}
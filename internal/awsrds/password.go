@@ -0,0 +1,146 @@
+package awsrds
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/setup"
+	ctoai "github.com/cto-ai/sdk-go"
+)
+
+const (
+	// minPasswordLength is the shortest master password every engine accepts.
+	minPasswordLength = 8
+	// generatedPasswordLength is used for generated passwords, capped at the
+	// engine's maximum.
+	generatedPasswordLength = 32
+	// maxPasswordAttempts bounds how often a mistyped password is asked for again.
+	maxPasswordAttempts = 3
+	// maxConfirmAttempts bounds how often rejected RDS information is asked
+	// for again.
+	maxConfirmAttempts = 3
+	// forbiddenPasswordCharacters may not appear in a master password on any engine.
+	forbiddenPasswordCharacters = "/\"@ "
+)
+
+// passwordClasses are the character classes a generated password draws from.
+// Every class is used at least once. The symbols are URL safe, so the password
+// can be placed in a connection string without escaping.
+var passwordClasses = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"0123456789",
+	"-_.~",
+}
+
+// validatePassword returns an error describing why password is not accepted
+// as a master password by the engine.
+func (e Engine) validatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > e.MaxPasswordLength {
+		return fmt.Errorf("❗ The %s master password must be between %d and %d characters long", e.Name, minPasswordLength, e.MaxPasswordLength)
+	}
+
+	if strings.ContainsAny(password, forbiddenPasswordCharacters) {
+		return fmt.Errorf(`❗ The %s master password must not contain "/", '"', "@" or spaces`, e.Name)
+	}
+
+	for _, r := range password {
+		if r < 0x21 || r > 0x7e {
+			return fmt.Errorf("❗ The %s master password must only contain printable ASCII characters", e.Name)
+		}
+	}
+
+	return nil
+}
+
+// generatePassword returns a random password the engine accepts.
+func (e Engine) generatePassword() (string, error) {
+	length := generatedPasswordLength
+	if e.MaxPasswordLength < length {
+		length = e.MaxPasswordLength
+	}
+
+	alphabet := strings.Join(passwordClasses, "")
+	password := make([]byte, length)
+	for i := range password {
+		// The first characters cover each class once; their positions are
+		// shuffled below.
+		class := alphabet
+		if i < len(passwordClasses) {
+			class = passwordClasses[i]
+		}
+
+		c, err := randomIndex(len(class))
+		if err != nil {
+			return "", err
+		}
+		password[i] = class[c]
+	}
+
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomIndex(i + 1)
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return string(password), nil
+}
+
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+// newRDSPassword offers to generate the master password for a new database and
+// otherwise asks for one. A generated password is only shown when it is not
+// saved to a credential store.
+func newRDSPassword(opsClients *setup.SDKClients, engine Engine, credentialStore string) (string, error) {
+	generate, err := opsClients.Prompt.Confirm("RDS_GENERATE_PASSWORD", "Would you like a strong master password to be generated for the RDS database?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(true))
+	if err != nil {
+		return "", err
+	}
+
+	if generate {
+		return generateRDSPassword(opsClients.Ux, engine, credentialStore)
+	}
+
+	for attempt := 1; ; attempt++ {
+		password, err := confirmRDSPassword(opsClients, "RDS DB Password")
+		if err != nil {
+			return "", err
+		}
+
+		err = engine.validatePassword(password)
+		if err == nil {
+			return password, nil
+		}
+		if attempt == maxPasswordAttempts {
+			return "", err
+		}
+
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("%s. Please try again.", err))
+	}
+}
+
+func generateRDSPassword(ux logger.UX, engine Engine, credentialStore string) (string, error) {
+	password, err := engine.generatePassword()
+	if err != nil {
+		return "", err
+	}
+
+	if credentialStore == CredentialStorePlaintext {
+		logger.LogSlack(ux, fmt.Sprintf("🔑 Generated RDS master password: %s\nℹ️  This password will not be shown again.", password))
+	} else {
+		logger.LogSlack(ux, "🔑 Generated a RDS master password. It will only be saved to the credential store.")
+	}
+
+	return password, nil
+}
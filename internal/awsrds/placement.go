@@ -0,0 +1,316 @@
+package awsrds
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"git.cto.ai/provision/internal/awsvpc"
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/wait"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+)
+
+// minSubnetGroupZones is the number of availability zones RDS requires the
+// subnets of a DB subnet group to span.
+const minSubnetGroupZones = 2
+
+// placeRDS chooses where the database runs: the DB subnet group named in
+// rdsDetails.SubnetGroup, or a new one built from the private subnets of the
+// default VPC that Elastic Beanstalk environments launch into. The database
+// gets a security group of its own in the same VPC.
+func placeRDS(ux logger.UX, rdsClient rdsiface.RDSAPI, ec2Client ec2iface.EC2API, rdsDetails RDSDetails) (RDSDetails, error) {
+	logger.LogSlack(ux, "🔄 Preparing RDS network placement...")
+
+	vpcID, err := PlacementVPC(rdsClient, ec2Client, rdsDetails.SubnetGroup)
+	if err != nil {
+		return rdsDetails, err
+	}
+
+	if rdsDetails.SubnetGroup == "" {
+		subnetIDs, private, err := PlacementSubnets(ec2Client, vpcID, rdsDetails.AllowPublicSubnets)
+		if err != nil {
+			return rdsDetails, err
+		}
+		if !private {
+			logger.LogSlack(ux, fmt.Sprintf("⚠️  VPC %s has no private subnets. The RDS database will use its public subnets, but will not be publicly accessible.", vpcID))
+		}
+
+		rdsDetails.SubnetGroup = SubnetGroupName(rdsDetails.DBName)
+		err = ensureDBSubnetGroup(rdsClient, rdsDetails.SubnetGroup, subnetIDs)
+		if err != nil {
+			return rdsDetails, err
+		}
+	}
+
+	rdsDetails.SecurityGroupID, err = awsvpc.EnsureSecurityGroup(ec2Client, vpcID, SecurityGroupName(rdsDetails.DBName), fmt.Sprintf("RDS database %s", rdsDetails.DBName))
+	if err != nil {
+		return rdsDetails, err
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("✅ RDS database will use DB subnet group %s and security group %s.", rdsDetails.SubnetGroup, rdsDetails.SecurityGroupID))
+	return rdsDetails, nil
+}
+
+// SubnetGroupName returns the name of the DB subnet group placeRDS creates
+// for the database dbName.
+func SubnetGroupName(dbName string) string {
+	return fmt.Sprintf("%s-subnets", dbName)
+}
+
+// SecurityGroupName returns the name of the security group of the database
+// dbName.
+func SecurityGroupName(dbName string) string {
+	return fmt.Sprintf("%s-rds", dbName)
+}
+
+// PlacementVPC returns the VPC a database runs in: that of subnetGroup, or
+// the default VPC when subnetGroup is empty.
+func PlacementVPC(rdsClient rdsiface.RDSAPI, ec2Client ec2iface.EC2API, subnetGroup string) (string, error) {
+	if subnetGroup != "" {
+		return getDBSubnetGroupVPC(rdsClient, subnetGroup)
+	}
+	return awsvpc.DefaultVPCID(ec2Client)
+}
+
+// PlacementSubnets returns the subnets of vpcID a new DB subnet group is built
+// from, and whether they are private. Public subnets are only used when the VPC
+// has no private ones and allowPublic is set. The subnets must span at least
+// minSubnetGroupZones availability zones.
+func PlacementSubnets(ec2Client ec2iface.EC2API, vpcID string, allowPublic bool) ([]string, bool, error) {
+	subnets, private, err := awsvpc.PrivateSubnets(ec2Client, vpcID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !private && !allowPublic {
+		return nil, false, fmt.Errorf("❗ VPC %s has no private subnets for the RDS database. Add private subnets to it, name an existing DB subnet group in rds.subnet_group, or set rds.allow_public_subnets to use its public subnets", vpcID)
+	}
+
+	var subnetIDs []string
+	zones := map[string]bool{}
+	for _, subnet := range subnets {
+		subnetIDs = append(subnetIDs, aws.StringValue(subnet.SubnetId))
+		zones[aws.StringValue(subnet.AvailabilityZone)] = true
+	}
+	if len(zones) < minSubnetGroupZones {
+		return nil, false, fmt.Errorf("❗ The subnets of VPC %s for the RDS database span %d availability zones, but a DB subnet group needs subnets in at least %d", vpcID, len(zones), minSubnetGroupZones)
+	}
+
+	return subnetIDs, private, nil
+}
+
+// SubnetGroupExists reports whether the DB subnet group name exists.
+func SubnetGroupExists(rdsClient rdsiface.RDSAPI, name string) (bool, error) {
+	_, err := rdsClient.DescribeDBSubnetGroups(&rds.DescribeDBSubnetGroupsInput{
+		DBSubnetGroupName: aws.String(name),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == rds.ErrCodeDBSubnetGroupNotFoundFault {
+				return false, nil
+			}
+			return false, aerr
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func getDBSubnetGroupVPC(rdsClient rdsiface.RDSAPI, name string) (string, error) {
+	result, err := rdsClient.DescribeDBSubnetGroups(&rds.DescribeDBSubnetGroupsInput{
+		DBSubnetGroupName: aws.String(name),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return "", aerr
+		}
+		return "", err
+	}
+
+	if len(result.DBSubnetGroups) == 0 {
+		return "", fmt.Errorf("❗ DB subnet group %s was not found", name)
+	}
+	return aws.StringValue(result.DBSubnetGroups[0].VpcId), nil
+}
+
+// ensureDBSubnetGroup creates the DB subnet group name, or points an existing
+// one at subnetIDs.
+func ensureDBSubnetGroup(rdsClient rdsiface.RDSAPI, name string, subnetIDs []string) error {
+	_, err := rdsClient.CreateDBSubnetGroup(&rds.CreateDBSubnetGroupInput{
+		DBSubnetGroupDescription: aws.String(fmt.Sprintf("Subnets for RDS database %s", name)),
+		DBSubnetGroupName:        aws.String(name),
+		SubnetIds:                aws.StringSlice(subnetIDs),
+	})
+	if err == nil {
+		return nil
+	}
+
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+	if aerr.Code() != rds.ErrCodeDBSubnetGroupAlreadyExistsFault {
+		return aerr
+	}
+
+	_, err = rdsClient.ModifyDBSubnetGroup(&rds.ModifyDBSubnetGroupInput{
+		DBSubnetGroupName: aws.String(name),
+		SubnetIds:         aws.StringSlice(subnetIDs),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Placement is the DB subnet group and security group placeRDS created for a
+// database. Either is empty when the database uses one that was not created
+// for it.
+type Placement struct {
+	SubnetGroup     string
+	SecurityGroupID string
+}
+
+// Empty reports whether p holds nothing to delete.
+func (p Placement) Empty() bool {
+	return p.SubnetGroup == "" && p.SecurityGroupID == ""
+}
+
+// Description names the resources in p.
+func (p Placement) Description() string {
+	var parts []string
+	if p.SubnetGroup != "" {
+		parts = append(parts, fmt.Sprintf("DB subnet group %s", p.SubnetGroup))
+	}
+	if p.SecurityGroupID != "" {
+		parts = append(parts, fmt.Sprintf("security group %s", p.SecurityGroupID))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// OwnPlacement returns the part of the placement of the database in
+// rdsDetails that placeRDS created for it, which is told apart by the names
+// SubnetGroupName and SecurityGroupName give it. A DB subnet group named in
+// rds.subnet_group is left out.
+func OwnPlacement(ec2Client ec2iface.EC2API, rdsDetails RDSDetails) (Placement, error) {
+	var placement Placement
+	if rdsDetails.SubnetGroup == SubnetGroupName(rdsDetails.DBName) {
+		placement.SubnetGroup = rdsDetails.SubnetGroup
+	}
+
+	if rdsDetails.SecurityGroupID != "" {
+		name, err := awsvpc.DescribeSecurityGroupName(ec2Client, rdsDetails.SecurityGroupID)
+		if err != nil {
+			return placement, err
+		}
+		if name == SecurityGroupName(rdsDetails.DBName) {
+			placement.SecurityGroupID = rdsDetails.SecurityGroupID
+		}
+	}
+
+	return placement, nil
+}
+
+// DeletePlacement deletes placement once the database in rdsDetails is gone,
+// waiting for a deletion that is in progress to finish first. The placement
+// is kept while the database still exists otherwise, and resources that are
+// already gone are skipped.
+func DeletePlacement(ctx context.Context, ux logger.UX, rdsClient rdsiface.RDSAPI, ec2Client ec2iface.EC2API, rdsDetails RDSDetails, placement Placement) error {
+	if placement.SecurityGroupID != "" {
+		name, err := awsvpc.DescribeSecurityGroupName(ec2Client, placement.SecurityGroupID)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			placement.SecurityGroupID = ""
+		}
+	}
+	if placement.SubnetGroup != "" {
+		exists, err := SubnetGroupExists(rdsClient, placement.SubnetGroup)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			placement.SubnetGroup = ""
+		}
+	}
+	if placement.Empty() {
+		return nil
+	}
+
+	gone, err := waitForRDSDeleted(ctx, ux, rdsClient, rdsDetails)
+	if err != nil {
+		return err
+	}
+	if !gone {
+		logger.LogSlack(ux, fmt.Sprintf("ℹ️  Keeping %s, which RDS database %s still uses.", placement.Description(), rdsDetails.DBName))
+		return nil
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Deleting %s...", placement.Description()))
+
+	if placement.SecurityGroupID != "" {
+		// The network interfaces of a database that was just deleted can hold
+		// on to its security group for a few minutes.
+		err := rdsPoller(ux, fmt.Sprintf("Waiting for security group %s to be released...", placement.SecurityGroupID)).Until(ctx, func(int) (bool, error) {
+			err := awsvpc.DeleteSecurityGroup(ec2Client, placement.SecurityGroupID)
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "DependencyViolation" {
+				return false, nil
+			}
+			return err == nil, err
+		})
+		if _, ok := err.(*wait.TimeoutError); ok {
+			return fmt.Errorf("❗ Security group %s was still in use after %v", placement.SecurityGroupID, rdsReadyTimeout)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if placement.SubnetGroup != "" {
+		_, err := rdsClient.DeleteDBSubnetGroup(&rds.DeleteDBSubnetGroupInput{
+			DBSubnetGroupName: aws.String(placement.SubnetGroup),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == rds.ErrCodeDBSubnetGroupNotFoundFault {
+			err = nil
+		}
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				return aerr
+			}
+			return err
+		}
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("✅ Deleted %s.", placement.Description()))
+	return nil
+}
+
+// waitForRDSDeleted waits while the database in rdsDetails, or the cluster
+// when its engine runs one, is being deleted, and reports whether it is gone.
+// A database that is not being deleted is not waited for.
+func waitForRDSDeleted(ctx context.Context, ux logger.UX, rdsClient rdsiface.RDSAPI, rdsDetails RDSDetails) (bool, error) {
+	var gone bool
+	err := rdsPoller(ux, fmt.Sprintf("Waiting for RDS database %s to be deleted...", rdsDetails.DBName)).Until(ctx, func(int) (bool, error) {
+		status, err := rdsStatus(rdsClient, rdsDetails)
+		if err != nil {
+			return false, err
+		}
+
+		gone = status == ""
+		return status != "deleting", nil
+	})
+	if _, ok := err.(*wait.TimeoutError); ok {
+		return false, fmt.Errorf("❗ RDS database %s was not deleted after %v", rdsDetails.DBName, rdsReadyTimeout)
+	}
+	return gone, err
+}
@@ -0,0 +1,326 @@
+package awsrds
+
+import (
+	"fmt"
+	"strings"
+
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/setup"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+	ctoai "github.com/cto-ai/sdk-go"
+)
+
+// InstanceOptions size the RDS instance and control its availability. Zero
+// values fall back to DefaultInstanceOptions.
+type InstanceOptions struct {
+	InstanceClass string `yaml:"instance_class"`
+	StorageType   string `yaml:"storage_type"`
+	// AllocatedStorage is the initial storage size in GiB.
+	AllocatedStorage int64 `yaml:"allocated_storage"`
+	// MaxAllocatedStorage enables storage autoscaling up to this size in GiB
+	// when it is larger than AllocatedStorage.
+	MaxAllocatedStorage int64  `yaml:"max_allocated_storage"`
+	MultiAZ             *bool  `yaml:"multi_az"`
+	BackupRetentionDays *int64 `yaml:"backup_retention_days"`
+	// MaintenanceWindow uses the RDS format, e.g. "sun:05:00-sun:06:00" (UTC).
+	MaintenanceWindow  string `yaml:"maintenance_window"`
+	StorageEncrypted   *bool  `yaml:"storage_encrypted"`
+	KMSKeyID           string `yaml:"kms_key_id"`
+	DeletionProtection *bool  `yaml:"deletion_protection"`
+}
+
+// StorageTypes are the RDS storage types that can be requested.
+var StorageTypes = []string{"gp3", "gp2", "io1", "io2", "standard"}
+
+// DefaultInstanceOptions are used for every option that is not configured.
+var DefaultInstanceOptions = InstanceOptions{
+	InstanceClass:       "db.t3.micro",
+	StorageType:         "gp3",
+	AllocatedStorage:    20,
+	MultiAZ:             aws.Bool(false),
+	BackupRetentionDays: aws.Int64(7),
+	StorageEncrypted:    aws.Bool(true),
+	DeletionProtection:  aws.Bool(false),
+}
+
+// defaultClusterInstanceClass is the smallest class Aurora MySQL and Aurora
+// PostgreSQL both support.
+const defaultClusterInstanceClass = "db.t3.medium"
+
+// withDefaults fills every unset option from DefaultInstanceOptions. Aurora
+// instances use a larger default class, since Aurora does not offer micro classes.
+func (o InstanceOptions) withDefaults(engine Engine) InstanceOptions {
+	defaults := DefaultInstanceOptions
+	if engine.Cluster {
+		defaults.InstanceClass = defaultClusterInstanceClass
+	}
+
+	if o.InstanceClass == "" {
+		o.InstanceClass = defaults.InstanceClass
+	}
+	if o.StorageType == "" {
+		o.StorageType = defaults.StorageType
+	}
+	if o.AllocatedStorage == 0 {
+		o.AllocatedStorage = defaults.AllocatedStorage
+	}
+	if o.MultiAZ == nil {
+		o.MultiAZ = defaults.MultiAZ
+	}
+	if o.BackupRetentionDays == nil {
+		o.BackupRetentionDays = defaults.BackupRetentionDays
+	}
+	if o.StorageEncrypted == nil {
+		o.StorageEncrypted = defaults.StorageEncrypted
+	}
+	if o.DeletionProtection == nil {
+		o.DeletionProtection = defaults.DeletionProtection
+	}
+	return o
+}
+
+// summary describes the options for the RDS information log.
+func (o InstanceOptions) summary(engine Engine) string {
+	lines := []string{fmt.Sprintf("InstanceClass: %s", o.InstanceClass)}
+	if !engine.Cluster {
+		storage := fmt.Sprintf("Storage: %d GiB %s", o.AllocatedStorage, o.StorageType)
+		if o.MaxAllocatedStorage > o.AllocatedStorage {
+			storage += fmt.Sprintf(", autoscaling to %d GiB", o.MaxAllocatedStorage)
+		}
+		lines = append(lines, storage, fmt.Sprintf("MultiAZ: %t", aws.BoolValue(o.MultiAZ)))
+	}
+	lines = append(lines, fmt.Sprintf("BackupRetention: %d days", aws.Int64Value(o.BackupRetentionDays)))
+	if o.MaintenanceWindow != "" {
+		lines = append(lines, fmt.Sprintf("MaintenanceWindow: %s", o.MaintenanceWindow))
+	}
+	encryption := fmt.Sprintf("StorageEncrypted: %t", aws.BoolValue(o.StorageEncrypted))
+	if o.KMSKeyID != "" {
+		encryption += fmt.Sprintf(" (KMS key %s)", o.KMSKeyID)
+	}
+	lines = append(lines, encryption, fmt.Sprintf("DeletionProtection: %t", aws.BoolValue(o.DeletionProtection)))
+
+	return "\n   " + strings.Join(lines, "\n   ")
+}
+
+// promptInstanceOptions asks for the options that were not configured, after
+// offering to keep the defaults.
+func promptInstanceOptions(opsClients *setup.SDKClients, rdsClient rdsiface.RDSAPI, engine Engine, engineVersion string, preset InstanceOptions) (InstanceOptions, error) {
+	options := preset
+
+	customize, err := opsClients.Prompt.Confirm("RDS_CUSTOMIZE", "Would you like to customize the RDS instance class, storage and availability options?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
+	if err != nil || !customize {
+		return options.withDefaults(engine), err
+	}
+
+	defaults := InstanceOptions{}.withDefaults(engine)
+
+	if options.InstanceClass == "" {
+		classes, err := getOrderableInstanceClasses(rdsClient, engine.Name, engineVersion)
+		if err != nil {
+			return options, err
+		}
+
+		options.InstanceClass, err = opsClients.Prompt.List("RDS_INSTANCE_CLASS", "RDS Instance Class", classes, ctoai.OptListDefaultValue(defaults.InstanceClass), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(true))
+		if err != nil {
+			return options, err
+		}
+	}
+
+	if !engine.Cluster {
+		if options.StorageType == "" {
+			options.StorageType, err = opsClients.Prompt.List("RDS_STORAGE_TYPE", "RDS Storage Type", StorageTypes, ctoai.OptListDefaultValue(defaults.StorageType), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
+			if err != nil {
+				return options, err
+			}
+		}
+
+		if options.AllocatedStorage == 0 {
+			allocatedStorage, err := opsClients.Prompt.Number("RDS_ALLOCATED_STORAGE", "RDS Storage Size (GiB)", ctoai.OptNumberDefault(int(defaults.AllocatedStorage)), ctoai.OptNumberMinimum(5), ctoai.OptNumberMaximum(65536), ctoai.OptNumberFlag("n"))
+			if err != nil {
+				return options, err
+			}
+			options.AllocatedStorage = int64(allocatedStorage)
+		}
+
+		if options.MaxAllocatedStorage == 0 {
+			maxAllocatedStorage, err := opsClients.Prompt.Number("RDS_MAX_ALLOCATED_STORAGE", "Maximum RDS Storage Size for autoscaling (GiB, 0 to disable)", ctoai.OptNumberDefault(0), ctoai.OptNumberMinimum(0), ctoai.OptNumberMaximum(65536), ctoai.OptNumberFlag("n"))
+			if err != nil {
+				return options, err
+			}
+			options.MaxAllocatedStorage = int64(maxAllocatedStorage)
+		}
+
+		if options.MultiAZ == nil {
+			multiAZ, err := opsClients.Prompt.Confirm("RDS_MULTI_AZ", "Should the RDS instance be deployed across multiple Availability Zones?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
+			if err != nil {
+				return options, err
+			}
+			options.MultiAZ = aws.Bool(multiAZ)
+		}
+	}
+
+	if options.BackupRetentionDays == nil {
+		backupRetentionDays, err := opsClients.Prompt.Number("RDS_BACKUP_RETENTION", "RDS Backup Retention (days, 0 to disable)", ctoai.OptNumberDefault(int(aws.Int64Value(defaults.BackupRetentionDays))), ctoai.OptNumberMinimum(0), ctoai.OptNumberMaximum(35), ctoai.OptNumberFlag("n"))
+		if err != nil {
+			return options, err
+		}
+		options.BackupRetentionDays = aws.Int64(int64(backupRetentionDays))
+	}
+
+	if options.MaintenanceWindow == "" {
+		options.MaintenanceWindow, err = opsClients.Prompt.Input("RDS_MAINTENANCE_WINDOW", "RDS Maintenance Window, e.g. sun:05:00-sun:06:00 (UTC). Leave empty to let AWS choose", ctoai.OptInputAllowEmpty(true))
+		if err != nil {
+			return options, err
+		}
+	}
+
+	if options.StorageEncrypted == nil {
+		storageEncrypted, err := opsClients.Prompt.Confirm("RDS_STORAGE_ENCRYPTED", "Should the RDS storage be encrypted?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(true))
+		if err != nil {
+			return options, err
+		}
+		options.StorageEncrypted = aws.Bool(storageEncrypted)
+	}
+
+	if aws.BoolValue(options.StorageEncrypted) && options.KMSKeyID == "" {
+		options.KMSKeyID, err = opsClients.Prompt.Input("RDS_KMS_KEY_ID", "KMS key ID or ARN to encrypt the RDS storage with. Leave empty to use the AWS managed key", ctoai.OptInputAllowEmpty(true))
+		if err != nil {
+			return options, err
+		}
+	}
+
+	if options.DeletionProtection == nil {
+		deletionProtection, err := opsClients.Prompt.Confirm("RDS_DELETION_PROTECTION", "Should deletion protection be enabled on the RDS database?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
+		if err != nil {
+			return options, err
+		}
+		options.DeletionProtection = aws.Bool(deletionProtection)
+	}
+
+	return options.withDefaults(engine), nil
+}
+
+// getOrderableInstanceClasses returns the instance classes available for the
+// engine version in the client's region.
+func getOrderableInstanceClasses(rdsClient rdsiface.RDSAPI, engine, engineVersion string) ([]string, error) {
+	orderable, err := describeOrderableOptions(rdsClient, engine, engineVersion, "")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var classes []string
+	for _, option := range orderable {
+		class := aws.StringValue(option.DBInstanceClass)
+		if seen[class] {
+			continue
+		}
+		seen[class] = true
+		classes = append(classes, class)
+	}
+
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("❗ No instance classes are available for the %s engine in this region", engine)
+	}
+
+	return classes, nil
+}
+
+// validateInstanceOptions checks the options against the combinations RDS
+// offers for the engine version in the client's region, so that unsupported
+// choices are reported before anything is created.
+func validateInstanceOptions(ux logger.UX, rdsClient rdsiface.RDSAPI, engine Engine, engineVersion string, options InstanceOptions) error {
+	logger.LogSlack(ux, "🔄 Validating RDS instance options...")
+
+	orderable, err := describeOrderableOptions(rdsClient, engine.Name, engineVersion, options.InstanceClass)
+	if err != nil {
+		return err
+	}
+	if len(orderable) == 0 {
+		version := engineVersion
+		if version == "" {
+			version = "(default)"
+		}
+		return fmt.Errorf("❗ Instance class %s is not available for %s %s in this region", options.InstanceClass, engine.Name, version)
+	}
+
+	if engine.Cluster {
+		if aws.BoolValue(options.StorageEncrypted) && !anyOrderable(orderable, func(o *rds.OrderableDBInstanceOption) bool { return aws.BoolValue(o.SupportsStorageEncryption) }) {
+			return fmt.Errorf("❗ Instance class %s does not support storage encryption", options.InstanceClass)
+		}
+
+		logger.LogSlack(ux, "✅ RDS instance options are valid.")
+		return nil
+	}
+
+	var storageOptions []*rds.OrderableDBInstanceOption
+	for _, option := range orderable {
+		if aws.StringValue(option.StorageType) == options.StorageType {
+			storageOptions = append(storageOptions, option)
+		}
+	}
+	if len(storageOptions) == 0 {
+		return fmt.Errorf("❗ Storage type %s is not available with instance class %s", options.StorageType, options.InstanceClass)
+	}
+
+	if !anyOrderable(storageOptions, func(o *rds.OrderableDBInstanceOption) bool {
+		return (o.MinStorageSize == nil || options.AllocatedStorage >= *o.MinStorageSize) && (o.MaxStorageSize == nil || options.AllocatedStorage <= *o.MaxStorageSize)
+	}) {
+		option := storageOptions[0]
+		return fmt.Errorf("❗ %s storage must be between %d and %d GiB, %d GiB was requested", options.StorageType, aws.Int64Value(option.MinStorageSize), aws.Int64Value(option.MaxStorageSize), options.AllocatedStorage)
+	}
+
+	if options.MaxAllocatedStorage > options.AllocatedStorage && !anyOrderable(storageOptions, func(o *rds.OrderableDBInstanceOption) bool { return aws.BoolValue(o.SupportsStorageAutoscaling) }) {
+		return fmt.Errorf("❗ Storage autoscaling is not supported with %s storage on instance class %s", options.StorageType, options.InstanceClass)
+	}
+
+	if aws.BoolValue(options.MultiAZ) && !anyOrderable(storageOptions, func(o *rds.OrderableDBInstanceOption) bool { return aws.BoolValue(o.MultiAZCapable) }) {
+		return fmt.Errorf("❗ Instance class %s cannot be deployed across multiple Availability Zones", options.InstanceClass)
+	}
+
+	if aws.BoolValue(options.StorageEncrypted) && !anyOrderable(storageOptions, func(o *rds.OrderableDBInstanceOption) bool { return aws.BoolValue(o.SupportsStorageEncryption) }) {
+		return fmt.Errorf("❗ Instance class %s does not support storage encryption", options.InstanceClass)
+	}
+
+	logger.LogSlack(ux, "✅ RDS instance options are valid.")
+	return nil
+}
+
+func describeOrderableOptions(rdsClient rdsiface.RDSAPI, engine, engineVersion, instanceClass string) ([]*rds.OrderableDBInstanceOption, error) {
+	input := &rds.DescribeOrderableDBInstanceOptionsInput{
+		Engine: aws.String(engine),
+		Vpc:    aws.Bool(true),
+	}
+	if engineVersion != "" {
+		input.EngineVersion = aws.String(engineVersion)
+	}
+	if instanceClass != "" {
+		input.DBInstanceClass = aws.String(instanceClass)
+	}
+
+	var orderable []*rds.OrderableDBInstanceOption
+	err := rdsClient.DescribeOrderableDBInstanceOptionsPages(input, func(page *rds.DescribeOrderableDBInstanceOptionsOutput, lastPage bool) bool {
+		orderable = append(orderable, page.OrderableDBInstanceOptions...)
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return nil, aerr
+		}
+		return nil, err
+	}
+
+	return orderable, nil
+}
+
+func anyOrderable(options []*rds.OrderableDBInstanceOption, match func(*rds.OrderableDBInstanceOption) bool) bool {
+	for _, option := range options {
+		if match(option) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,62 +3,284 @@ package awss3
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
-	"time"
-
-	"github.com/aws/aws-sdk-go/aws/session"
-	ctoai "github.com/cto-ai/sdk-go"
 
+	"git.cto.ai/provision/internal/awsclients"
 	"git.cto.ai/provision/internal/logger"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 )
 
-func EBS3Setup(ux *ctoai.Ux, awsSess *session.Session, unzippedRepo, awsRegion string) (string, error) {
-	s3Client := s3.New(awsSess, aws.NewConfig().WithRegion(awsRegion))
-	s3UploaderClient := s3manager.NewUploader(awsSess)
+// EBS3Setup uploads the bundle of unzippedRepo to the account's artifact bucket
+// under <appName>/<versionLabel>.zip and returns the bucket name and key.
+func EBS3Setup(ux logger.UX, clients awsclients.Clients, unzippedRepo, appName, versionLabel, awsRegion string) (string, string, error) {
+	bucketName, _, err := EnsureArtifactBucket(ux, clients, awsRegion)
+	if err != nil {
+		return bucketName, "", err
+	}
+
+	bundleKey := BundleKey(appName, versionLabel)
 
-	bucketName, err := createBucket(ux, s3Client, unzippedRepo, 0)
+	err = uploadZip(ux, clients.Uploader, awsRegion, bucketName, bundleKey, fmt.Sprintf("%s.zip", unzippedRepo))
 	if err != nil {
-		return bucketName, err
+		return bucketName, bundleKey, err
 	}
 
-	err = uploadZip(ux, s3UploaderClient, awsRegion, bucketName, unzippedRepo)
+	return bucketName, bundleKey, nil
+}
+
+// ArtifactBucketName returns the name of the bucket that holds every bundle
+// deployed from the caller's account in awsRegion.
+func ArtifactBucketName(stsClient stsiface.STSAPI, awsRegion string) (string, error) {
+	result, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
 	if err != nil {
-		return bucketName, err
+		if aerr, ok := err.(awserr.Error); ok {
+			return "", aerr
+		}
+		return "", err
 	}
 
-	return bucketName, nil
+	return fmt.Sprintf("beanstalk-artifacts-%s-%s", *result.Account, awsRegion), nil
 }
 
-func createBucket(ux *ctoai.Ux, svc *s3.S3, unzippedRepoName string, retries int) (string, error) {
-	time := time.Now()
-	bucketName := fmt.Sprintf("%s-%v", strings.ToLower(unzippedRepoName), time.Format("20060102150405"))
+// EnsureArtifactBucket creates the account's artifact bucket in awsRegion if
+// it does not exist yet. It returns the bucket name and whether it was created.
+func EnsureArtifactBucket(ux logger.UX, clients awsclients.Clients, awsRegion string) (string, bool, error) {
+	bucketName, err := ArtifactBucketName(clients.STS, awsRegion)
+	if err != nil {
+		return "", false, err
+	}
+
+	created, err := ensureBucket(ux, clients.S3, bucketName, awsRegion)
+	if err != nil {
+		return bucketName, created, err
+	}
+
+	err = verifyBucketRegion(clients.S3, bucketName, awsRegion)
+	if err != nil {
+		return bucketName, created, err
+	}
+
+	return bucketName, created, nil
+}
+
+// BundleKey returns the S3 key of the bundle for an application version.
+func BundleKey(appName, versionLabel string) string {
+	return fmt.Sprintf("%s/%s.zip", appName, versionLabel)
+}
+
+// ensureBucket creates bucketName in awsRegion unless it already exists and is
+// owned by the caller, and reports whether it was created.
+func ensureBucket(ux logger.UX, svc s3iface.S3API, bucketName, awsRegion string) (bool, error) {
+	_, err := svc.HeadBucket(&s3.HeadBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err == nil {
+		logger.LogSlack(ux, fmt.Sprintf("ℹ️  Using existing S3 bucket %s.", bucketName))
+		return false, nil
+	}
+
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "NotFound" {
+		return false, fmt.Errorf("❗ Unable to use S3 bucket %s: %v", bucketName, err)
+	}
+
 	logger.LogSlack(ux, "🔄 Creating S3 bucket...")
 
 	input := &s3.CreateBucketInput{
 		Bucket: aws.String(bucketName),
 	}
 
-	_, err := svc.CreateBucket(input)
+	// us-east-1 is the default location and rejects an explicit constraint.
+	if awsRegion != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(awsRegion),
+		}
+	}
+
+	_, err = svc.CreateBucket(input)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
-			return "", aerr
+			if aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou {
+				return false, nil
+			}
+			return false, aerr
 		}
-		return "", err
+		return false, err
 	}
 
 	logger.LogSlack(ux, "✅ S3 bucket created.")
-	return bucketName, err
+	return true, nil
 }
 
-func uploadZip(ux *ctoai.Ux, svc *s3manager.Uploader, awsRegion, bucketName, targetFile string) error {
-	logger.LogSlack(ux, "🔄 Uploading repository files to S3 bucket...")
+// verifyBucketRegion returns an error unless bucketName lives in awsRegion.
+func verifyBucketRegion(svc s3iface.S3API, bucketName, awsRegion string) error {
+	result, err := svc.GetBucketLocation(&s3.GetBucketLocationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	bucketRegion := s3.NormalizeBucketLocation(aws.StringValue(result.LocationConstraint))
+	if bucketRegion != awsRegion {
+		return fmt.Errorf("❗ S3 bucket %s is in %s, not %s", bucketName, bucketRegion, awsRegion)
+	}
+
+	return nil
+}
+
+// DeleteBundle removes the bundle uploaded by EBS3Setup.
+func DeleteBundle(ux logger.UX, svc s3iface.S3API, bucketName, key string) error {
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Deleting s3://%s/%s...", bucketName, key))
+
+	_, err := svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	logger.LogSlack(ux, "✅ Bundle deleted.")
+	return nil
+}
+
+// DeleteBucketIfEmpty deletes bucketName unless it still holds objects. The
+// artifact bucket is shared by every application deployed in the region, so
+// it is only removed once nothing else uses it.
+func DeleteBucketIfEmpty(ux logger.UX, svc s3iface.S3API, bucketName string) error {
+	result, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucketName),
+		MaxKeys: aws.Int64(1),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	if len(result.Contents) > 0 {
+		logger.LogSlack(ux, fmt.Sprintf("ℹ️  Keeping S3 bucket %s, which holds other objects.", bucketName))
+		return nil
+	}
+
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Deleting S3 bucket %s...", bucketName))
+
+	_, err = svc.DeleteBucket(&s3.DeleteBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	logger.LogSlack(ux, "✅ S3 bucket deleted.")
+	return nil
+}
+
+// BucketExists reports whether bucketName exists and is owned by the caller.
+func BucketExists(svc s3iface.S3API, bucketName string) (bool, error) {
+	_, err := svc.HeadBucket(&s3.HeadBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == "NotFound" {
+				return false, nil
+			}
+			return false, aerr
+		}
+		return false, err
+	}
 
-	filename := fmt.Sprintf("%s.zip", targetFile)
+	return true, nil
+}
+
+// ListObjects returns the keys in bucketName that start with prefix.
+func ListObjects(svc s3iface.S3API, bucketName, prefix string) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	}
+
+	var keys []string
+	err := svc.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return nil, aerr
+		}
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// maxDeleteObjects is the most keys a single DeleteObjects call accepts.
+const maxDeleteObjects = 1000
+
+// DeleteObjects removes keys from bucketName.
+func DeleteObjects(ux logger.UX, svc s3iface.S3API, bucketName string, keys []string) error {
+	logger.LogSlack(ux, fmt.Sprintf("🔄 Deleting %d objects from S3 bucket %s...", len(keys), bucketName))
+
+	for start := 0; start < len(keys); start += maxDeleteObjects {
+		end := start + maxDeleteObjects
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var objects []*s3.ObjectIdentifier
+		for _, key := range keys[start:end] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		result, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(bucketName),
+			Delete: &s3.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				return aerr
+			}
+			return err
+		}
+
+		// DeleteObjects succeeds even when some of the keys were not
+		// deleted, and reports those separately.
+		if len(result.Errors) > 0 {
+			failed := result.Errors[0]
+			return fmt.Errorf("❗ Unable to delete s3://%s/%s and %d other objects: %s", bucketName, aws.StringValue(failed.Key), len(result.Errors)-1, aws.StringValue(failed.Message))
+		}
+	}
+
+	logger.LogSlack(ux, "✅ S3 objects deleted.")
+	return nil
+}
+
+func uploadZip(ux logger.UX, svc s3manageriface.UploaderAPI, awsRegion, bucketName, key, filename string) error {
+	logger.LogSlack(ux, "🔄 Uploading repository files to S3 bucket...")
 
 	file, err := os.Open(filename)
 	if err != nil {
@@ -68,7 +290,7 @@ func uploadZip(ux *ctoai.Ux, svc *s3manager.Uploader, awsRegion, bucketName, tar
 
 	_, err = svc.Upload(&s3manager.UploadInput{
 		Bucket: aws.String(strings.ToLower(bucketName)),
-		Key:    aws.String(filepath.Base(filename)),
+		Key:    aws.String(key),
 		Body:   file,
 	})
 	if err != nil {
@@ -0,0 +1,148 @@
+package awss3
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"git.cto.ai/provision/internal/fakeaws"
+	"git.cto.ai/provision/internal/fakeops"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// recordingS3 records the buckets created through it and can answer
+// GetBucketLocation with an empty location constraint, as S3 does for some
+// us-east-1 buckets instead of leaving it out.
+type recordingS3 struct {
+	*fakeaws.S3
+	created       []*s3.CreateBucketInput
+	emptyLocation bool
+}
+
+func (r *recordingS3) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	r.created = append(r.created, input)
+	return r.S3.CreateBucket(input)
+}
+
+func (r *recordingS3) GetBucketLocation(input *s3.GetBucketLocationInput) (*s3.GetBucketLocationOutput, error) {
+	output, err := r.S3.GetBucketLocation(input)
+	if err == nil && r.emptyLocation && output.LocationConstraint == nil {
+		output.LocationConstraint = aws.String("")
+	}
+	return output, err
+}
+
+func TestEnsureArtifactBucketRegions(t *testing.T) {
+	tests := []struct {
+		name   string
+		region string
+		// existing is the location constraint of a bucket that already
+		// exists under the artifact bucket's name, if any.
+		existing      *string
+		emptyLocation bool
+		wantCreated   bool
+		// wantConstraint is the location constraint the bucket is created
+		// with, nil when none may be sent.
+		wantConstraint *string
+		wantErr        string
+	}{
+		{
+			name:        "us-east-1 sends no location constraint",
+			region:      "us-east-1",
+			wantCreated: true,
+		},
+		{
+			name:          "us-east-1 with an empty location",
+			region:        "us-east-1",
+			emptyLocation: true,
+			wantCreated:   true,
+		},
+		{
+			name:           "eu-west-1",
+			region:         "eu-west-1",
+			wantCreated:    true,
+			wantConstraint: aws.String("eu-west-1"),
+		},
+		{
+			name:     "existing eu-west-1 bucket",
+			region:   "eu-west-1",
+			existing: aws.String("eu-west-1"),
+		},
+		{
+			name:     "existing bucket with the legacy EU location",
+			region:   "eu-west-1",
+			existing: aws.String("EU"),
+		},
+		{
+			name:     "existing us-east-1 bucket",
+			region:   "us-east-1",
+			existing: aws.String(""),
+		},
+		{
+			name:     "existing bucket in another region",
+			region:   "eu-central-1",
+			existing: aws.String("EU"),
+			wantErr:  "is in eu-west-1, not eu-central-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeaws.New(tt.region)
+			clients := fake.Clients()
+			bucketName := fmt.Sprintf("beanstalk-artifacts-%s-%s", fakeaws.AccountID, tt.region)
+
+			if tt.existing != nil {
+				input := &s3.CreateBucketInput{Bucket: aws.String(bucketName)}
+				if *tt.existing != "" {
+					input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: tt.existing}
+				}
+				_, err := fake.S3.CreateBucket(input)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			recorder := &recordingS3{S3: fake.S3, emptyLocation: tt.emptyLocation}
+			clients.S3 = recorder
+
+			_, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+			name, created, err := EnsureArtifactBucket(ux, clients, tt.region)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("EnsureArtifactBucket() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if name != bucketName {
+				t.Errorf("bucket = %s, want %s", name, bucketName)
+			}
+			if created != tt.wantCreated {
+				t.Errorf("created = %v, want %v", created, tt.wantCreated)
+			}
+
+			if !tt.wantCreated {
+				if len(recorder.created) != 0 {
+					t.Errorf("an existing bucket was created again")
+				}
+				return
+			}
+			if len(recorder.created) != 1 {
+				t.Fatalf("%d buckets were created, want 1", len(recorder.created))
+			}
+
+			configuration := recorder.created[0].CreateBucketConfiguration
+			switch {
+			case tt.wantConstraint == nil && configuration != nil:
+				t.Errorf("bucket was created with location constraint %s, want none", aws.StringValue(configuration.LocationConstraint))
+			case tt.wantConstraint != nil && (configuration == nil || aws.StringValue(configuration.LocationConstraint) != *tt.wantConstraint):
+				t.Errorf("bucket was not created with location constraint %s", *tt.wantConstraint)
+			}
+		})
+	}
+}
@@ -1,19 +1,58 @@
 package awsvpc
 
 import (
+	"fmt"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// Tags set on the ingress rules this package creates, so that they can be told
+// apart from rules added by hand.
+const (
+	ManagedByTagKey   = "managed-by"
+	ManagedByTagValue = "beanstalk"
+	SourceGroupTagKey = "beanstalk:source-security-group"
 )
 
-func AddEBSGToRDSSG(ec2Client *ec2.EC2, ebSG, rdsSG string) error {
+// ebSecurityGroupLogicalID is the CloudFormation logical ID Elastic Beanstalk
+// gives the security group of an environment's instances.
+const ebSecurityGroupLogicalID = "AWSEBSecurityGroup"
+
+// SecurityGroupNotFoundError is returned when the instance security group of an
+// Elastic Beanstalk environment does not exist.
+type SecurityGroupNotFoundError struct {
+	EnvName string
+}
+
+func (e *SecurityGroupNotFoundError) Error() string {
+	return fmt.Sprintf("❗ No security group was found for Elastic Beanstalk environment %s", e.EnvName)
+}
+
+// AddEBSGToRDSSG allows ebSG to reach port of rdsSG. The rule is tagged so that
+// RevokeEBSGFromRDSSG can remove it, and nothing is changed if ebSG can already
+// reach the port.
+func AddEBSGToRDSSG(ec2Client ec2iface.EC2API, ebSG, rdsSG string, port int64) error {
+	rules, err := describeIngressRules(ec2Client, rdsSG)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if allowsGroupPort(rule, ebSG, port) {
+			return nil
+		}
+	}
+
 	input := &ec2.AuthorizeSecurityGroupIngressInput{
 		GroupId: aws.String(rdsSG),
 		IpPermissions: []*ec2.IpPermission{
 			{
-				FromPort:   aws.Int64(5432),
+				FromPort:   aws.Int64(port),
 				IpProtocol: aws.String("tcp"),
-				ToPort:     aws.Int64(5432),
+				ToPort:     aws.Int64(port),
 				UserIdGroupPairs: []*ec2.UserIdGroupPair{
 					{
 						GroupId: aws.String(ebSG),
@@ -21,9 +60,60 @@ func AddEBSGToRDSSG(ec2Client *ec2.EC2, ebSG, rdsSG string) error {
 				},
 			},
 		},
+		TagSpecifications: []*ec2.TagSpecification{
+			{
+				ResourceType: aws.String(ec2.ResourceTypeSecurityGroupRule),
+				Tags: []*ec2.Tag{
+					{Key: aws.String(ManagedByTagKey), Value: aws.String(ManagedByTagValue)},
+					{Key: aws.String(SourceGroupTagKey), Value: aws.String(ebSG)},
+				},
+			},
+		},
+	}
+
+	_, err = ec2Client.AuthorizeSecurityGroupIngress(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == "InvalidPermission.Duplicate" {
+				return nil
+			}
+			return aerr
+		}
+		return err
+	}
+
+	return nil
+}
+
+// RevokeEBSGFromRDSSG removes the ingress rules of rdsSG that AddEBSGToRDSSG
+// created for ebSG. Rules added by other means are left alone.
+func RevokeEBSGFromRDSSG(ec2Client ec2iface.EC2API, ebSG, rdsSG string) error {
+	rules, err := describeIngressRules(ec2Client, rdsSG,
+		&ec2.Filter{
+			Name:   aws.String("tag:" + ManagedByTagKey),
+			Values: []*string{aws.String(ManagedByTagValue)},
+		},
+		&ec2.Filter{
+			Name:   aws.String("tag:" + SourceGroupTagKey),
+			Values: []*string{aws.String(ebSG)},
+		},
+	)
+	if err != nil {
+		return err
 	}
 
-	_, err := ec2Client.AuthorizeSecurityGroupIngress(input)
+	var ruleIDs []*string
+	for _, rule := range rules {
+		ruleIDs = append(ruleIDs, rule.SecurityGroupRuleId)
+	}
+	if len(ruleIDs) == 0 {
+		return nil
+	}
+
+	_, err = ec2Client.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+		GroupId:              aws.String(rdsSG),
+		SecurityGroupRuleIds: ruleIDs,
+	})
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			return aerr
@@ -34,7 +124,10 @@ func AddEBSGToRDSSG(ec2Client *ec2.EC2, ebSG, rdsSG string) error {
 	return nil
 }
 
-func DescribeEBEnvSecurityGroupID(ec2Client *ec2.EC2, envName string) (string, error) {
+// DescribeEBEnvSecurityGroupID returns the ID of the security group attached
+// to the instances of the environment envName. A *SecurityGroupNotFoundError
+// is returned when there is none.
+func DescribeEBEnvSecurityGroupID(ec2Client ec2iface.EC2API, envName string) (string, error) {
 	input := &ec2.DescribeSecurityGroupsInput{
 		Filters: []*ec2.Filter{
 			{
@@ -43,6 +136,12 @@ func DescribeEBEnvSecurityGroupID(ec2Client *ec2.EC2, envName string) (string, e
 					aws.String(envName),
 				},
 			},
+			{
+				Name: aws.String("tag:aws:cloudformation:logical-id"),
+				Values: []*string{
+					aws.String(ebSecurityGroupLogicalID),
+				},
+			},
 		},
 	}
 
@@ -54,14 +153,73 @@ func DescribeEBEnvSecurityGroupID(ec2Client *ec2.EC2, envName string) (string, e
 		return "", err
 	}
 
-	var envSecurityGroupID string
+	if len(result.SecurityGroups) == 0 {
+		return "", &SecurityGroupNotFoundError{EnvName: envName}
+	}
+
+	return aws.StringValue(result.SecurityGroups[0].GroupId), nil
+}
 
-	for _, k := range result.SecurityGroups {
-		if *k.Description == "SecurityGroup for ElasticBeanstalk environment." {
-			envSecurityGroupID = *k.GroupId
-			continue
+// ManagedIngressRules returns the ingress rules AddEBSGToRDSSG created for
+// ebSG, in whichever security groups they were added to.
+func ManagedIngressRules(ec2Client ec2iface.EC2API, ebSG string) ([]*ec2.SecurityGroupRule, error) {
+	return describeRules(ec2Client,
+		&ec2.Filter{
+			Name:   aws.String("tag:" + ManagedByTagKey),
+			Values: []*string{aws.String(ManagedByTagValue)},
+		},
+		&ec2.Filter{
+			Name:   aws.String("tag:" + SourceGroupTagKey),
+			Values: []*string{aws.String(ebSG)},
+		},
+	)
+}
+
+func describeIngressRules(ec2Client ec2iface.EC2API, groupID string, filters ...*ec2.Filter) ([]*ec2.SecurityGroupRule, error) {
+	return describeRules(ec2Client, append([]*ec2.Filter{
+		{
+			Name:   aws.String("group-id"),
+			Values: []*string{aws.String(groupID)},
+		},
+	}, filters...)...)
+}
+
+// describeRules returns the ingress rules that match filters.
+func describeRules(ec2Client ec2iface.EC2API, filters ...*ec2.Filter) ([]*ec2.SecurityGroupRule, error) {
+	input := &ec2.DescribeSecurityGroupRulesInput{
+		Filters: filters,
+	}
+
+	var rules []*ec2.SecurityGroupRule
+	err := ec2Client.DescribeSecurityGroupRulesPages(input, func(page *ec2.DescribeSecurityGroupRulesOutput, lastPage bool) bool {
+		for _, rule := range page.SecurityGroupRules {
+			if !aws.BoolValue(rule.IsEgress) {
+				rules = append(rules, rule)
+			}
 		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return nil, aerr
+		}
+		return nil, err
 	}
 
-	return envSecurityGroupID, nil
+	return rules, nil
+}
+
+// allowsGroupPort reports whether rule lets groupID reach port over TCP.
+func allowsGroupPort(rule *ec2.SecurityGroupRule, groupID string, port int64) bool {
+	if rule.ReferencedGroupInfo == nil || aws.StringValue(rule.ReferencedGroupInfo.GroupId) != groupID {
+		return false
+	}
+
+	switch aws.StringValue(rule.IpProtocol) {
+	case "-1":
+		return true
+	case "tcp", "6":
+		return aws.Int64Value(rule.FromPort) <= port && port <= aws.Int64Value(rule.ToPort)
+	}
+	return false
 }
@@ -0,0 +1,205 @@
+package awsvpc
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// ErrNoDefaultVPC is returned by DefaultVPCID when the region has no default VPC.
+var ErrNoDefaultVPC = errors.New("❗ The region has no default VPC")
+
+// DefaultVPCID returns the ID of the region's default VPC, which Elastic
+// Beanstalk environments are launched into unless configured otherwise.
+func DefaultVPCID(ec2Client ec2iface.EC2API) (string, error) {
+	result, err := ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("isDefault"),
+				Values: []*string{aws.String("true")},
+			},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return "", aerr
+		}
+		return "", err
+	}
+
+	if len(result.Vpcs) == 0 {
+		return "", ErrNoDefaultVPC
+	}
+
+	return aws.StringValue(result.Vpcs[0].VpcId), nil
+}
+
+// PrivateSubnets returns the subnets of vpcID without a route to an internet
+// gateway. When the VPC has no such subnets, as is the case for default VPCs,
+// every subnet is returned and private is false.
+func PrivateSubnets(ec2Client ec2iface.EC2API, vpcID string) (privateSubnets []*ec2.Subnet, private bool, err error) {
+	vpcFilter := []*ec2.Filter{
+		{
+			Name:   aws.String("vpc-id"),
+			Values: []*string{aws.String(vpcID)},
+		},
+	}
+
+	var subnets []*ec2.Subnet
+	err = ec2Client.DescribeSubnetsPages(&ec2.DescribeSubnetsInput{Filters: vpcFilter}, func(page *ec2.DescribeSubnetsOutput, lastPage bool) bool {
+		subnets = append(subnets, page.Subnets...)
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return nil, false, aerr
+		}
+		return nil, false, err
+	}
+
+	var routeTables []*ec2.RouteTable
+	err = ec2Client.DescribeRouteTablesPages(&ec2.DescribeRouteTablesInput{Filters: vpcFilter}, func(page *ec2.DescribeRouteTablesOutput, lastPage bool) bool {
+		routeTables = append(routeTables, page.RouteTables...)
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return nil, false, aerr
+		}
+		return nil, false, err
+	}
+
+	// Subnets without an explicit association use the VPC's main route table.
+	publicRouteTables := map[string]bool{}
+	subnetRouteTables := map[string]string{}
+	var mainRouteTable string
+	for _, routeTable := range routeTables {
+		routeTableID := aws.StringValue(routeTable.RouteTableId)
+		for _, route := range routeTable.Routes {
+			if strings.HasPrefix(aws.StringValue(route.GatewayId), "igw-") {
+				publicRouteTables[routeTableID] = true
+			}
+		}
+		for _, association := range routeTable.Associations {
+			if aws.BoolValue(association.Main) {
+				mainRouteTable = routeTableID
+			}
+			if association.SubnetId != nil {
+				subnetRouteTables[aws.StringValue(association.SubnetId)] = routeTableID
+			}
+		}
+	}
+
+	for _, subnet := range subnets {
+		routeTableID, ok := subnetRouteTables[aws.StringValue(subnet.SubnetId)]
+		if !ok {
+			routeTableID = mainRouteTable
+		}
+		if !publicRouteTables[routeTableID] {
+			privateSubnets = append(privateSubnets, subnet)
+		}
+	}
+
+	if len(privateSubnets) > 0 {
+		return privateSubnets, true, nil
+	}
+	return subnets, false, nil
+}
+
+// EnsureSecurityGroup returns the ID of the security group name in vpcID,
+// creating it without any ingress rules if it does not exist yet.
+func EnsureSecurityGroup(ec2Client ec2iface.EC2API, vpcID, name, description string) (string, error) {
+	groupID, err := FindSecurityGroup(ec2Client, vpcID, name)
+	if err != nil || groupID != "" {
+		return groupID, err
+	}
+
+	created, err := ec2Client.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+		Description: aws.String(description),
+		GroupName:   aws.String(name),
+		VpcId:       aws.String(vpcID),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return "", aerr
+		}
+		return "", err
+	}
+
+	return aws.StringValue(created.GroupId), nil
+}
+
+// FindSecurityGroup returns the ID of the security group name in vpcID, or an
+// empty string if there is none.
+func FindSecurityGroup(ec2Client ec2iface.EC2API, vpcID, name string) (string, error) {
+	result, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{aws.String(vpcID)},
+			},
+			{
+				Name:   aws.String("group-name"),
+				Values: []*string{aws.String(name)},
+			},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return "", aerr
+		}
+		return "", err
+	}
+
+	if len(result.SecurityGroups) == 0 {
+		return "", nil
+	}
+
+	return aws.StringValue(result.SecurityGroups[0].GroupId), nil
+}
+
+// DescribeSecurityGroupName returns the name of the security group groupID,
+// or an empty string if it does not exist.
+func DescribeSecurityGroupName(ec2Client ec2iface.EC2API, groupID string) (string, error) {
+	result, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		GroupIds: []*string{aws.String(groupID)},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == "InvalidGroup.NotFound" {
+				return "", nil
+			}
+			return "", aerr
+		}
+		return "", err
+	}
+
+	if len(result.SecurityGroups) == 0 {
+		return "", nil
+	}
+
+	return aws.StringValue(result.SecurityGroups[0].GroupName), nil
+}
+
+// DeleteSecurityGroup deletes the security group groupID. A group that is
+// already gone is not an error.
+func DeleteSecurityGroup(ec2Client ec2iface.EC2API, groupID string) error {
+	_, err := ec2Client.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{
+		GroupId: aws.String(groupID),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == "InvalidGroup.NotFound" {
+				return nil
+			}
+			return aerr
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"git.cto.ai/provision/internal/awsrds"
+	"git.cto.ai/provision/internal/files"
+	"git.cto.ai/provision/internal/plan"
+	"git.cto.ai/provision/internal/platform"
+	"git.cto.ai/provision/internal/setup"
+	"git.cto.ai/provision/internal/state"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultPath is the config file read when BEANSTALK_CONFIG is not set.
+const DefaultPath = "beanstalk.yaml"
+
+// Config is the declarative description of a deploy. Every value is optional;
+// anything left out is prompted for.
+type Config struct {
+	Github setup.GithubRepoDetails `yaml:"github"`
+	AWS    setup.AWSDetails        `yaml:"aws"`
+	EB     setup.EBDetails         `yaml:"elasticbeanstalk"`
+	RDS    awsrds.RDSDetails       `yaml:"rds"`
+	Limits files.ExtractLimits     `yaml:"extract_limits"`
+	State  state.Options           `yaml:"state"`
+	Plan   plan.Options            `yaml:"plan"`
+}
+
+// KeyError is a validation error for a single config key.
+type KeyError struct {
+	Key    string
+	Reason string
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("❗ Invalid config value for %s: %s", e.Key, e.Reason)
+}
+
+var (
+	rdsIdentifierRegexp     = regexp.MustCompile(`^[a-zA-Z]([a-zA-Z0-9]|-[a-zA-Z0-9])*$`)
+	maintenanceWindowRegexp = regexp.MustCompile(`^(mon|tue|wed|thu|fri|sat|sun):([01]\d|2[0-3]):[0-5]\d-(mon|tue|wed|thu|fri|sat|sun):([01]\d|2[0-3]):[0-5]\d$`)
+)
+
+// Path returns the config file location, taken from BEANSTALK_CONFIG when set.
+func Path() string {
+	if path := os.Getenv("BEANSTALK_CONFIG"); path != "" {
+		return path
+	}
+	return DefaultPath
+}
+
+// Load reads and validates the config file at path. A missing file at the
+// default path yields an empty Config so the Op stays fully interactive.
+func Load(path string) (Config, error) {
+	cfg := Config{}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && path == DefaultPath {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+
+	err = yaml.UnmarshalStrict(content, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("❗ Unable to parse config file %s: %v", path, err)
+	}
+
+	// A public repository takes no token, so GITHUB_TOKEN is only used when
+	// the repository may be private.
+	if cfg.Github.Token == "" && (cfg.Github.Private == nil || *cfg.Github.Private) {
+		cfg.Github.Token = os.Getenv("GITHUB_TOKEN")
+	}
+	if cfg.RDS.Password == "" && (cfg.RDS.GeneratePassword == nil || !*cfg.RDS.GeneratePassword) {
+		cfg.RDS.Password = os.Getenv("RDS_DB_PASSWORD")
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks the values that were provided. Missing values are not an
+// error since they are prompted for.
+func (c Config) Validate() error {
+	if c.Github.Platform != "" && !contains(platform.Names(), c.Github.Platform) {
+		return &KeyError{"github.platform", fmt.Sprintf("%q must be one of %s", c.Github.Platform, strings.Join(platform.Names(), ", "))}
+	}
+
+	if c.Github.Private != nil && !*c.Github.Private && c.Github.Token != "" {
+		return &KeyError{"github.token", "a token cannot be set for a public repository"}
+	}
+
+	if c.AWS.Region != "" && !contains(setup.AWSRegions, c.AWS.Region) {
+		return &KeyError{"aws.region", fmt.Sprintf("%q is not a supported region", c.AWS.Region)}
+	}
+
+	if c.EB.Action != "" && !contains(setup.EBActionChoices, c.EB.Action) {
+		return &KeyError{"elasticbeanstalk.action", fmt.Sprintf("%q must be one of %s", c.EB.Action, strings.Join(setup.EBActionChoices, ", "))}
+	}
+
+	if c.EB.VersionLabel != "" && c.EB.Action != "Rollback" {
+		return &KeyError{"elasticbeanstalk.version", "is only used by the Rollback action"}
+	}
+
+	if c.EB.EnvName != "" && (len(c.EB.EnvName) < 4 || len(c.EB.EnvName) > 40) {
+		return &KeyError{"elasticbeanstalk.environment", "must be between 4 and 40 characters long"}
+	}
+
+	if c.RDS.DBName != "" && (len(c.RDS.DBName) > 63 || !rdsIdentifierRegexp.MatchString(c.RDS.DBName)) {
+		return &KeyError{"rds.name", fmt.Sprintf("%q must start with a letter, contain only letters, digits and single hyphens, and be at most 63 characters long", c.RDS.DBName)}
+	}
+
+	if c.RDS.AllowPublicSubnets && c.RDS.SubnetGroup != "" {
+		return &KeyError{"rds.allow_public_subnets", "is only used when rds.subnet_group is not set"}
+	}
+
+	if c.RDS.Platform != "" && !contains(awsrds.PlatformChoices, c.RDS.Platform) {
+		return &KeyError{"rds.platform", fmt.Sprintf("%q must be one of %s", c.RDS.Platform, strings.Join(awsrds.PlatformChoices, ", "))}
+	}
+
+	if c.RDS.Port != "" {
+		if port, err := strconv.Atoi(c.RDS.Port); err != nil || port < 1150 || port > 65535 {
+			return &KeyError{"rds.port", fmt.Sprintf("%q must be a number between 1150 and 65535", c.RDS.Port)}
+		}
+	}
+
+	if c.RDS.CredentialStore != "" && !contains(awsrds.CredentialStores, c.RDS.CredentialStore) {
+		return &KeyError{"rds.credential_store", fmt.Sprintf("%q must be one of %s", c.RDS.CredentialStore, strings.Join(awsrds.CredentialStores, ", "))}
+	}
+
+	if c.RDS.Password != "" && c.RDS.GeneratePassword != nil && *c.RDS.GeneratePassword {
+		return &KeyError{"rds.generate_password", "a password was given but rds.generate_password is true"}
+	}
+
+	if c.RDS.StorageType != "" && !contains(awsrds.StorageTypes, c.RDS.StorageType) {
+		return &KeyError{"rds.storage_type", fmt.Sprintf("%q must be one of %s", c.RDS.StorageType, strings.Join(awsrds.StorageTypes, ", "))}
+	}
+
+	if c.RDS.AllocatedStorage < 0 {
+		return &KeyError{"rds.allocated_storage", "must not be negative"}
+	}
+
+	if c.RDS.MaxAllocatedStorage != 0 && c.RDS.MaxAllocatedStorage <= c.RDS.AllocatedStorage {
+		return &KeyError{"rds.max_allocated_storage", "must be larger than rds.allocated_storage"}
+	}
+
+	if c.RDS.BackupRetentionDays != nil && (*c.RDS.BackupRetentionDays < 0 || *c.RDS.BackupRetentionDays > 35) {
+		return &KeyError{"rds.backup_retention_days", "must be between 0 and 35"}
+	}
+
+	if c.RDS.MaintenanceWindow != "" && !maintenanceWindowRegexp.MatchString(c.RDS.MaintenanceWindow) {
+		return &KeyError{"rds.maintenance_window", fmt.Sprintf("%q must look like sun:05:00-sun:06:00", c.RDS.MaintenanceWindow)}
+	}
+
+	if c.RDS.KMSKeyID != "" && c.RDS.StorageEncrypted != nil && !*c.RDS.StorageEncrypted {
+		return &KeyError{"rds.kms_key_id", "a KMS key was given but rds.storage_encrypted is false"}
+	}
+
+	if engine, ok := awsrds.LookupEngine(c.RDS.Platform); ok && engine.Cluster && c.RDS.MultiAZ != nil && *c.RDS.MultiAZ {
+		return &KeyError{"rds.multi_az", fmt.Sprintf("is not supported for %s, whose storage is already replicated across Availability Zones", engine.Name)}
+	}
+
+	if c.RDS.Enabled != nil && !*c.RDS.Enabled && (c.RDS.DBName != "" || c.RDS.Username != "" || c.RDS.Platform != "" || c.RDS.EngineVersion != "" || c.RDS.Port != "") {
+		return &KeyError{"rds.enabled", "RDS settings were given but rds.enabled is false"}
+	}
+
+	if c.Limits.MaxBytes < 0 {
+		return &KeyError{"extract_limits.max_bytes", "must not be negative"}
+	}
+
+	if c.Limits.MaxFiles < 0 {
+		return &KeyError{"extract_limits.max_files", "must not be negative"}
+	}
+
+	if c.State.Backend != "" && !contains(state.Backends, c.State.Backend) {
+		return &KeyError{"state.backend", fmt.Sprintf("%q must be one of %s", c.State.Backend, strings.Join(state.Backends, ", "))}
+	}
+
+	if c.State.Path != "" && c.State.Backend != state.BackendLocal {
+		return &KeyError{"state.path", "is only used when state.backend is local"}
+	}
+
+	if c.Plan.Format != "" && !contains(plan.Formats, c.Plan.Format) {
+		return &KeyError{"plan.format", fmt.Sprintf("%q must be one of %s", c.Plan.Format, strings.Join(plan.Formats, ", "))}
+	}
+
+	if c.Plan.Enabled && (c.EB.Action == "Destroy" || c.EB.Action == "Rollback") {
+		return &KeyError{"plan.enabled", "is only supported with the Create New and Update Existing actions"}
+	}
+
+	return nil
+}
+
+func contains(choices []string, value string) bool {
+	for _, choice := range choices {
+		if choice == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeConfig writes content to a config file in a new temporary directory,
+// and returns the directory and the file's path.
+func writeConfig(t *testing.T, content string) (string, string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "config-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "beanstalk.yaml")
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, path
+}
+
+// setenv sets the environment variable key to value, or unsets it when value
+// is empty, and returns a function that restores it.
+func setenv(t *testing.T, key, value string) func() {
+	t.Helper()
+
+	old, had := os.LookupEnv(key)
+	var err error
+	if value == "" {
+		err = os.Unsetenv(key)
+	} else {
+		err = os.Setenv(key, value)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestLoadReportsInvalidKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantKey string
+	}{
+		{name: "valid", content: "github:\n  repo: demo\n  platform: Node\naws:\n  region: us-east-1\nelasticbeanstalk:\n  action: Create New\n  app: demo\n  environment: production\nrds:\n  enabled: true\n  name: demodb\n  platform: postgres\n  port: \"5432\"\n"},
+		{name: "platform", content: "github:\n  platform: Cobol\n", wantKey: "github.platform"},
+		{name: "token of a public repository", content: "github:\n  private: false\n  token: secret\n", wantKey: "github.token"},
+		{name: "region", content: "aws:\n  region: moon-1\n", wantKey: "aws.region"},
+		{name: "action", content: "elasticbeanstalk:\n  action: Explode\n", wantKey: "elasticbeanstalk.action"},
+		{name: "version without rollback", content: "elasticbeanstalk:\n  action: Create New\n  version: v1\n", wantKey: "elasticbeanstalk.version"},
+		{name: "short environment name", content: "elasticbeanstalk:\n  environment: env\n", wantKey: "elasticbeanstalk.environment"},
+		{name: "database name", content: "rds:\n  name: 1demo\n", wantKey: "rds.name"},
+		{name: "public subnets with a subnet group", content: "rds:\n  subnet_group: shared\n  allow_public_subnets: true\n", wantKey: "rds.allow_public_subnets"},
+		{name: "database platform", content: "rds:\n  platform: oracle-9i\n", wantKey: "rds.platform"},
+		{name: "port", content: "rds:\n  port: \"80\"\n", wantKey: "rds.port"},
+		{name: "credential store", content: "rds:\n  credential_store: vault\n", wantKey: "rds.credential_store"},
+		{name: "password with generate_password", content: "rds:\n  password: secret-password\n  generate_password: true\n", wantKey: "rds.generate_password"},
+		{name: "storage type", content: "rds:\n  storage_type: floppy\n", wantKey: "rds.storage_type"},
+		{name: "negative storage", content: "rds:\n  allocated_storage: -1\n", wantKey: "rds.allocated_storage"},
+		{name: "max storage below storage", content: "rds:\n  allocated_storage: 20\n  max_allocated_storage: 20\n", wantKey: "rds.max_allocated_storage"},
+		{name: "backup retention", content: "rds:\n  backup_retention_days: 36\n", wantKey: "rds.backup_retention_days"},
+		{name: "maintenance window", content: "rds:\n  maintenance_window: sunday\n", wantKey: "rds.maintenance_window"},
+		{name: "KMS key without encryption", content: "rds:\n  kms_key_id: key\n  storage_encrypted: false\n", wantKey: "rds.kms_key_id"},
+		{name: "multi-AZ cluster", content: "rds:\n  platform: aurora-postgresql\n  multi_az: true\n", wantKey: "rds.multi_az"},
+		{name: "settings of a disabled database", content: "rds:\n  enabled: false\n  name: demodb\n", wantKey: "rds.enabled"},
+		{name: "negative extract bytes", content: "extract_limits:\n  max_bytes: -1\n", wantKey: "extract_limits.max_bytes"},
+		{name: "negative extract files", content: "extract_limits:\n  max_files: -1\n", wantKey: "extract_limits.max_files"},
+		{name: "state backend", content: "state:\n  backend: floppy\n", wantKey: "state.backend"},
+		{name: "state path without local backend", content: "state:\n  path: /tmp/state\n", wantKey: "state.path"},
+		{name: "plan format", content: "plan:\n  format: yaml\n", wantKey: "plan.format"},
+		{name: "plan with destroy", content: "elasticbeanstalk:\n  action: Destroy\nplan:\n  enabled: true\n", wantKey: "plan.enabled"},
+	}
+
+	defer setenv(t, "GITHUB_TOKEN", "")()
+	defer setenv(t, "RDS_DB_PASSWORD", "")()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, path := writeConfig(t, tt.content)
+			defer os.RemoveAll(dir)
+
+			_, err := Load(path)
+			if tt.wantKey == "" {
+				if err != nil {
+					t.Fatalf("Load() error = %v, want none", err)
+				}
+				return
+			}
+
+			keyErr, ok := err.(*KeyError)
+			if !ok {
+				t.Fatalf("Load() error = %v, want a *KeyError for %s", err, tt.wantKey)
+			}
+			if keyErr.Key != tt.wantKey {
+				t.Errorf("Load() error names %s, want %s: %v", keyErr.Key, tt.wantKey, err)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownKey(t *testing.T) {
+	dir, path := writeConfig(t, "github:\n  repository: demo\n")
+	defer os.RemoveAll(dir)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("Load() error = nil, want one for the unknown key")
+	}
+}
+
+func TestLoadReadsSecretsFromEnvironment(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantToken    string
+		wantPassword string
+	}{
+		{
+			name:         "nothing set",
+			content:      "github:\n  repo: demo\n",
+			wantToken:    "env-token",
+			wantPassword: "env-password",
+		},
+		{
+			name:         "private repository",
+			content:      "github:\n  private: true\n",
+			wantToken:    "env-token",
+			wantPassword: "env-password",
+		},
+		{
+			name:         "public repository",
+			content:      "github:\n  private: false\n",
+			wantToken:    "",
+			wantPassword: "env-password",
+		},
+		{
+			name:         "values in the file",
+			content:      "github:\n  token: file-token\nrds:\n  password: file-password\n",
+			wantToken:    "file-token",
+			wantPassword: "file-password",
+		},
+		{
+			name:         "password entered",
+			content:      "rds:\n  generate_password: false\n",
+			wantToken:    "env-token",
+			wantPassword: "env-password",
+		},
+		{
+			name:         "password generated",
+			content:      "rds:\n  generate_password: true\n",
+			wantToken:    "env-token",
+			wantPassword: "",
+		},
+	}
+
+	defer setenv(t, "GITHUB_TOKEN", "env-token")()
+	defer setenv(t, "RDS_DB_PASSWORD", "env-password")()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, path := writeConfig(t, tt.content)
+			defer os.RemoveAll(dir)
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Github.Token != tt.wantToken {
+				t.Errorf("Load() token = %q, want %q", cfg.Github.Token, tt.wantToken)
+			}
+			if cfg.RDS.Password != tt.wantPassword {
+				t.Errorf("Load() password = %q, want %q", cfg.RDS.Password, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// The Op stays interactive without a config file at the default path,
+	// but a path that was asked for has to exist.
+	cfg, err := Load(DefaultPath)
+	if err != nil || cfg.Github.Repo != "" {
+		t.Errorf("Load(%q) = %+v, %v, want an empty config", DefaultPath, cfg, err)
+	}
+
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Load() of a missing file error = %v, want a not-exist error", err)
+	}
+}
+
+func TestPath(t *testing.T) {
+	defer setenv(t, "BEANSTALK_CONFIG", "")()
+	if got := Path(); got != DefaultPath {
+		t.Errorf("Path() = %q without BEANSTALK_CONFIG, want %q", got, DefaultPath)
+	}
+
+	os.Setenv("BEANSTALK_CONFIG", "ci/beanstalk.yaml")
+	if got := Path(); got != "ci/beanstalk.yaml" {
+		t.Errorf("Path() = %q, want the value of BEANSTALK_CONFIG", got)
+	}
+}
@@ -0,0 +1,495 @@
+package fakeaws
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"git.cto.ai/provision/internal/platform"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk/elasticbeanstalkiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ElasticBeanstalk is a fake Elastic Beanstalk. New environments are Ready and
+// Green immediately, and get an instance security group in the fake EC2.
+type ElasticBeanstalk struct {
+	elasticbeanstalkiface.ElasticBeanstalkAPI
+
+	mu     sync.Mutex
+	region string
+	s3     *S3
+	ec2    *EC2
+
+	// Platforms are the platform versions offered to new environments.
+	Platforms []*elasticbeanstalk.PlatformSummary
+
+	apps     map[string]bool
+	envs     map[string]*fakeEnvironment
+	versions map[string]*elasticbeanstalk.ApplicationVersionDescription
+	events   []*elasticbeanstalk.EventDescription
+}
+
+type fakeEnvironment struct {
+	description *elasticbeanstalk.EnvironmentDescription
+	options     []*elasticbeanstalk.ConfigurationOptionSetting
+}
+
+func newElasticBeanstalk(region string, s3 *S3, ec2 *EC2) *ElasticBeanstalk {
+	eb := &ElasticBeanstalk{
+		region:   region,
+		s3:       s3,
+		ec2:      ec2,
+		apps:     map[string]bool{},
+		envs:     map[string]*fakeEnvironment{},
+		versions: map[string]*elasticbeanstalk.ApplicationVersionDescription{},
+	}
+
+	for _, p := range platform.All() {
+		branch := fmt.Sprintf("%s1 running on 64bit Amazon Linux 2023", p.BranchPrefix)
+		eb.Platforms = append(eb.Platforms, &elasticbeanstalk.PlatformSummary{
+			PlatformArn:                  aws.String(fmt.Sprintf("arn:aws:elasticbeanstalk:%s::platform/%s/1.0.0", region, branch)),
+			PlatformBranchLifecycleState: aws.String("Supported"),
+			PlatformBranchName:           aws.String(branch),
+			PlatformOwner:                aws.String("AWSElasticBeanstalk"),
+			PlatformStatus:               aws.String(elasticbeanstalk.PlatformStatusReady),
+			PlatformVersion:              aws.String("1.0.0"),
+		})
+	}
+
+	return eb
+}
+
+// Environment returns the environment envName, or nil if it does not exist.
+func (eb *ElasticBeanstalk) Environment(envName string) *elasticbeanstalk.EnvironmentDescription {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	env, ok := eb.envs[envName]
+	if !ok {
+		return nil
+	}
+	description := *env.description
+	return &description
+}
+
+// SetEnvironmentStatus changes the status and health of the environment
+// envName, for instance to keep it busy with an earlier operation.
+func (eb *ElasticBeanstalk) SetEnvironmentStatus(envName, status, health, healthStatus string) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	env, ok := eb.envs[envName]
+	if !ok {
+		return
+	}
+	env.description.Status = aws.String(status)
+	env.description.Health = aws.String(health)
+	env.description.HealthStatus = aws.String(healthStatus)
+}
+
+// ApplicationVersion returns the version label of appName, or nil if it does
+// not exist.
+func (eb *ElasticBeanstalk) ApplicationVersion(appName, label string) *elasticbeanstalk.ApplicationVersionDescription {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	return eb.versions[appName+"/"+label]
+}
+
+func (eb *ElasticBeanstalk) CreateApplication(input *elasticbeanstalk.CreateApplicationInput) (*elasticbeanstalk.ApplicationDescriptionMessage, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	name := aws.StringValue(input.ApplicationName)
+	if eb.apps[name] {
+		return nil, newError("InvalidParameterValue", "Application %s already exists.", name)
+	}
+	eb.apps[name] = true
+
+	return &elasticbeanstalk.ApplicationDescriptionMessage{
+		Application: &elasticbeanstalk.ApplicationDescription{ApplicationName: aws.String(name)},
+	}, nil
+}
+
+func (eb *ElasticBeanstalk) DescribeApplications(input *elasticbeanstalk.DescribeApplicationsInput) (*elasticbeanstalk.DescribeApplicationsOutput, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	names := aws.StringValueSlice(input.ApplicationNames)
+
+	output := &elasticbeanstalk.DescribeApplicationsOutput{}
+	for name := range eb.apps {
+		if len(names) > 0 && !contains(names, name) {
+			continue
+		}
+		output.Applications = append(output.Applications, &elasticbeanstalk.ApplicationDescription{ApplicationName: aws.String(name)})
+	}
+	return output, nil
+}
+
+func (eb *ElasticBeanstalk) CreateEnvironment(input *elasticbeanstalk.CreateEnvironmentInput) (*elasticbeanstalk.EnvironmentDescription, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	appName := aws.StringValue(input.ApplicationName)
+	envName := aws.StringValue(input.EnvironmentName)
+	if !eb.apps[appName] {
+		return nil, newError("InvalidParameterValue", "No Application named '%s' found.", appName)
+	}
+	if _, ok := eb.envs[envName]; ok {
+		return nil, newError("InvalidParameterValue", "Environment %s already exists.", envName)
+	}
+
+	description := &elasticbeanstalk.EnvironmentDescription{
+		ApplicationName: aws.String(appName),
+		CNAME:           aws.String(fmt.Sprintf("%s.%s.elasticbeanstalk.com", aws.StringValue(input.CNAMEPrefix), eb.region)),
+		EnvironmentId:   aws.String(fmt.Sprintf("e-%d", len(eb.envs)+1)),
+		EnvironmentName: aws.String(envName),
+		Health:          aws.String(elasticbeanstalk.EnvironmentHealthGreen),
+		HealthStatus:    aws.String(elasticbeanstalk.EnvironmentHealthStatusOk),
+		PlatformArn:     input.PlatformArn,
+		Status:          aws.String(elasticbeanstalk.EnvironmentStatusReady),
+		VersionLabel:    input.VersionLabel,
+	}
+	eb.envs[envName] = &fakeEnvironment{description: description, options: input.OptionSettings}
+
+	eb.ec2.addSecurityGroup(fmt.Sprintf("awseb-%s", envName), "Elastic Beanstalk instances", map[string]string{
+		"elasticbeanstalk:environment-name": envName,
+		"aws:cloudformation:logical-id":     "AWSEBSecurityGroup",
+	})
+
+	eb.addEvent(appName, envName, elasticbeanstalk.EventSeverityInfo, "createEnvironment is starting.")
+	eb.addEvent(appName, envName, elasticbeanstalk.EventSeverityInfo, "Successfully launched environment: "+envName)
+
+	copied := *description
+	return &copied, nil
+}
+
+func (eb *ElasticBeanstalk) DescribeEnvironments(input *elasticbeanstalk.DescribeEnvironmentsInput) (*elasticbeanstalk.EnvironmentDescriptionsMessage, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	names := aws.StringValueSlice(input.EnvironmentNames)
+	output := &elasticbeanstalk.EnvironmentDescriptionsMessage{}
+	for name, env := range eb.envs {
+		if input.ApplicationName != nil && aws.StringValue(env.description.ApplicationName) != aws.StringValue(input.ApplicationName) {
+			continue
+		}
+		if len(names) > 0 && !contains(names, name) {
+			continue
+		}
+		description := *env.description
+		output.Environments = append(output.Environments, &description)
+	}
+	return output, nil
+}
+
+func (eb *ElasticBeanstalk) DescribeEnvironmentHealth(input *elasticbeanstalk.DescribeEnvironmentHealthInput) (*elasticbeanstalk.DescribeEnvironmentHealthOutput, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	env, ok := eb.envs[aws.StringValue(input.EnvironmentName)]
+	if !ok {
+		return nil, newError("InvalidRequestException", "No Environment found for EnvironmentName = '%s'.", aws.StringValue(input.EnvironmentName))
+	}
+
+	return &elasticbeanstalk.DescribeEnvironmentHealthOutput{
+		EnvironmentName: env.description.EnvironmentName,
+		HealthStatus:    env.description.HealthStatus,
+		Status:          env.description.Status,
+	}, nil
+}
+
+func (eb *ElasticBeanstalk) DescribeConfigurationSettings(input *elasticbeanstalk.DescribeConfigurationSettingsInput) (*elasticbeanstalk.DescribeConfigurationSettingsOutput, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	env, ok := eb.envs[aws.StringValue(input.EnvironmentName)]
+	if !ok || aws.StringValue(env.description.ApplicationName) != aws.StringValue(input.ApplicationName) {
+		return nil, newError("InvalidParameterValue", "No Environment found for EnvironmentName = '%s'.", aws.StringValue(input.EnvironmentName))
+	}
+
+	var options []*elasticbeanstalk.ConfigurationOptionSetting
+	for _, option := range env.options {
+		options = append(options, &elasticbeanstalk.ConfigurationOptionSetting{
+			Namespace:  option.Namespace,
+			OptionName: option.OptionName,
+			Value:      option.Value,
+		})
+	}
+
+	return &elasticbeanstalk.DescribeConfigurationSettingsOutput{
+		ConfigurationSettings: []*elasticbeanstalk.ConfigurationSettingsDescription{
+			{
+				ApplicationName: env.description.ApplicationName,
+				EnvironmentName: env.description.EnvironmentName,
+				OptionSettings:  options,
+			},
+		},
+	}, nil
+}
+
+func (eb *ElasticBeanstalk) CreateApplicationVersion(input *elasticbeanstalk.CreateApplicationVersionInput) (*elasticbeanstalk.ApplicationVersionDescriptionMessage, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	appName := aws.StringValue(input.ApplicationName)
+	label := aws.StringValue(input.VersionLabel)
+	if !eb.apps[appName] {
+		if !aws.BoolValue(input.AutoCreateApplication) {
+			return nil, newError("InvalidParameterValue", "No Application named '%s' found.", appName)
+		}
+		eb.apps[appName] = true
+	}
+	if _, ok := eb.versions[appName+"/"+label]; ok {
+		return nil, newError("InvalidParameterValue", "Application Version %s already exists.", label)
+	}
+
+	bundle := input.SourceBundle
+	if bundle == nil || !eb.s3.hasObject(aws.StringValue(bundle.S3Bucket), aws.StringValue(bundle.S3Key)) {
+		return nil, newError("InvalidParameterCombination", "Unable to download from S3 location (Bucket: %s Key: %s). Reason: Not Found", aws.StringValue(bundle.S3Bucket), aws.StringValue(bundle.S3Key))
+	}
+
+	version := &elasticbeanstalk.ApplicationVersionDescription{
+		ApplicationName: aws.String(appName),
+		DateCreated:     aws.Time(time.Now().UTC()),
+		Description:     input.Description,
+		SourceBundle:    bundle,
+		Status:          aws.String(elasticbeanstalk.ApplicationVersionStatusProcessed),
+		VersionLabel:    aws.String(label),
+	}
+	eb.versions[appName+"/"+label] = version
+
+	return &elasticbeanstalk.ApplicationVersionDescriptionMessage{ApplicationVersion: version}, nil
+}
+
+func (eb *ElasticBeanstalk) DescribeApplicationVersions(input *elasticbeanstalk.DescribeApplicationVersionsInput) (*elasticbeanstalk.DescribeApplicationVersionsOutput, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	appName := aws.StringValue(input.ApplicationName)
+	labels := aws.StringValueSlice(input.VersionLabels)
+
+	output := &elasticbeanstalk.DescribeApplicationVersionsOutput{}
+	for _, version := range eb.versions {
+		if appName != "" && aws.StringValue(version.ApplicationName) != appName {
+			continue
+		}
+		if len(labels) > 0 && !contains(labels, aws.StringValue(version.VersionLabel)) {
+			continue
+		}
+		output.ApplicationVersions = append(output.ApplicationVersions, version)
+	}
+
+	// Elastic Beanstalk lists the newest versions first.
+	sort.Slice(output.ApplicationVersions, func(i, j int) bool {
+		a, b := output.ApplicationVersions[i], output.ApplicationVersions[j]
+		if !aws.TimeValue(a.DateCreated).Equal(aws.TimeValue(b.DateCreated)) {
+			return aws.TimeValue(a.DateCreated).After(aws.TimeValue(b.DateCreated))
+		}
+		return aws.StringValue(a.VersionLabel) > aws.StringValue(b.VersionLabel)
+	})
+
+	return output, nil
+}
+
+func (eb *ElasticBeanstalk) UpdateEnvironment(input *elasticbeanstalk.UpdateEnvironmentInput) (*elasticbeanstalk.EnvironmentDescription, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	envName := aws.StringValue(input.EnvironmentName)
+	env, ok := eb.envs[envName]
+	if !ok {
+		return nil, newError("InvalidParameterValue", "No Environment found for EnvironmentName = '%s'.", envName)
+	}
+
+	if aws.StringValue(env.description.Status) != elasticbeanstalk.EnvironmentStatusReady {
+		return nil, newError("InvalidParameterValue", "Environment named %s is in an invalid state for this operation. Must be Ready.", envName)
+	}
+
+	appName := aws.StringValue(env.description.ApplicationName)
+	label := aws.StringValue(input.VersionLabel)
+	if _, ok := eb.versions[appName+"/"+label]; !ok {
+		return nil, newError("InvalidParameterValue", "No Application Version named '%s' found.", label)
+	}
+
+	env.description.VersionLabel = aws.String(label)
+	eb.addEvent(appName, envName, elasticbeanstalk.EventSeverityInfo, "Environment update completed successfully.")
+
+	description := *env.description
+	return &description, nil
+}
+
+func (eb *ElasticBeanstalk) TerminateEnvironment(input *elasticbeanstalk.TerminateEnvironmentInput) (*elasticbeanstalk.EnvironmentDescription, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	envName := aws.StringValue(input.EnvironmentName)
+	env, ok := eb.envs[envName]
+	if !ok {
+		return nil, newError("InvalidParameterValue", "No Environment found for EnvironmentName = '%s'.", envName)
+	}
+
+	description := *env.description
+	description.Status = aws.String(elasticbeanstalk.EnvironmentStatusTerminating)
+	eb.terminate(envName)
+
+	return &description, nil
+}
+
+func (eb *ElasticBeanstalk) DeleteApplication(input *elasticbeanstalk.DeleteApplicationInput) (*elasticbeanstalk.DeleteApplicationOutput, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	appName := aws.StringValue(input.ApplicationName)
+	if !eb.apps[appName] {
+		return nil, newError("InvalidParameterValue", "No Application named '%s' found.", appName)
+	}
+
+	for envName, env := range eb.envs {
+		if aws.StringValue(env.description.ApplicationName) != appName {
+			continue
+		}
+		if !aws.BoolValue(input.TerminateEnvByForce) {
+			return nil, newError("InvalidParameterValue", "Unable to delete application %s because it has a running environment.", appName)
+		}
+		eb.terminate(envName)
+	}
+
+	for key, version := range eb.versions {
+		if aws.StringValue(version.ApplicationName) == appName {
+			delete(eb.versions, key)
+		}
+	}
+	delete(eb.apps, appName)
+
+	return &elasticbeanstalk.DeleteApplicationOutput{}, nil
+}
+
+func (eb *ElasticBeanstalk) DeleteApplicationVersion(input *elasticbeanstalk.DeleteApplicationVersionInput) (*elasticbeanstalk.DeleteApplicationVersionOutput, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	appName := aws.StringValue(input.ApplicationName)
+	label := aws.StringValue(input.VersionLabel)
+	version, ok := eb.versions[appName+"/"+label]
+	if !ok {
+		return nil, newError("InvalidParameterValue", "No Application Version named '%s' found.", label)
+	}
+
+	for envName, env := range eb.envs {
+		if aws.StringValue(env.description.ApplicationName) == appName && aws.StringValue(env.description.VersionLabel) == label {
+			return nil, newError("InvalidParameterValue", "Unable to delete application version %s because it is being used by environment %s.", label, envName)
+		}
+	}
+
+	if aws.BoolValue(input.DeleteSourceBundle) && version.SourceBundle != nil {
+		eb.s3.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: version.SourceBundle.S3Bucket,
+			Key:    version.SourceBundle.S3Key,
+		})
+	}
+	delete(eb.versions, appName+"/"+label)
+
+	return &elasticbeanstalk.DeleteApplicationVersionOutput{}, nil
+}
+
+func (eb *ElasticBeanstalk) DescribeEventsPages(input *elasticbeanstalk.DescribeEventsInput, fn func(*elasticbeanstalk.DescribeEventsOutput, bool) bool) error {
+	eb.mu.Lock()
+	var events []*elasticbeanstalk.EventDescription
+	for _, event := range eb.events {
+		if input.ApplicationName != nil && aws.StringValue(event.ApplicationName) != aws.StringValue(input.ApplicationName) {
+			continue
+		}
+		if input.EnvironmentName != nil && aws.StringValue(event.EnvironmentName) != aws.StringValue(input.EnvironmentName) {
+			continue
+		}
+		if input.StartTime != nil && aws.TimeValue(event.EventDate).Before(aws.TimeValue(input.StartTime)) {
+			continue
+		}
+		events = append(events, event)
+	}
+	eb.mu.Unlock()
+
+	fn(&elasticbeanstalk.DescribeEventsOutput{Events: events}, true)
+	return nil
+}
+
+func (eb *ElasticBeanstalk) ListPlatformVersionsPages(input *elasticbeanstalk.ListPlatformVersionsInput, fn func(*elasticbeanstalk.ListPlatformVersionsOutput, bool) bool) error {
+	eb.mu.Lock()
+	var summaries []*elasticbeanstalk.PlatformSummary
+	for _, summary := range eb.Platforms {
+		if platformMatches(summary, input.Filters) {
+			summaries = append(summaries, summary)
+		}
+	}
+	eb.mu.Unlock()
+
+	fn(&elasticbeanstalk.ListPlatformVersionsOutput{PlatformSummaryList: summaries}, true)
+	return nil
+}
+
+// terminate removes the environment envName and its security group. Like the
+// real service, terminated environments are no longer described. eb.mu must
+// be held.
+func (eb *ElasticBeanstalk) terminate(envName string) {
+	appName := aws.StringValue(eb.envs[envName].description.ApplicationName)
+	delete(eb.envs, envName)
+	eb.ec2.deleteSecurityGroups("elasticbeanstalk:environment-name", envName)
+	eb.addEvent(appName, envName, elasticbeanstalk.EventSeverityInfo, "terminateEnvironment completed successfully.")
+}
+
+// addEvent records an event. eb.mu must be held.
+func (eb *ElasticBeanstalk) addEvent(appName, envName, severity, message string) {
+	eb.events = append(eb.events, &elasticbeanstalk.EventDescription{
+		ApplicationName: aws.String(appName),
+		EnvironmentName: aws.String(envName),
+		EventDate:       aws.Time(time.Now().UTC()),
+		Message:         aws.String(message),
+		Severity:        aws.String(severity),
+	})
+}
+
+// platformMatches applies the "=" and "begins_with" filters the Op uses.
+func platformMatches(summary *elasticbeanstalk.PlatformSummary, filters []*elasticbeanstalk.PlatformFilter) bool {
+	for _, filter := range filters {
+		var value string
+		switch aws.StringValue(filter.Type) {
+		case "PlatformOwner":
+			value = aws.StringValue(summary.PlatformOwner)
+		case "PlatformStatus":
+			value = aws.StringValue(summary.PlatformStatus)
+		case "PlatformBranchName":
+			value = aws.StringValue(summary.PlatformBranchName)
+		default:
+			continue
+		}
+
+		matched := false
+		for _, want := range aws.StringValueSlice(filter.Values) {
+			switch aws.StringValue(filter.Operator) {
+			case "begins_with":
+				matched = matched || strings.HasPrefix(value, want)
+			default:
+				matched = matched || value == want
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,400 @@
+package fakeaws
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// DefaultVPCID is the ID of the default VPC every fake account starts with.
+// Like a real default VPC, all of its subnets route to an internet gateway.
+const DefaultVPCID = "vpc-default"
+
+// EC2 is a fake EC2 holding VPCs, subnets, route tables, security groups and
+// their ingress rules.
+type EC2 struct {
+	ec2iface.EC2API
+
+	mu          sync.Mutex
+	ids         *idGenerator
+	vpcs        []*ec2.Vpc
+	subnets     []*ec2.Subnet
+	routeTables []*ec2.RouteTable
+	groups      []*ec2.SecurityGroup
+	rules       []*ec2.SecurityGroupRule
+}
+
+func newEC2(ids *idGenerator) *EC2 {
+	f := &EC2{ids: ids}
+
+	f.vpcs = append(f.vpcs, &ec2.Vpc{VpcId: aws.String(DefaultVPCID), IsDefault: aws.Bool(true)})
+	for _, zone := range []string{"a", "b"} {
+		f.subnets = append(f.subnets, &ec2.Subnet{
+			AvailabilityZone: aws.String(zone),
+			SubnetId:         aws.String(ids.next("subnet")),
+			VpcId:            aws.String(DefaultVPCID),
+		})
+	}
+	f.routeTables = append(f.routeTables, &ec2.RouteTable{
+		Associations: []*ec2.RouteTableAssociation{{Main: aws.Bool(true)}},
+		RouteTableId: aws.String(ids.next("rtb")),
+		Routes:       []*ec2.Route{{DestinationCidrBlock: aws.String("0.0.0.0/0"), GatewayId: aws.String(ids.next("igw"))}},
+		VpcId:        aws.String(DefaultVPCID),
+	})
+
+	return f
+}
+
+// AddPrivateSubnet adds a subnet in zone to vpcID whose route table has no
+// route to an internet gateway, and returns its ID.
+func (f *EC2) AddPrivateSubnet(vpcID, zone string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	subnetID := f.ids.next("subnet")
+	f.subnets = append(f.subnets, &ec2.Subnet{AvailabilityZone: aws.String(zone), SubnetId: aws.String(subnetID), VpcId: aws.String(vpcID)})
+	f.routeTables = append(f.routeTables, &ec2.RouteTable{
+		Associations: []*ec2.RouteTableAssociation{{SubnetId: aws.String(subnetID)}},
+		RouteTableId: aws.String(f.ids.next("rtb")),
+		VpcId:        aws.String(vpcID),
+	})
+	return subnetID
+}
+
+// IngressRules returns the ingress rules of the security group groupID.
+func (f *EC2) IngressRules(groupID string) []*ec2.SecurityGroupRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rules []*ec2.SecurityGroupRule
+	for _, rule := range f.rules {
+		if aws.StringValue(rule.GroupId) == groupID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// addSecurityGroup creates a security group in the default VPC and returns its ID.
+func (f *EC2) addSecurityGroup(name, description string, tags map[string]string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.createGroup(DefaultVPCID, name, description, tags)
+}
+
+// deleteSecurityGroups removes the security groups tagged key=value, and the
+// rules they are part of.
+func (f *EC2) deleteSecurityGroups(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var groups []*ec2.SecurityGroup
+	deleted := map[string]bool{}
+	for _, group := range f.groups {
+		if contains(tagValues(group.Tags, "tag:"+key), value) {
+			deleted[aws.StringValue(group.GroupId)] = true
+			continue
+		}
+		groups = append(groups, group)
+	}
+	f.groups = groups
+
+	var rules []*ec2.SecurityGroupRule
+	for _, rule := range f.rules {
+		if deleted[aws.StringValue(rule.GroupId)] {
+			continue
+		}
+		if rule.ReferencedGroupInfo != nil && deleted[aws.StringValue(rule.ReferencedGroupInfo.GroupId)] {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	f.rules = rules
+}
+
+// createGroup creates a security group. f.mu must be held.
+func (f *EC2) createGroup(vpcID, name, description string, tags map[string]string) string {
+	groupID := f.ids.next("sg")
+
+	group := &ec2.SecurityGroup{
+		Description: aws.String(description),
+		GroupId:     aws.String(groupID),
+		GroupName:   aws.String(name),
+		VpcId:       aws.String(vpcID),
+	}
+	for key, value := range tags {
+		group.Tags = append(group.Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	f.groups = append(f.groups, group)
+
+	return groupID
+}
+
+func (f *EC2) DescribeVpcs(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	output := &ec2.DescribeVpcsOutput{}
+	for _, vpc := range f.vpcs {
+		if filtersMatch(input.Filters, func(name string) []string {
+			switch name {
+			case "isDefault":
+				if aws.BoolValue(vpc.IsDefault) {
+					return []string{"true"}
+				}
+				return []string{"false"}
+			case "vpc-id":
+				return []string{aws.StringValue(vpc.VpcId)}
+			}
+			return nil
+		}) {
+			output.Vpcs = append(output.Vpcs, vpc)
+		}
+	}
+	return output, nil
+}
+
+func (f *EC2) DescribeSubnetsPages(input *ec2.DescribeSubnetsInput, fn func(*ec2.DescribeSubnetsOutput, bool) bool) error {
+	f.mu.Lock()
+	output := &ec2.DescribeSubnetsOutput{}
+	for _, subnet := range f.subnets {
+		if filtersMatch(input.Filters, vpcIDValues(subnet.VpcId)) {
+			output.Subnets = append(output.Subnets, subnet)
+		}
+	}
+	f.mu.Unlock()
+
+	fn(output, true)
+	return nil
+}
+
+func (f *EC2) DescribeRouteTablesPages(input *ec2.DescribeRouteTablesInput, fn func(*ec2.DescribeRouteTablesOutput, bool) bool) error {
+	f.mu.Lock()
+	output := &ec2.DescribeRouteTablesOutput{}
+	for _, routeTable := range f.routeTables {
+		if filtersMatch(input.Filters, vpcIDValues(routeTable.VpcId)) {
+			output.RouteTables = append(output.RouteTables, routeTable)
+		}
+	}
+	f.mu.Unlock()
+
+	fn(output, true)
+	return nil
+}
+
+func (f *EC2) DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	output := &ec2.DescribeSecurityGroupsOutput{}
+	for _, group := range f.groups {
+		if len(input.GroupIds) > 0 && !contains(aws.StringValueSlice(input.GroupIds), aws.StringValue(group.GroupId)) {
+			continue
+		}
+		if filtersMatch(input.Filters, func(name string) []string {
+			switch name {
+			case "vpc-id":
+				return []string{aws.StringValue(group.VpcId)}
+			case "group-name":
+				return []string{aws.StringValue(group.GroupName)}
+			case "group-id":
+				return []string{aws.StringValue(group.GroupId)}
+			}
+			return tagValues(group.Tags, name)
+		}) {
+			output.SecurityGroups = append(output.SecurityGroups, group)
+		}
+	}
+	return output, nil
+}
+
+func (f *EC2) CreateSecurityGroup(input *ec2.CreateSecurityGroupInput) (*ec2.CreateSecurityGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	vpcID := aws.StringValue(input.VpcId)
+	name := aws.StringValue(input.GroupName)
+	for _, group := range f.groups {
+		if aws.StringValue(group.VpcId) == vpcID && aws.StringValue(group.GroupName) == name {
+			return nil, newError("InvalidGroup.Duplicate", "The security group '%s' already exists for VPC '%s'", name, vpcID)
+		}
+	}
+
+	groupID := f.createGroup(vpcID, name, aws.StringValue(input.Description), nil)
+	return &ec2.CreateSecurityGroupOutput{GroupId: aws.String(groupID)}, nil
+}
+
+func (f *EC2) DeleteSecurityGroup(input *ec2.DeleteSecurityGroupInput) (*ec2.DeleteSecurityGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	groupID := aws.StringValue(input.GroupId)
+	if !f.groupExists(groupID) {
+		return nil, newError("InvalidGroup.NotFound", "The security group '%s' does not exist", groupID)
+	}
+	for _, rule := range f.rules {
+		if aws.StringValue(rule.GroupId) != groupID && rule.ReferencedGroupInfo != nil && aws.StringValue(rule.ReferencedGroupInfo.GroupId) == groupID {
+			return nil, newError("DependencyViolation", "resource %s has a dependent object", groupID)
+		}
+	}
+
+	var groups []*ec2.SecurityGroup
+	for _, group := range f.groups {
+		if aws.StringValue(group.GroupId) != groupID {
+			groups = append(groups, group)
+		}
+	}
+	f.groups = groups
+
+	var rules []*ec2.SecurityGroupRule
+	for _, rule := range f.rules {
+		if aws.StringValue(rule.GroupId) != groupID {
+			rules = append(rules, rule)
+		}
+	}
+	f.rules = rules
+
+	return &ec2.DeleteSecurityGroupOutput{}, nil
+}
+
+func (f *EC2) DescribeSecurityGroupRulesPages(input *ec2.DescribeSecurityGroupRulesInput, fn func(*ec2.DescribeSecurityGroupRulesOutput, bool) bool) error {
+	f.mu.Lock()
+	output := &ec2.DescribeSecurityGroupRulesOutput{}
+	for _, rule := range f.rules {
+		if filtersMatch(input.Filters, func(name string) []string {
+			if name == "group-id" {
+				return []string{aws.StringValue(rule.GroupId)}
+			}
+			return tagValues(rule.Tags, name)
+		}) {
+			output.SecurityGroupRules = append(output.SecurityGroupRules, rule)
+		}
+	}
+	f.mu.Unlock()
+
+	fn(output, true)
+	return nil
+}
+
+func (f *EC2) AuthorizeSecurityGroupIngress(input *ec2.AuthorizeSecurityGroupIngressInput) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	groupID := aws.StringValue(input.GroupId)
+	if !f.groupExists(groupID) {
+		return nil, newError("InvalidGroup.NotFound", "The security group '%s' does not exist", groupID)
+	}
+
+	var tags []*ec2.Tag
+	for _, spec := range input.TagSpecifications {
+		if aws.StringValue(spec.ResourceType) == ec2.ResourceTypeSecurityGroupRule {
+			tags = append(tags, spec.Tags...)
+		}
+	}
+
+	var added []*ec2.SecurityGroupRule
+	for _, permission := range input.IpPermissions {
+		for _, pair := range permission.UserIdGroupPairs {
+			for _, rule := range f.rules {
+				if aws.StringValue(rule.GroupId) == groupID &&
+					rule.ReferencedGroupInfo != nil && aws.StringValue(rule.ReferencedGroupInfo.GroupId) == aws.StringValue(pair.GroupId) &&
+					aws.StringValue(rule.IpProtocol) == aws.StringValue(permission.IpProtocol) &&
+					aws.Int64Value(rule.FromPort) == aws.Int64Value(permission.FromPort) &&
+					aws.Int64Value(rule.ToPort) == aws.Int64Value(permission.ToPort) {
+					return nil, newError("InvalidPermission.Duplicate", "the specified rule already exists")
+				}
+			}
+
+			added = append(added, &ec2.SecurityGroupRule{
+				FromPort:            permission.FromPort,
+				GroupId:             aws.String(groupID),
+				IpProtocol:          permission.IpProtocol,
+				IsEgress:            aws.Bool(false),
+				ReferencedGroupInfo: &ec2.ReferencedSecurityGroup{GroupId: pair.GroupId},
+				SecurityGroupRuleId: aws.String(f.ids.next("sgr")),
+				Tags:                tags,
+				ToPort:              permission.ToPort,
+			})
+		}
+	}
+	f.rules = append(f.rules, added...)
+
+	return &ec2.AuthorizeSecurityGroupIngressOutput{Return: aws.Bool(true), SecurityGroupRules: added}, nil
+}
+
+func (f *EC2) RevokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	groupID := aws.StringValue(input.GroupId)
+	ruleIDs := aws.StringValueSlice(input.SecurityGroupRuleIds)
+
+	var kept []*ec2.SecurityGroupRule
+	for _, rule := range f.rules {
+		if aws.StringValue(rule.GroupId) == groupID && contains(ruleIDs, aws.StringValue(rule.SecurityGroupRuleId)) {
+			continue
+		}
+		kept = append(kept, rule)
+	}
+	if len(f.rules)-len(kept) != len(ruleIDs) {
+		return nil, newError("InvalidSecurityGroupRuleId.NotFound", "The security group rule IDs '%s' do not exist", strings.Join(ruleIDs, ", "))
+	}
+	f.rules = kept
+
+	return &ec2.RevokeSecurityGroupIngressOutput{Return: aws.Bool(true)}, nil
+}
+
+// groupExists reports whether groupID exists. f.mu must be held.
+func (f *EC2) groupExists(groupID string) bool {
+	for _, group := range f.groups {
+		if aws.StringValue(group.GroupId) == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// filtersMatch reports whether a resource, whose values for a filter name are
+// returned by values, passes every filter.
+func filtersMatch(filters []*ec2.Filter, values func(name string) []string) bool {
+	for _, filter := range filters {
+		matched := false
+		for _, value := range values(aws.StringValue(filter.Name)) {
+			if contains(aws.StringValueSlice(filter.Values), value) {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func vpcIDValues(vpcID *string) func(name string) []string {
+	return func(name string) []string {
+		if name == "vpc-id" {
+			return []string{aws.StringValue(vpcID)}
+		}
+		return nil
+	}
+}
+
+// tagValues returns the value of the tag named by a "tag:<key>" filter.
+func tagValues(tags []*ec2.Tag, filterName string) []string {
+	if !strings.HasPrefix(filterName, "tag:") {
+		return nil
+	}
+
+	key := strings.TrimPrefix(filterName, "tag:")
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key {
+			return []string{aws.StringValue(tag.Value)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Package fakeaws keeps the AWS resources the Op manages in memory, so that the
+// deploy flows can run end to end without an AWS account. Every fake embeds
+// the SDK interface of its service: calls the Op does not make panic.
+//
+// Resources become available as soon as they are created, so pollers finish
+// on their first attempt. RDS.InitialStatus and
+// ElasticBeanstalk.SetEnvironmentStatus hold them back, for waits driven by a
+// wait.FakeClock.
+package fakeaws
+
+import (
+	"fmt"
+	"sync"
+
+	"git.cto.ai/provision/internal/awsclients"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// AccountID is the ID of every fake account.
+const AccountID = "123456789012"
+
+// AWS is a single fake account in a single region.
+type AWS struct {
+	Region string
+
+	EB             *ElasticBeanstalk
+	S3             *S3
+	Uploader       *Uploader
+	STS            *STS
+	RDS            *RDS
+	EC2            *EC2
+	IAM            *IAM
+	SecretsManager *SecretsManager
+	SSM            *SSM
+}
+
+// New returns an empty account in region with a default VPC, the default
+// Elastic Beanstalk instance profile, and a platform version and the usual
+// engine versions to choose from.
+func New(region string) *AWS {
+	ids := &idGenerator{}
+	f := &AWS{Region: region}
+
+	f.S3 = newS3()
+	f.Uploader = &Uploader{s3: f.S3}
+	f.STS = &STS{}
+	f.EC2 = newEC2(ids)
+	f.EB = newElasticBeanstalk(region, f.S3, f.EC2)
+	f.RDS = newRDS(region, ids)
+	f.IAM = newIAM()
+	f.SecretsManager = newSecretsManager(region)
+	f.SSM = newSSM(region)
+
+	return f
+}
+
+// Clients returns the fake services as the clients the Op uses.
+func (f *AWS) Clients() awsclients.Clients {
+	return awsclients.Clients{
+		EB:             f.EB,
+		S3:             f.S3,
+		Uploader:       f.Uploader,
+		STS:            f.STS,
+		RDS:            f.RDS,
+		EC2:            f.EC2,
+		IAM:            f.IAM,
+		SecretsManager: f.SecretsManager,
+		SSM:            f.SSM,
+	}
+}
+
+// idGenerator hands out resource IDs that are unique within an account.
+type idGenerator struct {
+	mu   sync.Mutex
+	last int
+}
+
+func (g *idGenerator) next(prefix string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.last++
+	return fmt.Sprintf("%s-%017x", prefix, g.last)
+}
+
+// newError returns an error shaped like the ones the SDK returns.
+func newError(code, format string, args ...interface{}) error {
+	return awserr.New(code, fmt.Sprintf(format, args...), nil)
+}
@@ -0,0 +1,107 @@
+package fakeaws
+
+import (
+	"fmt"
+	"sync"
+
+	"git.cto.ai/provision/internal/awseb"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// IAM is a fake IAM holding instance profiles and the inline policies of
+// their roles.
+type IAM struct {
+	iamiface.IAMAPI
+
+	mu       sync.Mutex
+	profiles map[string][]string
+	policies map[string]map[string]string
+}
+
+func newIAM() *IAM {
+	f := &IAM{
+		profiles: map[string][]string{},
+		policies: map[string]map[string]string{},
+	}
+	f.AddInstanceProfile(awseb.DefaultInstanceProfile, awseb.DefaultInstanceProfile)
+	return f
+}
+
+// AddInstanceProfile adds the instance profile name holding roles.
+func (f *IAM) AddInstanceProfile(name string, roles ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.profiles[name] = roles
+}
+
+// RolePolicy returns the inline policy policyName of roleName and whether it
+// exists.
+func (f *IAM) RolePolicy(roleName, policyName string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	document, ok := f.policies[roleName][policyName]
+	return document, ok
+}
+
+func (f *IAM) GetInstanceProfile(input *iam.GetInstanceProfileInput) (*iam.GetInstanceProfileOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.InstanceProfileName)
+	roleNames, ok := f.profiles[name]
+	if !ok {
+		return nil, newError(iam.ErrCodeNoSuchEntityException, "Instance Profile %s cannot be found.", name)
+	}
+
+	profile := &iam.InstanceProfile{
+		Arn:                 aws.String(fmt.Sprintf("arn:aws:iam::%s:instance-profile/%s", AccountID, name)),
+		InstanceProfileName: aws.String(name),
+	}
+	for _, roleName := range roleNames {
+		profile.Roles = append(profile.Roles, &iam.Role{
+			Arn:      aws.String(fmt.Sprintf("arn:aws:iam::%s:role/%s", AccountID, roleName)),
+			RoleName: aws.String(roleName),
+		})
+	}
+
+	return &iam.GetInstanceProfileOutput{InstanceProfile: profile}, nil
+}
+
+func (f *IAM) PutRolePolicy(input *iam.PutRolePolicyInput) (*iam.PutRolePolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	roleName := aws.StringValue(input.RoleName)
+	known := false
+	for _, roleNames := range f.profiles {
+		known = known || contains(roleNames, roleName)
+	}
+	if !known {
+		return nil, newError(iam.ErrCodeNoSuchEntityException, "The role with name %s cannot be found.", roleName)
+	}
+
+	if f.policies[roleName] == nil {
+		f.policies[roleName] = map[string]string{}
+	}
+	f.policies[roleName][aws.StringValue(input.PolicyName)] = aws.StringValue(input.PolicyDocument)
+
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+func (f *IAM) DeleteRolePolicy(input *iam.DeleteRolePolicyInput) (*iam.DeleteRolePolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	roleName := aws.StringValue(input.RoleName)
+	policyName := aws.StringValue(input.PolicyName)
+	if _, ok := f.policies[roleName][policyName]; !ok {
+		return nil, newError(iam.ErrCodeNoSuchEntityException, "The role policy with name %s cannot be found.", policyName)
+	}
+	delete(f.policies[roleName], policyName)
+
+	return &iam.DeleteRolePolicyOutput{}, nil
+}
@@ -0,0 +1,494 @@
+package fakeaws
+
+import (
+	"fmt"
+	"sync"
+
+	"git.cto.ai/provision/internal/awsrds"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+)
+
+// RDS is a fake RDS. Instances and clusters are available as soon as they
+// are created, unless InitialStatus says otherwise.
+type RDS struct {
+	rdsiface.RDSAPI
+
+	mu     sync.Mutex
+	region string
+	ids    *idGenerator
+
+	// InitialStatus is the status new instances and clusters start in, and
+	// keep until SetStatus changes it. Empty means available.
+	InitialStatus string
+
+	// EngineVersions lists the versions of each engine, oldest first. The
+	// last one is the default.
+	EngineVersions map[string][]string
+	// InstanceClasses can be ordered with every engine, storage type and
+	// option.
+	InstanceClasses []string
+
+	instances    map[string]*rds.DBInstance
+	clusters     map[string]*rds.DBCluster
+	subnetGroups map[string]*rds.DBSubnetGroup
+	snapshots    map[string]string
+}
+
+func newRDS(region string, ids *idGenerator) *RDS {
+	f := &RDS{
+		region:          region,
+		ids:             ids,
+		EngineVersions:  map[string][]string{},
+		InstanceClasses: []string{"db.t3.micro", "db.t3.small", "db.t3.medium", "db.m5.large"},
+		instances:       map[string]*rds.DBInstance{},
+		clusters:        map[string]*rds.DBCluster{},
+		subnetGroups:    map[string]*rds.DBSubnetGroup{},
+		snapshots:       map[string]string{},
+	}
+
+	for _, name := range awsrds.PlatformChoices {
+		f.EngineVersions[name] = []string{"1.0", "2.0"}
+	}
+
+	return f
+}
+
+// DBInstance returns the DB instance id, or nil if it does not exist.
+func (f *RDS) DBInstance(id string) *rds.DBInstance {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.instances[id]
+}
+
+// DBCluster returns the DB cluster id, or nil if it does not exist.
+func (f *RDS) DBCluster(id string) *rds.DBCluster {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.clusters[id]
+}
+
+// SubnetGroup returns the DB subnet group name, or nil if it does not exist.
+func (f *RDS) SubnetGroup(name string) *rds.DBSubnetGroup {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.subnetGroups[name]
+}
+
+// SetStatus changes the status of the DB instance or cluster id. Descriptions
+// returned earlier keep the old status.
+func (f *RDS) SetStatus(id, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if instance, ok := f.instances[id]; ok {
+		updated := *instance
+		updated.DBInstanceStatus = aws.String(status)
+		f.instances[id] = &updated
+	}
+	if cluster, ok := f.clusters[id]; ok {
+		updated := *cluster
+		updated.Status = aws.String(status)
+		f.clusters[id] = &updated
+	}
+}
+
+// initialStatus returns the status a new instance or cluster starts in.
+func (f *RDS) initialStatus() *string {
+	if f.InitialStatus == "" {
+		return aws.String("available")
+	}
+	return aws.String(f.InitialStatus)
+}
+
+// Snapshot returns the database the final snapshot id was taken of, and
+// whether it exists.
+func (f *RDS) Snapshot(id string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	source, ok := f.snapshots[id]
+	return source, ok
+}
+
+func (f *RDS) DescribeDBEngineVersions(input *rds.DescribeDBEngineVersionsInput) (*rds.DescribeDBEngineVersionsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	engine := aws.StringValue(input.Engine)
+	versions := f.EngineVersions[engine]
+	if aws.BoolValue(input.DefaultOnly) && len(versions) > 0 {
+		versions = versions[len(versions)-1:]
+	}
+
+	output := &rds.DescribeDBEngineVersionsOutput{}
+	for _, version := range versions {
+		output.DBEngineVersions = append(output.DBEngineVersions, &rds.DBEngineVersion{
+			Engine:        aws.String(engine),
+			EngineVersion: aws.String(version),
+		})
+	}
+	return output, nil
+}
+
+func (f *RDS) DescribeDBEngineVersionsPages(input *rds.DescribeDBEngineVersionsInput, fn func(*rds.DescribeDBEngineVersionsOutput, bool) bool) error {
+	output, err := f.DescribeDBEngineVersions(input)
+	if err != nil {
+		return err
+	}
+
+	fn(output, true)
+	return nil
+}
+
+func (f *RDS) DescribeOrderableDBInstanceOptionsPages(input *rds.DescribeOrderableDBInstanceOptionsInput, fn func(*rds.DescribeOrderableDBInstanceOptionsOutput, bool) bool) error {
+	f.mu.Lock()
+	output := &rds.DescribeOrderableDBInstanceOptionsOutput{}
+	for _, class := range f.InstanceClasses {
+		if input.DBInstanceClass != nil && aws.StringValue(input.DBInstanceClass) != class {
+			continue
+		}
+		for _, storageType := range awsrds.StorageTypes {
+			output.OrderableDBInstanceOptions = append(output.OrderableDBInstanceOptions, &rds.OrderableDBInstanceOption{
+				DBInstanceClass:            aws.String(class),
+				Engine:                     input.Engine,
+				EngineVersion:              input.EngineVersion,
+				MaxStorageSize:             aws.Int64(65536),
+				MinStorageSize:             aws.Int64(20),
+				MultiAZCapable:             aws.Bool(true),
+				StorageType:                aws.String(storageType),
+				SupportsStorageAutoscaling: aws.Bool(true),
+				SupportsStorageEncryption:  aws.Bool(true),
+				Vpc:                        aws.Bool(true),
+			})
+		}
+	}
+	f.mu.Unlock()
+
+	fn(output, true)
+	return nil
+}
+
+func (f *RDS) DescribeDBSubnetGroups(input *rds.DescribeDBSubnetGroupsInput) (*rds.DescribeDBSubnetGroupsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	output := &rds.DescribeDBSubnetGroupsOutput{}
+	if input.DBSubnetGroupName != nil {
+		group, ok := f.subnetGroups[aws.StringValue(input.DBSubnetGroupName)]
+		if !ok {
+			return nil, newError(rds.ErrCodeDBSubnetGroupNotFoundFault, "DB subnet group '%s' not found.", aws.StringValue(input.DBSubnetGroupName))
+		}
+		output.DBSubnetGroups = append(output.DBSubnetGroups, group)
+		return output, nil
+	}
+
+	for _, group := range f.subnetGroups {
+		output.DBSubnetGroups = append(output.DBSubnetGroups, group)
+	}
+	return output, nil
+}
+
+// AddDBSubnetGroup adds the DB subnet group name in vpcID, as if it had been
+// created outside the Op.
+func (f *RDS) AddDBSubnetGroup(name, vpcID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.subnetGroups[name] = &rds.DBSubnetGroup{DBSubnetGroupName: aws.String(name), VpcId: aws.String(vpcID)}
+}
+
+func (f *RDS) CreateDBSubnetGroup(input *rds.CreateDBSubnetGroupInput) (*rds.CreateDBSubnetGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.DBSubnetGroupName)
+	if _, ok := f.subnetGroups[name]; ok {
+		return nil, newError(rds.ErrCodeDBSubnetGroupAlreadyExistsFault, "The DB subnet group '%s' already exists.", name)
+	}
+
+	group := &rds.DBSubnetGroup{
+		DBSubnetGroupDescription: input.DBSubnetGroupDescription,
+		DBSubnetGroupName:        aws.String(name),
+		Subnets:                  subnets(input.SubnetIds),
+		VpcId:                    aws.String(DefaultVPCID),
+	}
+	f.subnetGroups[name] = group
+
+	return &rds.CreateDBSubnetGroupOutput{DBSubnetGroup: group}, nil
+}
+
+func (f *RDS) ModifyDBSubnetGroup(input *rds.ModifyDBSubnetGroupInput) (*rds.ModifyDBSubnetGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.DBSubnetGroupName)
+	group, ok := f.subnetGroups[name]
+	if !ok {
+		return nil, newError(rds.ErrCodeDBSubnetGroupNotFoundFault, "DB subnet group '%s' not found.", name)
+	}
+	group.Subnets = subnets(input.SubnetIds)
+
+	return &rds.ModifyDBSubnetGroupOutput{DBSubnetGroup: group}, nil
+}
+
+func (f *RDS) DeleteDBSubnetGroup(input *rds.DeleteDBSubnetGroupInput) (*rds.DeleteDBSubnetGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.DBSubnetGroupName)
+	if _, ok := f.subnetGroups[name]; !ok {
+		return nil, newError(rds.ErrCodeDBSubnetGroupNotFoundFault, "DB subnet group '%s' not found.", name)
+	}
+	for _, instance := range f.instances {
+		if instance.DBSubnetGroup != nil && aws.StringValue(instance.DBSubnetGroup.DBSubnetGroupName) == name {
+			return nil, newError(rds.ErrCodeInvalidDBSubnetGroupStateFault, "Cannot delete the subnet group '%s' because at least one database instance: %s is still using it.", name, aws.StringValue(instance.DBInstanceIdentifier))
+		}
+	}
+	for _, cluster := range f.clusters {
+		if aws.StringValue(cluster.DBSubnetGroup) == name {
+			return nil, newError(rds.ErrCodeInvalidDBSubnetGroupStateFault, "Cannot delete the subnet group '%s' because at least one database cluster: %s is still using it.", name, aws.StringValue(cluster.DBClusterIdentifier))
+		}
+	}
+
+	delete(f.subnetGroups, name)
+	return &rds.DeleteDBSubnetGroupOutput{}, nil
+}
+
+func (f *RDS) CreateDBInstance(input *rds.CreateDBInstanceInput) (*rds.CreateDBInstanceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.StringValue(input.DBInstanceIdentifier)
+	if _, ok := f.instances[id]; ok {
+		return nil, newError(rds.ErrCodeDBInstanceAlreadyExistsFault, "DB instance already exists")
+	}
+
+	instance := &rds.DBInstance{
+		AllocatedStorage:      input.AllocatedStorage,
+		BackupRetentionPeriod: input.BackupRetentionPeriod,
+		DBClusterIdentifier:   input.DBClusterIdentifier,
+		DBInstanceArn:         aws.String(fmt.Sprintf("arn:aws:rds:%s:%s:db:%s", f.region, AccountID, id)),
+		DBInstanceClass:       input.DBInstanceClass,
+		DBInstanceIdentifier:  aws.String(id),
+		DBInstanceStatus:      f.initialStatus(),
+		DeletionProtection:    input.DeletionProtection,
+		Endpoint: &rds.Endpoint{
+			Address: aws.String(fmt.Sprintf("%s.%s.%s.rds.amazonaws.com", id, f.ids.next("c"), f.region)),
+			Port:    input.Port,
+		},
+		Engine:              input.Engine,
+		EngineVersion:       input.EngineVersion,
+		KmsKeyId:            input.KmsKeyId,
+		MasterUsername:      input.MasterUsername,
+		MaxAllocatedStorage: input.MaxAllocatedStorage,
+		MultiAZ:             input.MultiAZ,
+		PubliclyAccessible:  input.PubliclyAccessible,
+		StorageEncrypted:    input.StorageEncrypted,
+		StorageType:         input.StorageType,
+	}
+
+	if input.DBClusterIdentifier != nil {
+		cluster, ok := f.clusters[aws.StringValue(input.DBClusterIdentifier)]
+		if !ok {
+			return nil, newError(rds.ErrCodeDBClusterNotFoundFault, "DBCluster %s not found.", aws.StringValue(input.DBClusterIdentifier))
+		}
+		instance.Endpoint.Port = cluster.Port
+		instance.MasterUsername = cluster.MasterUsername
+		cluster.DBClusterMembers = append(cluster.DBClusterMembers, &rds.DBClusterMember{
+			DBInstanceIdentifier: aws.String(id),
+			IsClusterWriter:      aws.Bool(len(cluster.DBClusterMembers) == 0),
+		})
+	} else if input.DBSubnetGroupName != nil {
+		group, ok := f.subnetGroups[aws.StringValue(input.DBSubnetGroupName)]
+		if !ok {
+			return nil, newError(rds.ErrCodeDBSubnetGroupNotFoundFault, "DB subnet group '%s' not found.", aws.StringValue(input.DBSubnetGroupName))
+		}
+		instance.DBSubnetGroup = group
+	}
+	for _, groupID := range input.VpcSecurityGroupIds {
+		instance.VpcSecurityGroups = append(instance.VpcSecurityGroups, &rds.VpcSecurityGroupMembership{VpcSecurityGroupId: groupID, Status: aws.String("active")})
+	}
+
+	f.instances[id] = instance
+	return &rds.CreateDBInstanceOutput{DBInstance: instance}, nil
+}
+
+func (f *RDS) CreateDBCluster(input *rds.CreateDBClusterInput) (*rds.CreateDBClusterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.StringValue(input.DBClusterIdentifier)
+	if _, ok := f.clusters[id]; ok {
+		return nil, newError(rds.ErrCodeDBClusterAlreadyExistsFault, "DB Cluster already exists")
+	}
+	if _, ok := f.subnetGroups[aws.StringValue(input.DBSubnetGroupName)]; input.DBSubnetGroupName != nil && !ok {
+		return nil, newError(rds.ErrCodeDBSubnetGroupNotFoundFault, "DB subnet group '%s' not found.", aws.StringValue(input.DBSubnetGroupName))
+	}
+
+	suffix := f.ids.next("c")
+	cluster := &rds.DBCluster{
+		BackupRetentionPeriod: input.BackupRetentionPeriod,
+		DBClusterArn:          aws.String(fmt.Sprintf("arn:aws:rds:%s:%s:cluster:%s", f.region, AccountID, id)),
+		DBClusterIdentifier:   aws.String(id),
+		DBSubnetGroup:         input.DBSubnetGroupName,
+		DeletionProtection:    input.DeletionProtection,
+		Endpoint:              aws.String(fmt.Sprintf("%s.cluster-%s.%s.rds.amazonaws.com", id, suffix, f.region)),
+		Engine:                input.Engine,
+		EngineVersion:         input.EngineVersion,
+		KmsKeyId:              input.KmsKeyId,
+		MasterUsername:        input.MasterUsername,
+		Port:                  input.Port,
+		ReaderEndpoint:        aws.String(fmt.Sprintf("%s.cluster-ro-%s.%s.rds.amazonaws.com", id, suffix, f.region)),
+		Status:                f.initialStatus(),
+		StorageEncrypted:      input.StorageEncrypted,
+	}
+	for _, groupID := range input.VpcSecurityGroupIds {
+		cluster.VpcSecurityGroups = append(cluster.VpcSecurityGroups, &rds.VpcSecurityGroupMembership{VpcSecurityGroupId: groupID, Status: aws.String("active")})
+	}
+
+	f.clusters[id] = cluster
+	return &rds.CreateDBClusterOutput{DBCluster: cluster}, nil
+}
+
+func (f *RDS) DescribeDBInstances(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	output := &rds.DescribeDBInstancesOutput{}
+	if input.DBInstanceIdentifier != nil {
+		instance, ok := f.instances[aws.StringValue(input.DBInstanceIdentifier)]
+		if !ok {
+			return nil, newError(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance %s not found.", aws.StringValue(input.DBInstanceIdentifier))
+		}
+		output.DBInstances = append(output.DBInstances, instance)
+		return output, nil
+	}
+
+	for _, instance := range f.instances {
+		output.DBInstances = append(output.DBInstances, instance)
+	}
+	return output, nil
+}
+
+func (f *RDS) DescribeDBClusters(input *rds.DescribeDBClustersInput) (*rds.DescribeDBClustersOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	output := &rds.DescribeDBClustersOutput{}
+	if input.DBClusterIdentifier != nil {
+		cluster, ok := f.clusters[aws.StringValue(input.DBClusterIdentifier)]
+		if !ok {
+			return nil, newError(rds.ErrCodeDBClusterNotFoundFault, "DBCluster %s not found.", aws.StringValue(input.DBClusterIdentifier))
+		}
+		output.DBClusters = append(output.DBClusters, cluster)
+		return output, nil
+	}
+
+	for _, cluster := range f.clusters {
+		output.DBClusters = append(output.DBClusters, cluster)
+	}
+	return output, nil
+}
+
+func (f *RDS) DescribeDBInstancesPages(input *rds.DescribeDBInstancesInput, fn func(*rds.DescribeDBInstancesOutput, bool) bool) error {
+	output, err := f.DescribeDBInstances(input)
+	if err != nil {
+		return err
+	}
+
+	fn(output, true)
+	return nil
+}
+
+func (f *RDS) DescribeDBClustersPages(input *rds.DescribeDBClustersInput, fn func(*rds.DescribeDBClustersOutput, bool) bool) error {
+	output, err := f.DescribeDBClusters(input)
+	if err != nil {
+		return err
+	}
+
+	fn(output, true)
+	return nil
+}
+
+func (f *RDS) DeleteDBInstance(input *rds.DeleteDBInstanceInput) (*rds.DeleteDBInstanceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.StringValue(input.DBInstanceIdentifier)
+	instance, ok := f.instances[id]
+	if !ok {
+		return nil, newError(rds.ErrCodeDBInstanceNotFoundFault, "DBInstance %s not found.", id)
+	}
+	if aws.BoolValue(instance.DeletionProtection) {
+		return nil, newError("InvalidParameterCombination", "Cannot delete protected DB Instance, please disable deletion protection and try again.")
+	}
+
+	// Instances of a cluster are deleted without a snapshot of their own.
+	if instance.DBClusterIdentifier == nil {
+		snapshotID := aws.StringValue(input.FinalDBSnapshotIdentifier)
+		if !aws.BoolValue(input.SkipFinalSnapshot) && snapshotID == "" {
+			return nil, newError("InvalidParameterCombination", "FinalDBSnapshotIdentifier is required unless SkipFinalSnapshot is specified.")
+		}
+		if snapshotID != "" {
+			f.snapshots[snapshotID] = id
+		}
+	} else if cluster, ok := f.clusters[aws.StringValue(instance.DBClusterIdentifier)]; ok {
+		var members []*rds.DBClusterMember
+		for _, member := range cluster.DBClusterMembers {
+			if aws.StringValue(member.DBInstanceIdentifier) != id {
+				members = append(members, member)
+			}
+		}
+		cluster.DBClusterMembers = members
+	}
+
+	delete(f.instances, id)
+
+	deleted := *instance
+	deleted.DBInstanceStatus = aws.String("deleting")
+	return &rds.DeleteDBInstanceOutput{DBInstance: &deleted}, nil
+}
+
+func (f *RDS) DeleteDBCluster(input *rds.DeleteDBClusterInput) (*rds.DeleteDBClusterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := aws.StringValue(input.DBClusterIdentifier)
+	cluster, ok := f.clusters[id]
+	if !ok {
+		return nil, newError(rds.ErrCodeDBClusterNotFoundFault, "DBCluster %s not found.", id)
+	}
+	if aws.BoolValue(cluster.DeletionProtection) {
+		return nil, newError("InvalidParameterCombination", "Cannot delete protected Cluster, please disable deletion protection and try again.")
+	}
+	if len(cluster.DBClusterMembers) > 0 {
+		return nil, newError(rds.ErrCodeInvalidDBClusterStateFault, "Cluster cannot be deleted, it still contains DB instances in non-deleting state.")
+	}
+
+	snapshotID := aws.StringValue(input.FinalDBSnapshotIdentifier)
+	if !aws.BoolValue(input.SkipFinalSnapshot) && snapshotID == "" {
+		return nil, newError("InvalidParameterCombination", "FinalDBSnapshotIdentifier is required unless SkipFinalSnapshot is specified.")
+	}
+	if snapshotID != "" {
+		f.snapshots[snapshotID] = id
+	}
+
+	delete(f.clusters, id)
+
+	deleted := *cluster
+	deleted.Status = aws.String("deleting")
+	return &rds.DeleteDBClusterOutput{DBCluster: &deleted}, nil
+}
+
+func subnets(subnetIDs []*string) []*rds.Subnet {
+	var subnets []*rds.Subnet
+	for _, subnetID := range subnetIDs {
+		subnets = append(subnets, &rds.Subnet{SubnetIdentifier: subnetID, SubnetStatus: aws.String("Active")})
+	}
+	return subnets
+}
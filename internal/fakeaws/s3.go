@@ -0,0 +1,265 @@
+package fakeaws
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// S3 is a fake S3 holding buckets and their objects.
+type S3 struct {
+	s3iface.S3API
+
+	mu      sync.Mutex
+	buckets map[string]string
+	objects map[string][]byte
+}
+
+func newS3() *S3 {
+	return &S3{
+		buckets: map[string]string{},
+		objects: map[string][]byte{},
+	}
+}
+
+// Object returns the contents of key in bucket and whether it exists.
+func (f *S3) Object(bucket, key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, ok := f.objects[bucket+"/"+key]
+	return body, ok
+}
+
+func (f *S3) hasObject(bucket, key string) bool {
+	_, ok := f.Object(bucket, key)
+	return ok
+}
+
+func (f *S3) HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.buckets[aws.StringValue(input.Bucket)]; !ok {
+		return nil, newError("NotFound", "Not Found")
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (f *S3) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.Bucket)
+	if _, ok := f.buckets[name]; ok {
+		return nil, newError(s3.ErrCodeBucketAlreadyOwnedByYou, "Your previous request to create the named bucket succeeded and you already own it.")
+	}
+
+	region := "us-east-1"
+	if input.CreateBucketConfiguration != nil && aws.StringValue(input.CreateBucketConfiguration.LocationConstraint) != "" {
+		region = aws.StringValue(input.CreateBucketConfiguration.LocationConstraint)
+	}
+	f.buckets[name] = region
+
+	return &s3.CreateBucketOutput{Location: aws.String("/" + name)}, nil
+}
+
+func (f *S3) GetBucketLocation(input *s3.GetBucketLocationInput) (*s3.GetBucketLocationOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	region, ok := f.buckets[aws.StringValue(input.Bucket)]
+	if !ok {
+		return nil, newError(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist")
+	}
+
+	// Buckets in us-east-1 have no location constraint.
+	output := &s3.GetBucketLocationOutput{}
+	if region != "us-east-1" {
+		output.LocationConstraint = aws.String(region)
+	}
+	return output, nil
+}
+
+func (f *S3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	body, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket := aws.StringValue(input.Bucket)
+	if _, ok := f.buckets[bucket]; !ok {
+		return nil, newError(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist")
+	}
+	f.objects[bucket+"/"+aws.StringValue(input.Key)] = body
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *S3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket := aws.StringValue(input.Bucket)
+	if _, ok := f.buckets[bucket]; !ok {
+		return nil, newError(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist")
+	}
+	body, ok := f.objects[bucket+"/"+aws.StringValue(input.Key)]
+	if !ok {
+		return nil, newError(s3.ErrCodeNoSuchKey, "The specified key does not exist.")
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: aws.Int64(int64(len(body))),
+	}, nil
+}
+
+func (f *S3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket := aws.StringValue(input.Bucket)
+	if _, ok := f.buckets[bucket]; !ok {
+		return nil, newError(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist")
+	}
+	delete(f.objects, bucket+"/"+aws.StringValue(input.Key))
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *S3) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket := aws.StringValue(input.Bucket)
+	if _, ok := f.buckets[bucket]; !ok {
+		return nil, newError(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist")
+	}
+
+	var keys []string
+	for name := range f.objects {
+		key := strings.TrimPrefix(name, bucket+"/")
+		if key != name && strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{Name: aws.String(bucket), IsTruncated: aws.Bool(false)}
+	for _, key := range keys {
+		if input.MaxKeys != nil && int64(len(output.Contents)) == *input.MaxKeys {
+			output.IsTruncated = aws.Bool(true)
+			break
+		}
+		output.Contents = append(output.Contents, &s3.Object{
+			Key:  aws.String(key),
+			Size: aws.Int64(int64(len(f.objects[bucket+"/"+key]))),
+		})
+	}
+	output.KeyCount = aws.Int64(int64(len(output.Contents)))
+
+	return output, nil
+}
+
+func (f *S3) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	output, err := f.ListObjectsV2(input)
+	if err != nil {
+		return err
+	}
+
+	fn(output, true)
+	return nil
+}
+
+func (f *S3) DeleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket := aws.StringValue(input.Bucket)
+	if _, ok := f.buckets[bucket]; !ok {
+		return nil, newError(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist")
+	}
+
+	output := &s3.DeleteObjectsOutput{}
+	for _, object := range input.Delete.Objects {
+		delete(f.objects, bucket+"/"+aws.StringValue(object.Key))
+		output.Deleted = append(output.Deleted, &s3.DeletedObject{Key: object.Key})
+	}
+
+	return output, nil
+}
+
+func (f *S3) DeleteBucket(input *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket := aws.StringValue(input.Bucket)
+	if _, ok := f.buckets[bucket]; !ok {
+		return nil, newError(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist")
+	}
+	for name := range f.objects {
+		if strings.HasPrefix(name, bucket+"/") {
+			return nil, newError("BucketNotEmpty", "The bucket you tried to delete is not empty")
+		}
+	}
+	delete(f.buckets, bucket)
+
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+// Uploader is a fake S3 upload manager that writes to a fake S3.
+type Uploader struct {
+	s3manageriface.UploaderAPI
+
+	s3 *S3
+}
+
+func (u *Uploader) Upload(input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	return u.UploadWithContext(aws.BackgroundContext(), input)
+}
+
+func (u *Uploader) UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	body, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	u.s3.mu.Lock()
+	defer u.s3.mu.Unlock()
+
+	bucket := aws.StringValue(input.Bucket)
+	if _, ok := u.s3.buckets[bucket]; !ok {
+		return nil, newError(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist")
+	}
+	u.s3.objects[bucket+"/"+aws.StringValue(input.Key)] = body
+
+	return &s3manager.UploadOutput{Location: "https://" + bucket + ".s3.amazonaws.com/" + aws.StringValue(input.Key)}, nil
+}
+
+// STS is a fake STS that identifies every caller as the account's root user.
+type STS struct {
+	stsiface.STSAPI
+}
+
+func (f *STS) GetCallerIdentity(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(AccountID),
+		Arn:     aws.String(fmt.Sprintf("arn:aws:iam::%s:root", AccountID)),
+		UserId:  aws.String(AccountID),
+	}, nil
+}
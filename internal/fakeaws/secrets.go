@@ -0,0 +1,209 @@
+package fakeaws
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// SecretsManager is a fake Secrets Manager that keeps the latest value of
+// each secret.
+type SecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+
+	mu      sync.Mutex
+	region  string
+	created int
+	arns    map[string]string
+	values  map[string]string
+	version map[string]int
+}
+
+func newSecretsManager(region string) *SecretsManager {
+	return &SecretsManager{
+		region:  region,
+		arns:    map[string]string{},
+		values:  map[string]string{},
+		version: map[string]int{},
+	}
+}
+
+// SecretString returns the current value of the secret name and whether it
+// exists.
+func (f *SecretsManager) SecretString(name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	value, ok := f.values[name]
+	return value, ok
+}
+
+func (f *SecretsManager) CreateSecret(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.Name)
+	if _, ok := f.arns[name]; ok {
+		return nil, newError(secretsmanager.ErrCodeResourceExistsException, "The operation failed because the secret %s already exists.", name)
+	}
+
+	f.created++
+	f.arns[name] = fmt.Sprintf("arn:aws:secretsmanager:%s:%s:secret:%s-%06d", f.region, AccountID, name, f.created)
+	f.values[name] = aws.StringValue(input.SecretString)
+	f.version[name] = 1
+
+	return &secretsmanager.CreateSecretOutput{
+		ARN:       aws.String(f.arns[name]),
+		Name:      aws.String(name),
+		VersionId: aws.String(fmt.Sprintf("v%d", f.version[name])),
+	}, nil
+}
+
+func (f *SecretsManager) PutSecretValue(input *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := f.resolve(aws.StringValue(input.SecretId))
+	if _, ok := f.arns[name]; !ok {
+		return nil, newError(secretsmanager.ErrCodeResourceNotFoundException, "Secrets Manager can't find the specified secret.")
+	}
+
+	f.values[name] = aws.StringValue(input.SecretString)
+	f.version[name]++
+
+	return &secretsmanager.PutSecretValueOutput{
+		ARN:       aws.String(f.arns[name]),
+		Name:      aws.String(name),
+		VersionId: aws.String(fmt.Sprintf("v%d", f.version[name])),
+	}, nil
+}
+
+func (f *SecretsManager) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := f.resolve(aws.StringValue(input.SecretId))
+	if _, ok := f.arns[name]; !ok {
+		return nil, newError(secretsmanager.ErrCodeResourceNotFoundException, "Secrets Manager can't find the specified secret.")
+	}
+
+	return &secretsmanager.GetSecretValueOutput{
+		ARN:          aws.String(f.arns[name]),
+		Name:         aws.String(name),
+		SecretString: aws.String(f.values[name]),
+		VersionId:    aws.String(fmt.Sprintf("v%d", f.version[name])),
+	}, nil
+}
+
+func (f *SecretsManager) DeleteSecret(input *secretsmanager.DeleteSecretInput) (*secretsmanager.DeleteSecretOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := f.resolve(aws.StringValue(input.SecretId))
+	arn, ok := f.arns[name]
+	if !ok {
+		return nil, newError(secretsmanager.ErrCodeResourceNotFoundException, "Secrets Manager can't find the specified secret.")
+	}
+
+	// Secrets scheduled for deletion are removed right away, since nothing
+	// reads them in the meantime.
+	delete(f.arns, name)
+	delete(f.values, name)
+	delete(f.version, name)
+
+	return &secretsmanager.DeleteSecretOutput{ARN: aws.String(arn), Name: aws.String(name)}, nil
+}
+
+// resolve returns the name of the secret id, which is a name or an ARN.
+// f.mu must be held.
+func (f *SecretsManager) resolve(id string) string {
+	for name, arn := range f.arns {
+		if arn == id {
+			return name
+		}
+	}
+	return id
+}
+
+// SSM is a fake SSM Parameter Store.
+type SSM struct {
+	ssmiface.SSMAPI
+
+	mu         sync.Mutex
+	region     string
+	parameters map[string]*ssm.Parameter
+}
+
+func newSSM(region string) *SSM {
+	return &SSM{
+		region:     region,
+		parameters: map[string]*ssm.Parameter{},
+	}
+}
+
+// Parameter returns the value of the parameter name and whether it exists.
+func (f *SSM) Parameter(name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parameter, ok := f.parameters[name]
+	if !ok {
+		return "", false
+	}
+	return aws.StringValue(parameter.Value), true
+}
+
+func (f *SSM) PutParameter(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.Name)
+	parameter, ok := f.parameters[name]
+	if ok && !aws.BoolValue(input.Overwrite) {
+		return nil, newError(ssm.ErrCodeParameterAlreadyExists, "The parameter already exists. To overwrite this value, set the overwrite option in the request to true.")
+	}
+	if !ok {
+		parameter = &ssm.Parameter{
+			ARN:  aws.String(fmt.Sprintf("arn:aws:ssm:%s:%s:parameter%s", f.region, AccountID, name)),
+			Name: aws.String(name),
+		}
+		f.parameters[name] = parameter
+	}
+
+	parameter.Type = input.Type
+	parameter.Value = input.Value
+	parameter.Version = aws.Int64(aws.Int64Value(parameter.Version) + 1)
+
+	return &ssm.PutParameterOutput{Version: parameter.Version}, nil
+}
+
+func (f *SSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parameter, ok := f.parameters[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, newError(ssm.ErrCodeParameterNotFound, "Parameter %s not found.", aws.StringValue(input.Name))
+	}
+
+	copied := *parameter
+	return &ssm.GetParameterOutput{Parameter: &copied}, nil
+}
+
+func (f *SSM) DeleteParameter(input *ssm.DeleteParameterInput) (*ssm.DeleteParameterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.StringValue(input.Name)
+	if _, ok := f.parameters[name]; !ok {
+		return nil, newError(ssm.ErrCodeParameterNotFound, "Parameter %s not found.", name)
+	}
+	delete(f.parameters, name)
+
+	return &ssm.DeleteParameterOutput{}, nil
+}
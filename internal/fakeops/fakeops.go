@@ -0,0 +1,177 @@
+// Package fakeops stands in for the Ops SDK: prompts are answered from a
+// script and everything printed is recorded, so that the deploy flows can run
+// without a user.
+package fakeops
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"git.cto.ai/provision/internal/setup"
+	ctoai "github.com/cto-ai/sdk-go"
+)
+
+// Prompt answers prompts by name, in the order the answers were scripted. A
+// prompt without an answer left fails, so unexpected questions are caught.
+type Prompt struct {
+	mu      sync.Mutex
+	answers map[string][]interface{}
+	asked   []string
+}
+
+// NewPrompt returns a prompt with no answers scripted.
+func NewPrompt() *Prompt {
+	return &Prompt{answers: map[string][]interface{}{}}
+}
+
+// Answer queues answers for the prompt name. Answers must have the type the
+// prompt returns: string for Input, Secret and List, bool for Confirm, and int
+// for Number.
+func (p *Prompt) Answer(name string, answers ...interface{}) *Prompt {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.answers[name] = append(p.answers[name], answers...)
+	return p
+}
+
+// Asked returns the names of the prompts asked so far, in order.
+func (p *Prompt) Asked() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.asked...)
+}
+
+// Unused returns the names of the prompts that still have answers queued.
+func (p *Prompt) Unused() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var names []string
+	for name, answers := range p.answers {
+		if len(answers) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (p *Prompt) next(name, msg string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.asked = append(p.asked, name)
+
+	answers := p.answers[name]
+	if len(answers) == 0 {
+		return nil, fmt.Errorf("fakeops: no answer scripted for prompt %s (%q)", name, msg)
+	}
+	p.answers[name] = answers[1:]
+	return answers[0], nil
+}
+
+func (p *Prompt) nextString(name, msg string) (string, error) {
+	answer, err := p.next(name, msg)
+	if err != nil {
+		return "", err
+	}
+	value, ok := answer.(string)
+	if !ok {
+		return "", fmt.Errorf("fakeops: answer %v for prompt %s is a %T, not a string", answer, name, answer)
+	}
+	return value, nil
+}
+
+func (p *Prompt) Input(name, msg string, options ...ctoai.InputOption) (string, error) {
+	return p.nextString(name, msg)
+}
+
+func (p *Prompt) Secret(name, msg string, options ...ctoai.SecretOption) (string, error) {
+	return p.nextString(name, msg)
+}
+
+func (p *Prompt) List(name, msg string, choices []string, options ...ctoai.ListOption) (string, error) {
+	value, err := p.nextString(name, msg)
+	if err != nil {
+		return "", err
+	}
+
+	for _, choice := range choices {
+		if choice == value {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("fakeops: answer %q for prompt %s is not one of %q", value, name, choices)
+}
+
+func (p *Prompt) Confirm(name, msg string, options ...ctoai.ConfirmOption) (bool, error) {
+	answer, err := p.next(name, msg)
+	if err != nil {
+		return false, err
+	}
+	value, ok := answer.(bool)
+	if !ok {
+		return false, fmt.Errorf("fakeops: answer %v for prompt %s is a %T, not a bool", answer, name, answer)
+	}
+	return value, nil
+}
+
+func (p *Prompt) Number(name, msg string, options ...ctoai.NumberOption) (int, error) {
+	answer, err := p.next(name, msg)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := answer.(int)
+	if !ok {
+		return 0, fmt.Errorf("fakeops: answer %v for prompt %s is a %T, not an int", answer, name, answer)
+	}
+	return value, nil
+}
+
+// UX records everything printed to it.
+type UX struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (u *UX) Print(text string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.lines = append(u.lines, text)
+	return nil
+}
+
+// Lines returns everything printed so far, one entry per call to Print.
+func (u *UX) Lines() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return append([]string(nil), u.lines...)
+}
+
+// Output returns everything printed so far, one call to Print per line.
+func (u *UX) Output() string {
+	return strings.Join(u.Lines(), "\n")
+}
+
+// SDK reports the interface the Op runs in.
+type SDK struct {
+	InterfaceType string
+}
+
+func (s SDK) GetInterfaceType() string {
+	if s.InterfaceType == "" {
+		return "terminal"
+	}
+	return s.InterfaceType
+}
+
+// NewSDKClients returns clients that answer from prompt and record their
+// output in the returned UX.
+func NewSDKClients(prompt *Prompt) (*setup.SDKClients, *UX) {
+	ux := &UX{}
+	return &setup.SDKClients{Ux: ux, Prompt: prompt, Sdk: SDK{}}, ux
+}
@@ -0,0 +1,101 @@
+package files
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// bundleModTime is stamped on every bundle entry so that the same tree always
+// produces a byte-identical bundle.
+var bundleModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// writeBundle zips the contents of srcDir into dest. Entries are written in
+// lexical order with their file modes preserved; symlinks are stored as links
+// rather than followed.
+func writeBundle(srcDir, dest string) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(out)
+
+	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		return addBundleEntry(zw, path, filepath.ToSlash(rel), info)
+	})
+	if err != nil {
+		zw.Close()
+		out.Close()
+		return err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+func addBundleEntry(zw *zip.Writer, path, name string, info os.FileInfo) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: bundleModTime,
+	}
+	header.SetMode(info.Mode())
+
+	switch {
+	case info.IsDir():
+		header.Name += "/"
+		header.Method = zip.Store
+		_, err := zw.CreateHeader(header)
+		return err
+
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		header.Method = zip.Store
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, target)
+		return err
+
+	case !info.Mode().IsRegular():
+		return nil
+	}
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,168 @@
+package files
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTree creates a repository with a nested directory, an executable and a
+// symlink under dir.
+func writeTree(t *testing.T, dir string) {
+	t.Helper()
+
+	files := []struct {
+		name string
+		body string
+		mode os.FileMode
+	}{
+		{"package.json", "{}", 0644},
+		{"bin/start", "#!/bin/sh\n", 0755},
+		{"src/lib/app.js", "app", 0644},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f.name))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(f.body), f.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// WriteFile applies the umask.
+		err = os.Chmod(path, f.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"bin", "src", "src/lib"} {
+		err := os.Chmod(filepath.Join(dir, filepath.FromSlash(name)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.Symlink("src/lib/app.js", filepath.Join(dir, "app.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteBundleIsReproducible(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "repo")
+	writeTree(t, src)
+
+	first := filepath.Join(dir, "first.zip")
+	err := writeBundle(src, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A later run sees the same contents with different timestamps.
+	later := time.Now().Add(time.Hour)
+	err = os.Chtimes(filepath.Join(src, "package.json"), later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := filepath.Join(dir, "second.zip")
+	err = writeBundle(src, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstBytes, err := ioutil.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondBytes, err := ioutil.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(firstBytes, secondBytes) {
+		t.Errorf("bundles of the same tree differ")
+	}
+}
+
+func TestWriteBundleContents(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "repo")
+	writeTree(t, src)
+
+	dest := filepath.Join(dir, "bundle.zip")
+	err := writeBundle(src, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	want := []struct {
+		name string
+		mode os.FileMode
+		body string
+	}{
+		{"app.js", os.ModeSymlink | 0777, "src/lib/app.js"},
+		{"bin/", os.ModeDir | 0755, ""},
+		{"bin/start", 0755, "#!/bin/sh\n"},
+		{"package.json", 0644, "{}"},
+		{"src/", os.ModeDir | 0755, ""},
+		{"src/lib/", os.ModeDir | 0755, ""},
+		{"src/lib/app.js", 0644, "app"},
+	}
+
+	if len(r.File) != len(want) {
+		var names []string
+		for _, f := range r.File {
+			names = append(names, f.Name)
+		}
+		t.Fatalf("bundle has entries %v, want %d entries", names, len(want))
+	}
+
+	for i, f := range r.File {
+		w := want[i]
+		if f.Name != w.name {
+			t.Errorf("entry %d is %s, want %s", i, f.Name, w.name)
+			continue
+		}
+		// Symlink permissions depend on the platform.
+		mode := f.Mode()
+		if mode&os.ModeSymlink != 0 {
+			mode = os.ModeSymlink | 0777
+		}
+		if mode != w.mode {
+			t.Errorf("%s has mode %v, want %v", f.Name, mode, w.mode)
+		}
+		if !f.Modified.Equal(bundleModTime) {
+			t.Errorf("%s was modified at %v, want %v", f.Name, f.Modified, bundleModTime)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != w.body {
+			t.Errorf("%s contains %q, want %q", f.Name, body, w.body)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package files
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractLimits caps how much a downloaded repository archive may expand to.
+// Zero values fall back to DefaultExtractLimits.
+type ExtractLimits struct {
+	MaxBytes int64 `yaml:"max_bytes"`
+	MaxFiles int   `yaml:"max_files"`
+}
+
+// DefaultExtractLimits are applied when no limits are configured.
+var DefaultExtractLimits = ExtractLimits{
+	MaxBytes: 2 << 30,
+	MaxFiles: 100000,
+}
+
+func (l ExtractLimits) withDefaults() ExtractLimits {
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = DefaultExtractLimits.MaxBytes
+	}
+	if l.MaxFiles <= 0 {
+		l.MaxFiles = DefaultExtractLimits.MaxFiles
+	}
+	return l
+}
+
+// unzip extracts src into dest and returns the path of the repository root:
+// the single top-level directory of the archive if there is one, otherwise dest.
+// Entries that would land outside dest are rejected, and symlinks are created
+// only after every regular file has been written so they cannot redirect it.
+func unzip(src, dest string, limits ExtractLimits) (string, error) {
+	limits = limits.withDefaults()
+
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	if len(r.File) > limits.MaxFiles {
+		return "", fmt.Errorf("❗ Archive %s has %d entries, more than the limit of %d", filepath.Base(src), len(r.File), limits.MaxFiles)
+	}
+
+	err = os.MkdirAll(dest, os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+
+	var symlinks []*zip.File
+	var remaining = limits.MaxBytes
+	topLevel := map[string]bool{}
+
+	for _, f := range r.File {
+		name, err := sanitizeEntryName(f.Name)
+		if err != nil {
+			return "", err
+		}
+		topLevel[strings.SplitN(name, "/", 2)[0]] = true
+
+		fpath := filepath.Join(dest, filepath.FromSlash(name))
+
+		if f.FileInfo().IsDir() {
+			err = os.MkdirAll(fpath, os.ModePerm)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if f.Mode()&os.ModeSymlink != 0 {
+			symlinks = append(symlinks, f)
+			continue
+		}
+
+		if !f.Mode().IsRegular() {
+			return "", fmt.Errorf("❗ Archive entry %s is not a regular file", f.Name)
+		}
+
+		written, err := extractFile(f, fpath, remaining)
+		if err != nil {
+			return "", err
+		}
+		remaining -= written
+	}
+
+	for _, f := range symlinks {
+		err = extractSymlink(f, dest)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = verifySymlinks(symlinks, dest)
+	if err != nil {
+		return "", err
+	}
+
+	if len(topLevel) == 1 {
+		for dir := range topLevel {
+			root := filepath.Join(dest, dir)
+			info, err := os.Lstat(root)
+			if err == nil && info.IsDir() {
+				return root, nil
+			}
+		}
+	}
+
+	return dest, nil
+}
+
+// sanitizeEntryName returns the cleaned, slash separated name of an archive
+// entry, or an error if the entry would resolve outside the extraction root.
+func sanitizeEntryName(name string) (string, error) {
+	if strings.Contains(name, "\\") || path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("❗ Archive entry %s has an unsafe path", name)
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("❗ Archive entry %s has an unsafe path", name)
+	}
+
+	return cleaned, nil
+}
+
+func extractFile(f *zip.File, fpath string, remaining int64) (int64, error) {
+	err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm)
+	if err != nil {
+		return 0, err
+	}
+
+	outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	defer outFile.Close()
+
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	written, err := io.Copy(outFile, io.LimitReader(rc, remaining+1))
+	if err != nil {
+		return written, err
+	}
+	if written > remaining {
+		return written, fmt.Errorf("❗ Archive %s expands beyond the configured size limit", f.Name)
+	}
+
+	return written, outFile.Close()
+}
+
+// extractSymlink creates the link described by f, provided its target stays
+// inside dest.
+func extractSymlink(f *zip.File, dest string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	target, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	name := path.Clean(f.Name)
+	linkTarget := string(target)
+
+	if path.IsAbs(linkTarget) || filepath.IsAbs(linkTarget) || strings.Contains(linkTarget, "\\") {
+		return fmt.Errorf("❗ Archive symlink %s points outside the repository", f.Name)
+	}
+
+	resolved := path.Clean(path.Join(path.Dir(name), linkTarget))
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Errorf("❗ Archive symlink %s points outside the repository", f.Name)
+	}
+
+	fpath := filepath.Join(dest, filepath.FromSlash(name))
+	err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return os.Symlink(linkTarget, fpath)
+}
+
+// verifySymlinks resolves every extracted link on disk, catching links that
+// only escape dest when chained through another link. A link that does not
+// resolve is rejected too, since what it points at could be created later.
+func verifySymlinks(symlinks []*zip.File, dest string) error {
+	if len(symlinks) == 0 {
+		return nil
+	}
+
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range symlinks {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(dest, filepath.FromSlash(path.Clean(f.Name))))
+		if err != nil {
+			return fmt.Errorf("❗ Archive symlink %s does not resolve to a file in the repository", f.Name)
+		}
+
+		rel, err := filepath.Rel(realDest, resolved)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("❗ Archive symlink %s points outside the repository", f.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package files
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zipEntry is an entry of a test archive. A symlink's body is its target.
+type zipEntry struct {
+	name string
+	body string
+	mode os.FileMode
+}
+
+func file(name, body string) zipEntry {
+	return zipEntry{name: name, body: body, mode: 0644}
+}
+
+func symlink(name, target string) zipEntry {
+	return zipEntry{name: name, body: target, mode: os.ModeSymlink | 0777}
+}
+
+// writeZip writes entries to an archive in dir and returns its path.
+func writeZip(t *testing.T, dir string, entries ...zipEntry) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		header.SetMode(entry.mode)
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write([]byte(entry.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(dir, "repo.zip")
+	err = ioutil.WriteFile(src, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "extract-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestUnzipRejectsUnsafeArchives(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		limits  ExtractLimits
+		wantErr string
+	}{
+		{
+			name:    "parent directory entry",
+			entries: []zipEntry{file("../evil", "x")},
+			wantErr: "unsafe path",
+		},
+		{
+			name:    "entry climbing out of a directory",
+			entries: []zipEntry{file("repo/../../evil", "x")},
+			wantErr: "unsafe path",
+		},
+		{
+			name:    "absolute entry",
+			entries: []zipEntry{file("/tmp/evil", "x")},
+			wantErr: "unsafe path",
+		},
+		{
+			name:    "backslash entry",
+			entries: []zipEntry{file(`repo\..\..\evil`, "x")},
+			wantErr: "unsafe path",
+		},
+		{
+			name:    "symlink to an absolute path",
+			entries: []zipEntry{file("repo/a", "x"), symlink("repo/passwd", "/etc/passwd")},
+			wantErr: "points outside",
+		},
+		{
+			name:    "symlink escaping dest",
+			entries: []zipEntry{file("repo/a", "x"), symlink("repo/up", "../../evil")},
+			wantErr: "points outside",
+		},
+		{
+			name:    "symlink escaping dest through another symlink",
+			entries: []zipEntry{file("repo/a", "x"), symlink("repo/here", "."), symlink("repo/escape", "here/../..")},
+			wantErr: "points outside",
+		},
+		{
+			name:    "dangling symlink",
+			entries: []zipEntry{file("repo/a", "x"), symlink("repo/missing", "not-there")},
+			wantErr: "does not resolve",
+		},
+		{
+			name:    "dangling symlink escaping through another symlink",
+			entries: []zipEntry{file("repo/a", "x"), symlink("repo/here", "."), symlink("repo/escape", "here/../../evil")},
+			wantErr: "does not resolve",
+		},
+		{
+			name:    "too many entries",
+			entries: []zipEntry{file("repo/a", "x"), file("repo/b", "x"), file("repo/c", "x")},
+			limits:  ExtractLimits{MaxFiles: 2},
+			wantErr: "more than the limit",
+		},
+		{
+			name:    "oversized entry",
+			entries: []zipEntry{file("repo/big", strings.Repeat("x", 11))},
+			limits:  ExtractLimits{MaxBytes: 10},
+			wantErr: "size limit",
+		},
+		{
+			name:    "entries together over the size limit",
+			entries: []zipEntry{file("repo/a", strings.Repeat("x", 6)), file("repo/b", strings.Repeat("x", 6))},
+			limits:  ExtractLimits{MaxBytes: 10},
+			wantErr: "size limit",
+		},
+		{
+			name:    "decompression bomb",
+			entries: []zipEntry{file("repo/bomb", strings.Repeat("\x00", 16<<20))},
+			limits:  ExtractLimits{MaxBytes: 1 << 20},
+			wantErr: "size limit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+
+			src := writeZip(t, dir, tt.entries...)
+			_, err := unzip(src, filepath.Join(dir, "dest"), tt.limits)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("unzip() error = %v, want one containing %q", err, tt.wantErr)
+			}
+
+			_, err = os.Lstat(filepath.Join(dir, "evil"))
+			if !os.IsNotExist(err) {
+				t.Errorf("an entry was written outside dest")
+			}
+
+			info, err := os.Stat(filepath.Join(dir, "dest", "repo", "bomb"))
+			if err == nil && info.Size() > 1<<20+1 {
+				t.Errorf("bomb expanded to %d bytes", info.Size())
+			}
+		})
+	}
+}
+
+func TestUnzipExtractsRepository(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := writeZip(t, dir,
+		zipEntry{name: "repo-abc123/", mode: os.ModeDir | 0755},
+		zipEntry{name: "repo-abc123/bin/start", body: "#!/bin/sh\n", mode: 0755},
+		file("repo-abc123/lib/app.js", "app"),
+		symlink("repo-abc123/app.js", "lib/app.js"),
+	)
+
+	root, err := unzip(src, filepath.Join(dir, "dest"), ExtractLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "dest", "repo-abc123"); root != want {
+		t.Errorf("root = %s, want %s", root, want)
+	}
+
+	info, err := os.Stat(filepath.Join(root, "bin", "start"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("bin/start mode = %v, want 0755", info.Mode().Perm())
+	}
+
+	target, err := os.Readlink(filepath.Join(root, "app.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "lib/app.js" {
+		t.Errorf("app.js points at %s, want lib/app.js", target)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(root, "app.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "app" {
+		t.Errorf("app.js = %q, want %q", content, "app")
+	}
+}
+
+func TestUnzipWithoutSingleTopLevelDirectory(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := writeZip(t, dir, file("a/one", "1"), file("b/two", "2"))
+
+	dest := filepath.Join(dir, "dest")
+	root, err := unzip(src, dest, ExtractLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != dest {
+		t.Errorf("root = %s, want %s", root, dest)
+	}
+}
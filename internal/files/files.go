@@ -1,13 +1,12 @@
 package files
 
 import (
-	"archive/zip"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -16,29 +15,116 @@ import (
 	"git.cto.ai/provision/internal/setup"
 
 	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/platform"
 	ctoai "github.com/cto-ai/sdk-go"
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
 )
 
-func EBRepoFileSetup(ux *ctoai.Ux, githubRepoDetails setup.GithubRepoDetails, rdsBool bool, rdsDetails awsrds.RDSDetails) (string, error) {
-	githubDownloadLink, err := getDownloadLink(githubRepoDetails)
+// Repo is a downloaded repository that has been bundled for Elastic Beanstalk.
+type Repo struct {
+	// Dir is the unzipped repository; its bundle is written to Dir + ".zip".
+	Dir            string
+	CommitSHA      string
+	Platform       string
+	RuntimeVersion string
+
+	// workspace is the temp directory EBRepoFileSetup downloaded Dir into.
+	workspace string
+}
+
+// Cleanup removes the temp workspace the repository was downloaded into, which
+// holds the unzipped repository, its bundle and, with the plaintext credential
+// store, the database password. It does nothing for a repository that was not
+// downloaded by EBRepoFileSetup.
+func (r Repo) Cleanup() error {
+	if r.workspace == "" {
+		return nil
+	}
+	return os.RemoveAll(r.workspace)
+}
+
+// EBRepoFileSetup downloads the repository at the requested ref into a fresh temp
+// workspace and bundles it for Elastic Beanstalk. Unless githubRepoDetails names
+// a platform, it is detected from the repository contents. The caller removes
+// the workspace with Repo.Cleanup once the bundle has been uploaded.
+func EBRepoFileSetup(opsClients *setup.SDKClients, githubRepoDetails setup.GithubRepoDetails, rdsBool bool, rdsDetails awsrds.RDSDetails, limits ExtractLimits) (Repo, error) {
+	repo := Repo{Platform: githubRepoDetails.Platform}
+
+	ctx := context.Background()
+	client := newGithubClient(ctx, githubRepoDetails)
+
+	commitSHA, err := resolveRef(ctx, client, githubRepoDetails)
+	if err != nil {
+		return repo, err
+	}
+	repo.CommitSHA = commitSHA
+	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Deploying commit %s", commitSHA))
+
+	githubDownloadLink, err := getDownloadLink(ctx, client, githubRepoDetails, commitSHA)
 	if err != nil {
-		return "", err
+		return repo, err
 	}
 
-	err = download(ux, fmt.Sprintf("%s.zip", githubRepoDetails.Repo), githubDownloadLink)
+	repo.workspace, err = ioutil.TempDir("", "beanstalk-")
 	if err != nil {
-		return "", err
+		return repo, err
+	}
+
+	downloadedZip := filepath.Join(repo.workspace, fmt.Sprintf("%s.zip", githubRepoDetails.Repo))
+	err = download(opsClients.Ux, downloadedZip, githubDownloadLink)
+	if err != nil {
+		repo.Cleanup()
+		return repo, err
+	}
+
+	repo.Dir, err = unzip(downloadedZip, filepath.Join(repo.workspace, "src"), limits)
+	if err != nil {
+		repo.Cleanup()
+		return repo, err
+	}
+
+	repo, err = BundleRepo(opsClients, repo, rdsBool, rdsDetails)
+	if err != nil {
+		repo.Cleanup()
+		return repo, err
+	}
+
+	return repo, nil
+}
+
+// BundleRepo bundles the repository already unpacked in repo.Dir for Elastic
+// Beanstalk, detecting its platform unless repo.Platform is set. The bundle is
+// written to repo.Dir + ".zip".
+func BundleRepo(opsClients *setup.SDKClients, repo Repo, rdsBool bool, rdsDetails awsrds.RDSDetails) (Repo, error) {
+	var err error
+	if repo.Platform == "" {
+		repo.Platform, repo.RuntimeVersion, err = detectPlatform(opsClients, repo.Dir)
+		if err != nil {
+			return repo, err
+		}
 	}
 
-	unzippedRepo, err := unzip(fmt.Sprintf("%s.zip", githubRepoDetails.Repo))
+	repoPlatform, ok := platform.Lookup(repo.Platform)
+	if !ok {
+		return repo, fmt.Errorf("❗ Unsupported Elastic Beanstalk platform %s", repo.Platform)
+	}
+
+	err = repoPlatform.CheckBundle(repo.Dir)
 	if err != nil {
-		return unzippedRepo, err
+		return repo, err
 	}
 
 	if rdsBool {
 		content := fmt.Sprintf(`option_settings:
+  - option_name: RDS_SECRET_STORE
+    value: %s
+  - option_name: RDS_SECRET_ARN
+    value: %s`, rdsDetails.CredentialStore, rdsDetails.SecretARN)
+
+		// The password is only written into the bundle when explicitly requested.
+		if rdsDetails.CredentialStore == awsrds.CredentialStorePlaintext {
+			content = fmt.Sprintf(`option_settings:
   - option_name: RDS_HOSTNAME
     value: %s 
   - option_name: RDS_USERNAME 
@@ -49,30 +135,90 @@ func EBRepoFileSetup(ux *ctoai.Ux, githubRepoDetails setup.GithubRepoDetails, rd
     value: %s 
   - option_name: RDS_DB_NAME 
     value: %s`, rdsDetails.Host, rdsDetails.Username, rdsDetails.Password, rdsDetails.Port, rdsDetails.DBName)
+		}
 
-		err := createEBExtentions(content, unzippedRepo, "rds_env")
+		err := createEBExtentions(content, repo.Dir, "rds_env")
 		if err != nil {
-			return "", err
+			return repo, err
 		}
 	}
 
-	err = rezip(unzippedRepo)
+	err = rezip(repo.Dir)
 	if err != nil {
-		return unzippedRepo, err
+		return repo, err
 	}
 
-	return unzippedRepo, nil
+	return repo, nil
 }
 
-func getDownloadLink(githubRepoDetails setup.GithubRepoDetails) (string, error) {
+// detectPlatform proposes a platform and runtime version from the contents of
+// dir, prompting only when no single platform matches.
+func detectPlatform(opsClients *setup.SDKClients, dir string) (string, string, error) {
+	detections := platform.Detect(dir)
+
+	if len(detections) == 1 {
+		detection := detections[0]
+		if detection.RuntimeVersion != "" {
+			logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Detected platform %s, runtime version %s from %s", detection.Platform.Name, detection.RuntimeVersion, detection.Source))
+		} else {
+			logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Detected platform %s", detection.Platform.Name))
+		}
+		return detection.Platform.Name, detection.RuntimeVersion, nil
+	}
+
+	envPlatformChoices := platform.Names()
+	if len(detections) > 1 {
+		envPlatformChoices = nil
+		for _, detection := range detections {
+			envPlatformChoices = append(envPlatformChoices, detection.Platform.Name)
+		}
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  The repository matches several platforms: %s", strings.Join(envPlatformChoices, ", ")))
+	}
+
+	envPlatform, err := opsClients.Prompt.List("EB_ENV_PLATFORM", "Elastic Beanstalk Environment Platform", envPlatformChoices, ctoai.OptListDefaultValue(envPlatformChoices[0]), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, detection := range detections {
+		if detection.Platform.Name == envPlatform {
+			return envPlatform, detection.RuntimeVersion, nil
+		}
+	}
+
+	return envPlatform, "", nil
+}
+
+func newGithubClient(ctx context.Context, githubRepoDetails setup.GithubRepoDetails) *github.Client {
+	if githubRepoDetails.Token == "public" {
+		return github.NewClient(nil)
+	}
+
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: githubRepoDetails.Token},
+	)
+	return github.NewClient(oauth2.NewClient(ctx, ts))
+}
+
+// resolveRef resolves the branch, tag or SHA in githubRepoDetails.Ref to a full
+// commit SHA. An empty ref resolves to the head of the default branch.
+func resolveRef(ctx context.Context, client *github.Client, githubRepoDetails setup.GithubRepoDetails) (string, error) {
+	ref := githubRepoDetails.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	commitSHA, _, err := client.Repositories.GetCommitSHA1(ctx, githubRepoDetails.Username, githubRepoDetails.Repo, ref, "")
+	if err != nil {
+		return "", fmt.Errorf("❗ Unable to resolve ref %s of %s/%s: %v", ref, githubRepoDetails.Username, githubRepoDetails.Repo, err)
+	}
+
+	return commitSHA, nil
+}
+
+func getDownloadLink(ctx context.Context, client *github.Client, githubRepoDetails setup.GithubRepoDetails, commitSHA string) (string, error) {
 	if githubRepoDetails.Token != "public" {
-		ctx := context.Background()
-		ts := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: githubRepoDetails.Token},
-		)
-		tc := oauth2.NewClient(ctx, ts)
-		client := github.NewClient(tc)
-		s := github.RepositoryContentGetOptions{}
+		s := github.RepositoryContentGetOptions{Ref: commitSHA}
 
 		archiveLink, _, err := client.Repositories.GetArchiveLink(ctx, githubRepoDetails.Username, githubRepoDetails.Repo, github.Zipball, &s, false)
 		if err != nil {
@@ -82,10 +228,10 @@ func getDownloadLink(githubRepoDetails setup.GithubRepoDetails) (string, error)
 		return archiveLink.String(), nil
 	}
 
-	return fmt.Sprintf("http://github.com/%s/%s/zipball/master", githubRepoDetails.Username, githubRepoDetails.Repo), nil
+	return fmt.Sprintf("https://github.com/%s/%s/zipball/%s", githubRepoDetails.Username, githubRepoDetails.Repo, commitSHA), nil
 }
 
-func download(ux *ctoai.Ux, filepath string, url string) error {
+func download(ux logger.UX, filepath string, url string) error {
 	logger.LogSlack(ux, "🔄 Downloading repository files...")
 
 	resp, err := http.Get(url)
@@ -113,58 +259,8 @@ func download(ux *ctoai.Ux, filepath string, url string) error {
 	return err
 }
 
-func unzip(src string) (string, error) {
-	var filenames []string
-	r, err := zip.OpenReader(src)
-	if err != nil {
-		return "", err
-	}
-	defer r.Close()
-
-	for _, f := range r.File {
-		fpath := f.Name
-
-		filenames = append(filenames, fpath)
-
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, os.ModePerm)
-			continue
-		}
-
-		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-			return "", err
-		}
-
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return "", err
-		}
-
-		rc, err := f.Open()
-		if err != nil {
-			return "", err
-		}
-
-		_, err = io.Copy(outFile, rc)
-
-		outFile.Close()
-		rc.Close()
-
-		if err != nil {
-			return "", err
-		}
-	}
-
-	unzippedRepo := strings.Replace(filenames[0], "/", "", -1)
-
-	return unzippedRepo, nil
-}
-
 func rezip(dir string) error {
-	zipCmd := fmt.Sprintf("zip ../%s.zip -r * .[^.]*", dir)
-	cmd := exec.Command("sh", "-c", zipCmd)
-	cmd.Dir = fmt.Sprintf("./%s", dir)
-	err := cmd.Run()
+	err := writeBundle(dir, fmt.Sprintf("%s.zip", dir))
 	if err != nil {
 		return err
 	}
@@ -173,9 +269,9 @@ func rezip(dir string) error {
 }
 
 func createEBExtentions(content, unzippedRepo, extName string) error {
-	dirs := fmt.Sprintf("./%s/.ebextensions/", unzippedRepo)
+	dirs := filepath.Join(unzippedRepo, ".ebextensions")
 	os.MkdirAll(dirs, os.ModePerm)
-	f, err := os.Create(dirs + fmt.Sprintf("%s.config", extName))
+	f, err := os.Create(filepath.Join(dirs, fmt.Sprintf("%s.config", extName)))
 	if err != nil {
 		return err
 	}
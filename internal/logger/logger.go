@@ -2,11 +2,14 @@ package logger
 
 import (
 	"fmt"
-
-	ctoai "github.com/cto-ai/sdk-go"
 )
 
-func LogSlackError(ux *ctoai.Ux, err error) {
+// UX prints messages to the user. *ctoai.Ux implements it.
+type UX interface {
+	Print(text string) error
+}
+
+func LogSlackError(ux UX, err error) {
 	slackPrint := fmt.Sprintf("%v", err)
 	err = ux.Print(slackPrint)
 	if err != nil {
@@ -14,7 +17,7 @@ func LogSlackError(ux *ctoai.Ux, err error) {
 	}
 }
 
-func LogSlack(ux *ctoai.Ux, str string) {
+func LogSlack(ux UX, str string) {
 	err := ux.Print(str)
 	if err != nil {
 		fmt.Println(err)
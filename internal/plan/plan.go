@@ -0,0 +1,126 @@
+// Package plan describes the changes a deploy would make, so that they can be
+// reviewed before anything is created or updated.
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Change is what a deploy would do to a resource.
+type Change string
+
+// The changes a plan can list.
+const (
+	Create   Change = "create"
+	Update   Change = "update"
+	NoChange Change = "no-change"
+)
+
+// Formats a plan can be rendered in.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Formats are the formats that can be configured.
+var Formats = []string{FormatText, FormatJSON}
+
+// Options turn plan mode on and choose how the plan is rendered.
+type Options struct {
+	// Enabled shows the plan instead of deploying.
+	Enabled bool `yaml:"enabled"`
+	// Format is FormatText, the default, or FormatJSON.
+	Format string `yaml:"format"`
+}
+
+// Resource is a single resource in a plan.
+type Resource struct {
+	Change Change `json:"change"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Plan lists what a deploy would do, in the order it would do it.
+type Plan struct {
+	Action    string     `json:"action"`
+	Region    string     `json:"region"`
+	Resources []Resource `json:"resources"`
+	// Warnings are things the deploy would stop at, or could only decide
+	// once it runs.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// New returns an empty plan for action in region.
+func New(action, region string) *Plan {
+	return &Plan{Action: action, Region: region, Resources: []Resource{}}
+}
+
+// Add records that the deploy would apply change to the resource name of
+// resourceType. detail may be empty.
+func (p *Plan) Add(change Change, resourceType, name, detail string) {
+	p.Resources = append(p.Resources, Resource{Change: change, Type: resourceType, Name: name, Detail: detail})
+}
+
+// Warn records a warning.
+func (p *Plan) Warn(format string, args ...interface{}) {
+	p.Warnings = append(p.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Count returns the number of resources the deploy would apply change to.
+func (p *Plan) Count(change Change) int {
+	count := 0
+	for _, resource := range p.Resources {
+		if resource.Change == change {
+			count++
+		}
+	}
+	return count
+}
+
+// Render returns the plan in format, which defaults to FormatText.
+func (p *Plan) Render(format string) (string, error) {
+	switch format {
+	case "", FormatText:
+		return p.Text(), nil
+	case FormatJSON:
+		return p.JSON()
+	}
+	return "", fmt.Errorf("❗ Unsupported plan format %s", format)
+}
+
+// symbols mark each change in the text rendering, as in a diff.
+var symbols = map[Change]string{
+	Create:   "+",
+	Update:   "~",
+	NoChange: "=",
+}
+
+// Text renders the plan as a diff-style list of resources.
+func (p *Plan) Text() string {
+	lines := []string{fmt.Sprintf("📋 Plan for %s in %s:", p.Action, p.Region)}
+	for _, resource := range p.Resources {
+		line := fmt.Sprintf("   %s %-9s %s %s", symbols[resource.Change], resource.Change, resource.Type, resource.Name)
+		if resource.Detail != "" {
+			line += fmt.Sprintf(" (%s)", resource.Detail)
+		}
+		lines = append(lines, line)
+	}
+	for _, warning := range p.Warnings {
+		lines = append(lines, fmt.Sprintf("⚠️  %s", warning))
+	}
+	lines = append(lines, fmt.Sprintf("ℹ️  %d to create, %d to update, %d unchanged.", p.Count(Create), p.Count(Update), p.Count(NoChange)))
+
+	return strings.Join(lines, "\n")
+}
+
+// JSON renders the plan as an indented JSON document.
+func (p *Plan) JSON() (string, error) {
+	content, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -0,0 +1,98 @@
+package plan
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testPlan() *Plan {
+	p := New("Update Existing", "us-east-1")
+	p.Add(Create, "S3 bucket", "artifacts", "")
+	p.Add(Create, "S3 object", "s3://artifacts/demo/", "bundle of the new application version")
+	p.Add(NoChange, "Elastic Beanstalk application", "demo", "")
+	p.Add(Update, "Elastic Beanstalk environment", "production", "deploys the new version in place of v1")
+	p.Warn("rds.enabled is not set, so %s", "the database is asked for")
+	return p
+}
+
+func TestRenderText(t *testing.T) {
+	for _, format := range []string{"", FormatText} {
+		got, err := testPlan().Render(format)
+		if err != nil {
+			t.Fatalf("Render(%q) error = %v", format, err)
+		}
+
+		want := strings.Join([]string{
+			"📋 Plan for Update Existing in us-east-1:",
+			"   + create    S3 bucket artifacts",
+			"   + create    S3 object s3://artifacts/demo/ (bundle of the new application version)",
+			"   = no-change Elastic Beanstalk application demo",
+			"   ~ update    Elastic Beanstalk environment production (deploys the new version in place of v1)",
+			"⚠️  rds.enabled is not set, so the database is asked for",
+			"ℹ️  2 to create, 1 to update, 1 unchanged.",
+		}, "\n")
+		if got != want {
+			t.Errorf("Render(%q) =\n%s\nwant\n%s", format, got, want)
+		}
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	rendered, err := testPlan().Render(FormatJSON)
+	if err != nil {
+		t.Fatalf("Render(%q) error = %v", FormatJSON, err)
+	}
+
+	var got Plan
+	err = json.Unmarshal([]byte(rendered), &got)
+	if err != nil {
+		t.Fatalf("Render(%q) is not valid JSON: %v\n%s", FormatJSON, err, rendered)
+	}
+	if want := *testPlan(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Render(%q) decodes to %+v, want %+v", FormatJSON, got, want)
+	}
+
+	if !strings.Contains(rendered, `"change": "no-change"`) {
+		t.Errorf("Render(%q) does not name the change of each resource:\n%s", FormatJSON, rendered)
+	}
+	if strings.Count(rendered, `"detail"`) != 2 {
+		t.Errorf("Render(%q) lists empty details:\n%s", FormatJSON, rendered)
+	}
+}
+
+func TestRenderEmptyJSON(t *testing.T) {
+	rendered, err := New("Create New", "us-east-1").Render(FormatJSON)
+	if err != nil {
+		t.Fatalf("Render(%q) error = %v", FormatJSON, err)
+	}
+	if !strings.Contains(rendered, `"resources": []`) || strings.Contains(rendered, `"warnings"`) {
+		t.Errorf("Render(%q) of an empty plan =\n%s\nwant an empty resource list and no warnings", FormatJSON, rendered)
+	}
+}
+
+func TestCount(t *testing.T) {
+	p := testPlan()
+	tests := []struct {
+		change Change
+		want   int
+	}{
+		{Create, 2},
+		{Update, 1},
+		{NoChange, 1},
+	}
+	for _, tt := range tests {
+		if got := p.Count(tt.change); got != tt.want {
+			t.Errorf("Count(%s) = %d, want %d", tt.change, got, tt.want)
+		}
+	}
+}
+
+func TestRenderUnsupportedFormat(t *testing.T) {
+	_, err := testPlan().Render("yaml")
+	want := "Unsupported plan format yaml"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("Render(%q) error = %v, want one containing %q", "yaml", err, want)
+	}
+}
@@ -0,0 +1,151 @@
+package platform
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Detection is a platform that a repository appears to target.
+type Detection struct {
+	Platform Platform
+	// RuntimeVersion is the language runtime version the repository asks for,
+	// e.g. "18" for Node.js or "1.21" for Go. It is empty when unknown.
+	RuntimeVersion string
+	// Source names the file the runtime version was read from.
+	Source string
+}
+
+var (
+	firstVersionRegexp    = regexp.MustCompile(`\d+(\.\d+)*`)
+	goDirectiveRegexp     = regexp.MustCompile(`(?m)^go\s+(\d+(\.\d+)*)`)
+	pipfilePythonRegexp   = regexp.MustCompile(`(?m)^python_version\s*=\s*["'](\d+(\.\d+)*)["']`)
+	runtimeTxtRegexp      = regexp.MustCompile(`python-(\d+\.\d+)`)
+	pomJavaRegexp         = regexp.MustCompile(`<(?:java\.version|maven\.compiler\.release|maven\.compiler\.source)>\s*(?:1\.)?(\d+)`)
+	gemfileRubyRegexp     = regexp.MustCompile(`(?m)^ruby\s+["'][^\d]*(\d+(\.\d+)*)["']`)
+	csprojFrameworkRegexp = regexp.MustCompile(`<TargetFramework>net(?:coreapp)?(\d+(\.\d+)*)</TargetFramework>`)
+)
+
+// Detect inspects the repository in dir and returns every platform it appears
+// to target, in registry order.
+func Detect(dir string) []Detection {
+	var detections []Detection
+	for _, p := range registry {
+		if !p.Detect(dir) {
+			continue
+		}
+
+		runtimeVersion, source := detectRuntimeVersion(p.Name, dir)
+		detections = append(detections, Detection{
+			Platform:       p,
+			RuntimeVersion: runtimeVersion,
+			Source:         source,
+		})
+	}
+
+	return detections
+}
+
+// MatchesBranch reports whether the platform branch name runs runtimeVersion,
+// e.g. "Go 1 running on 64bit Amazon Linux 2023" runs "1.21".
+func (p Platform) MatchesBranch(branch, runtimeVersion string) bool {
+	if runtimeVersion == "" || !strings.HasPrefix(branch, p.BranchPrefix) {
+		return false
+	}
+
+	branchRuntime := strings.Fields(strings.TrimPrefix(branch, p.BranchPrefix))
+	if len(branchRuntime) == 0 {
+		return false
+	}
+
+	return runtimeVersion == branchRuntime[0] || strings.HasPrefix(runtimeVersion, branchRuntime[0]+".")
+}
+
+func detectRuntimeVersion(platformName, dir string) (string, string) {
+	switch platformName {
+	case "Node":
+		var packageJSON struct {
+			Engines map[string]string `json:"engines"`
+		}
+		if readJSON(filepath.Join(dir, "package.json"), &packageJSON) {
+			if version := firstVersionRegexp.FindString(packageJSON.Engines["node"]); version != "" {
+				return strings.Split(version, ".")[0], "package.json engines"
+			}
+		}
+
+	case "Go":
+		if version := findInFile(filepath.Join(dir, "go.mod"), goDirectiveRegexp); version != "" {
+			return version, "go.mod go directive"
+		}
+
+	case "Python":
+		if version := findInFile(filepath.Join(dir, "Pipfile"), pipfilePythonRegexp); version != "" {
+			return version, "Pipfile"
+		}
+		if version := findInFile(filepath.Join(dir, "runtime.txt"), runtimeTxtRegexp); version != "" {
+			return version, "runtime.txt"
+		}
+
+	case "Java":
+		if version := findInFile(filepath.Join(dir, "pom.xml"), pomJavaRegexp); version != "" {
+			return version, "pom.xml"
+		}
+
+	case "Ruby":
+		if version := findInFile(filepath.Join(dir, "Gemfile"), gemfileRubyRegexp); version != "" {
+			return majorMinor(version), "Gemfile"
+		}
+
+	case "PHP":
+		var composerJSON struct {
+			Require map[string]string `json:"require"`
+		}
+		if readJSON(filepath.Join(dir, "composer.json"), &composerJSON) {
+			if version := firstVersionRegexp.FindString(composerJSON.Require["php"]); version != "" {
+				return majorMinor(version), "composer.json"
+			}
+		}
+
+	case ".NET Core":
+		projects, _ := filepath.Glob(filepath.Join(dir, "*.csproj"))
+		for _, project := range projects {
+			if version := findInFile(project, csprojFrameworkRegexp); version != "" {
+				return strings.Split(version, ".")[0], filepath.Base(project)
+			}
+		}
+	}
+
+	return "", ""
+}
+
+func readJSON(path string, v interface{}) bool {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(content, v) == nil
+}
+
+// findInFile returns the first submatch of re in the file at path.
+func findInFile(path string, re *regexp.Regexp) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	match := re.FindSubmatch(content)
+	if len(match) < 2 {
+		return ""
+	}
+	return string(match[1])
+}
+
+func majorMinor(version string) string {
+	parts := strings.Split(version, ".")
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,122 @@
+package platform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []Detection
+	}{
+		{
+			name:  "nothing matching",
+			files: map[string]string{"README.md": "# demo"},
+		},
+		{
+			name:  "Node without engines",
+			files: map[string]string{"package.json": `{"name": "demo"}`},
+			want:  []Detection{{Platform: registry[0]}},
+		},
+		{
+			name:  "Node engines range",
+			files: map[string]string{"package.json": `{"engines": {"node": ">=18.12 <21"}}`},
+			want:  []Detection{{Platform: registry[0], RuntimeVersion: "18", Source: "package.json engines"}},
+		},
+		{
+			name:  "Go directive",
+			files: map[string]string{"go.mod": "module demo\n\ngo 1.21\n"},
+			want:  []Detection{{Platform: registry[1], RuntimeVersion: "1.21", Source: "go.mod go directive"}},
+		},
+		{
+			name:  "Python Pipfile",
+			files: map[string]string{"Pipfile": "[requires]\npython_version = \"3.11\"\n"},
+			want:  []Detection{{Platform: registry[2], RuntimeVersion: "3.11", Source: "Pipfile"}},
+		},
+		{
+			name:  "Python runtime.txt",
+			files: map[string]string{"requirements.txt": "flask\n", "runtime.txt": "python-3.9.7\n"},
+			want:  []Detection{{Platform: registry[2], RuntimeVersion: "3.9", Source: "runtime.txt"}},
+		},
+		{
+			name:  "Java pom.xml",
+			files: map[string]string{"pom.xml": "<project><properties><java.version>17</java.version></properties></project>"},
+			want:  []Detection{{Platform: registry[3], RuntimeVersion: "17", Source: "pom.xml"}},
+		},
+		{
+			name:  "Java pom.xml with a 1.x source",
+			files: map[string]string{"pom.xml": "<project><properties><maven.compiler.source>1.8</maven.compiler.source></properties></project>"},
+			want:  []Detection{{Platform: registry[3], RuntimeVersion: "8", Source: "pom.xml"}},
+		},
+		{
+			name:  "Ruby Gemfile",
+			files: map[string]string{"Gemfile": "source 'https://rubygems.org'\nruby '3.2.2'\n"},
+			want:  []Detection{{Platform: registry[5], RuntimeVersion: "3.2", Source: "Gemfile"}},
+		},
+		{
+			name:  "PHP composer.json",
+			files: map[string]string{"composer.json": `{"require": {"php": "^8.1"}}`},
+			want:  []Detection{{Platform: registry[6], RuntimeVersion: "8.1", Source: "composer.json"}},
+		},
+		{
+			name:  ".NET project",
+			files: map[string]string{"demo.csproj": "<Project><PropertyGroup><TargetFramework>net6.0</TargetFramework></PropertyGroup></Project>"},
+			want:  []Detection{{Platform: registry[7], RuntimeVersion: "6", Source: "demo.csproj"}},
+		},
+		{
+			name: "several platforms matching",
+			files: map[string]string{
+				"package.json": `{"engines": {"node": "20.x"}}`,
+				"Dockerfile":   "FROM node:20\n",
+			},
+			want: []Detection{
+				{Platform: registry[0], RuntimeVersion: "20", Source: "package.json engines"},
+				{Platform: registry[4]},
+			},
+		},
+		{
+			name:  "invalid package.json",
+			files: map[string]string{"package.json": `{"engines": `},
+			want:  []Detection{{Platform: registry[0]}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "detect-test-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			for name, content := range tt.files {
+				err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := Detect(dir)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Detect() = %d platforms %v, want %d", len(got), detectionNames(got), len(tt.want))
+			}
+			for i := range tt.want {
+				if got[i].Platform.Name != tt.want[i].Platform.Name || got[i].RuntimeVersion != tt.want[i].RuntimeVersion || got[i].Source != tt.want[i].Source {
+					t.Errorf("Detect()[%d] = %s %q from %q, want %s %q from %q", i, got[i].Platform.Name, got[i].RuntimeVersion, got[i].Source, tt.want[i].Platform.Name, tt.want[i].RuntimeVersion, tt.want[i].Source)
+				}
+			}
+		})
+	}
+}
+
+func detectionNames(detections []Detection) []string {
+	var names []string
+	for _, detection := range detections {
+		names = append(names, detection.Platform.Name)
+	}
+	return names
+}
@@ -0,0 +1,147 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OptionSetting is an Elastic Beanstalk configuration option applied when an
+// environment is created.
+type OptionSetting struct {
+	Namespace  string
+	OptionName string
+	Value      string
+}
+
+// Platform describes an Elastic Beanstalk platform the Op can deploy to.
+type Platform struct {
+	// Name is the name offered in prompts and accepted in the config file.
+	Name string
+	// BranchPrefix is the prefix of the platform's Elastic Beanstalk branch names.
+	BranchPrefix string
+	// OptionSettings are applied to new environments on this platform.
+	OptionSettings []OptionSetting
+	// RequiredFiles lists groups of glob patterns, relative to the bundle root.
+	// Every group needs at least one match for the bundle to be deployable.
+	RequiredFiles [][]string
+	// DetectFiles are glob patterns whose presence marks a repository as
+	// belonging to this platform.
+	DetectFiles []string
+}
+
+// registry holds every supported platform in the order they are offered.
+var registry = []Platform{
+	{
+		// Node.js platforms run "npm start" by default and no longer accept
+		// the aws:elasticbeanstalk:container:nodejs namespace.
+		Name:          "Node",
+		BranchPrefix:  "Node.js ",
+		RequiredFiles: [][]string{{"package.json", "Procfile"}},
+		DetectFiles:   []string{"package.json"},
+	},
+	{
+		Name:          "Go",
+		BranchPrefix:  "Go ",
+		RequiredFiles: [][]string{{"application.go", "Buildfile", "Procfile"}},
+		DetectFiles:   []string{"go.mod", "application.go"},
+	},
+	{
+		Name:         "Python",
+		BranchPrefix: "Python ",
+		OptionSettings: []OptionSetting{
+			{Namespace: "aws:elasticbeanstalk:container:python", OptionName: "WSGIPath", Value: "application"},
+		},
+		RequiredFiles: [][]string{{"application.py", "Procfile"}},
+		DetectFiles:   []string{"requirements.txt", "Pipfile", "setup.py"},
+	},
+	{
+		Name:          "Java",
+		BranchPrefix:  "Corretto ",
+		RequiredFiles: [][]string{{"*.jar", "Procfile", "Buildfile"}},
+		DetectFiles:   []string{"pom.xml", "build.gradle", "build.gradle.kts"},
+	},
+	{
+		Name:          "Docker",
+		BranchPrefix:  "Docker running ",
+		RequiredFiles: [][]string{{"Dockerfile", "Dockerrun.aws.json", "docker-compose.yml"}},
+		DetectFiles:   []string{"Dockerfile", "docker-compose.yml", "Dockerrun.aws.json"},
+	},
+	{
+		Name:          "Ruby",
+		BranchPrefix:  "Ruby ",
+		RequiredFiles: [][]string{{"Gemfile"}, {"config.ru", "Procfile"}},
+		DetectFiles:   []string{"Gemfile"},
+	},
+	{
+		Name:         "PHP",
+		BranchPrefix: "PHP ",
+		OptionSettings: []OptionSetting{
+			{Namespace: "aws:elasticbeanstalk:container:php:phpini", OptionName: "document_root", Value: "/"},
+		},
+		RequiredFiles: [][]string{{"*.php", "composer.json"}},
+		DetectFiles:   []string{"composer.json", "index.php"},
+	},
+	{
+		Name:          ".NET Core",
+		BranchPrefix:  ".NET ",
+		RequiredFiles: [][]string{{"*.runtimeconfig.json", "Procfile"}},
+		DetectFiles:   []string{"*.csproj", "*.sln"},
+	},
+}
+
+// Names returns the names of every supported platform.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for _, p := range registry {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// All returns every supported platform.
+func All() []Platform {
+	return append([]Platform(nil), registry...)
+}
+
+// Lookup returns the platform called name.
+func Lookup(name string) (Platform, bool) {
+	for _, p := range registry {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Platform{}, false
+}
+
+// Detect reports whether dir contains any of the platform's marker files.
+func (p Platform) Detect(dir string) bool {
+	return anyMatch(dir, p.DetectFiles)
+}
+
+// CheckBundle returns an error naming the files dir is missing to be deployed
+// on the platform.
+func (p Platform) CheckBundle(dir string) error {
+	for _, group := range p.RequiredFiles {
+		if !anyMatch(dir, group) {
+			return fmt.Errorf("❗ The %s platform requires one of %s in the repository root", p.Name, strings.Join(group, ", "))
+		}
+	}
+	return nil
+}
+
+func anyMatch(dir string, patterns []string) bool {
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			if _, err := os.Stat(match); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
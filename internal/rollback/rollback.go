@@ -0,0 +1,112 @@
+// Package rollback keeps track of how to undo the steps of a deploy, so that
+// the resources a failed deploy created can be removed again.
+package rollback
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"git.cto.ai/provision/internal/logger"
+)
+
+// Undo reverts a single step.
+type Undo func(ctx context.Context) error
+
+type action struct {
+	description string
+	undo        Undo
+}
+
+// Stack holds the undo actions of the steps completed so far. They are run in
+// the reverse order they were pushed in. A nil *Stack records nothing, so
+// callers that do not roll back can pass nil.
+type Stack struct {
+	mu      sync.Mutex
+	actions []action
+}
+
+// Push records undo as the way to revert the step that created description.
+func (s *Stack) Push(description string, undo Undo) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.actions = append(s.actions, action{description: description, undo: undo})
+}
+
+// Descriptions returns what the recorded actions undo, in the order they run.
+func (s *Stack) Descriptions() []string {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var descriptions []string
+	for i := len(s.actions) - 1; i >= 0; i-- {
+		descriptions = append(descriptions, s.actions[i].description)
+	}
+	return descriptions
+}
+
+// Len returns the number of recorded actions.
+func (s *Stack) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.actions)
+}
+
+// Run pops and runs every action, most recent first. An action that fails
+// does not stop the ones after it; the failures are reported together.
+func (s *Stack) Run(ctx context.Context, ux logger.UX) error {
+	var failed []string
+	total := s.Len()
+
+	for {
+		next, ok := s.pop()
+		if !ok {
+			break
+		}
+
+		logger.LogSlack(ux, fmt.Sprintf("🔄 Rolling back %s...", next.description))
+		err := next.undo(ctx)
+		if err != nil {
+			logger.LogSlackError(ux, err)
+			failed = append(failed, next.description)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("❗ Unable to roll back %d of %d steps: %v", len(failed), total, failed)
+	}
+
+	logger.LogSlack(ux, "✅ Rollback completed.")
+	return nil
+}
+
+func (s *Stack) pop() (action, bool) {
+	if s == nil {
+		return action{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.actions) == 0 {
+		return action{}, false
+	}
+
+	last := s.actions[len(s.actions)-1]
+	s.actions = s.actions[:len(s.actions)-1]
+	return last, true
+}
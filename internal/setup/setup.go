@@ -11,18 +11,46 @@ import (
 
 // SDK
 type SDKClients struct {
-	Ux     *ctoai.Ux
-	Prompt *ctoai.Prompt
-	Sdk    *ctoai.Sdk
+	Ux     logger.UX
+	Prompt Prompter
+	Sdk    SDK
+}
+
+// Prompter asks the user for values. *ctoai.Prompt implements it.
+type Prompter interface {
+	Input(name, msg string, options ...ctoai.InputOption) (string, error)
+	Secret(name, msg string, options ...ctoai.SecretOption) (string, error)
+	Confirm(name, msg string, options ...ctoai.ConfirmOption) (bool, error)
+	List(name, msg string, choices []string, options ...ctoai.ListOption) (string, error)
+	Number(name, msg string, options ...ctoai.NumberOption) (int, error)
+}
+
+// SDK describes the environment the Op runs in. *ctoai.Sdk implements it.
+type SDK interface {
+	GetInterfaceType() string
 }
 
 // GITHUB
 
 type GithubRepoDetails struct {
-	Username string
-	Token    string
-	Repo     string
-	Platform string
+	Username string `yaml:"username"`
+	Token    string `yaml:"token"`
+	Repo     string `yaml:"repo"`
+	Platform string `yaml:"platform"`
+	Private  *bool  `yaml:"private"`
+	Ref      string `yaml:"ref"`
+}
+
+// complete reports whether every Github value was provided up front, so no prompt is needed.
+// The platform is not required since it can be detected from the repository.
+func (g GithubRepoDetails) complete() bool {
+	if g.Username == "" || g.Repo == "" {
+		return false
+	}
+	if g.Private == nil {
+		return g.Token != ""
+	}
+	return !*g.Private || g.Token != ""
 }
 
 func PrintIntro(opsClients *SDKClients) error {
@@ -65,8 +93,8 @@ Requirements:
 	return nil
 }
 
-func GithubSetup(opsClients *SDKClients) (GithubRepoDetails, error) {
-	githubRepoDetails, err := promptGithubInfo(opsClients)
+func GithubSetup(opsClients *SDKClients, preset GithubRepoDetails) (GithubRepoDetails, error) {
+	githubRepoDetails, err := promptGithubInfo(opsClients, preset)
 	if err != nil {
 		return githubRepoDetails, err
 	}
@@ -76,15 +104,31 @@ func GithubSetup(opsClients *SDKClients) (GithubRepoDetails, error) {
 		githubRepoAccess = "Private"
 	}
 
-	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Github Information: \n   Username: %s\n   Repo: %s\n   RepoAccess: %s\n   Platform: %s", githubRepoDetails.Username, githubRepoDetails.Repo, githubRepoAccess, githubRepoDetails.Platform))
+	githubRepoRef := githubRepoDetails.Ref
+	if githubRepoRef == "" {
+		githubRepoRef = "(default branch)"
+	}
+
+	githubRepoPlatform := githubRepoDetails.Platform
+	if githubRepoPlatform == "" {
+		githubRepoPlatform = "(detected from the repository)"
+	}
+
+	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Github Information: \n   Username: %s\n   Repo: %s\n   Ref: %s\n   RepoAccess: %s\n   Platform: %s", githubRepoDetails.Username, githubRepoDetails.Repo, githubRepoRef, githubRepoAccess, githubRepoPlatform))
+
+	if preset.complete() {
+		return githubRepoDetails, nil
+	}
 
 	confirmGithubInfo, err := opsClients.Prompt.Confirm("GITHUB_BOOL", "Please confirm your Github Information", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
 	if err != nil {
 		return githubRepoDetails, err
 	}
 
+	// Every field is asked for again, since the rejected one may have come
+	// from preset and asking with the same preset would never change it.
 	if !confirmGithubInfo {
-		githubRepoDetails, err = GithubSetup(opsClients)
+		githubRepoDetails, err = GithubSetup(opsClients, GithubRepoDetails{Platform: preset.Platform})
 		if err != nil {
 			return githubRepoDetails, err
 		}
@@ -93,13 +137,33 @@ func GithubSetup(opsClients *SDKClients) (GithubRepoDetails, error) {
 	return githubRepoDetails, nil
 }
 
-func PromptEBAction(prompt *ctoai.Prompt) (string, error) {
-	elasticBeanstalkActionOptions := []string{
-		"Create New",
-		"Update Existing",
+// EBDetails holds the Elastic Beanstalk action and the application and environment it targets.
+type EBDetails struct {
+	Action          string `yaml:"action"`
+	AppName         string `yaml:"app"`
+	EnvName         string `yaml:"environment"`
+	PlatformBranch  string `yaml:"platform_branch"`
+	PlatformVersion string `yaml:"platform_version"`
+	RuntimeVersion  string `yaml:"runtime_version"`
+	InstanceProfile string `yaml:"instance_profile"`
+	// VersionLabel is the version Rollback deploys.
+	VersionLabel string `yaml:"version"`
+}
+
+// EBActionChoices are the actions the Op can perform on an Elastic Beanstalk application.
+var EBActionChoices = []string{
+	"Create New",
+	"Update Existing",
+	"Destroy",
+	"Rollback",
+}
+
+func PromptEBAction(prompt Prompter, preset string) (string, error) {
+	if preset != "" {
+		return preset, nil
 	}
 
-	elasticBeanstalkAction, err := prompt.List("EB_OP_OPTION", "Would you like to create a new Elastic Beanstalk Application, or update an existing one?", elasticBeanstalkActionOptions, ctoai.OptListDefaultValue("Create New"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
+	elasticBeanstalkAction, err := prompt.List("EB_OP_OPTION", "Would you like to create a new Elastic Beanstalk Application, update, roll back or destroy an existing one?", EBActionChoices, ctoai.OptListDefaultValue("Create New"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
 	if err != nil {
 		return "", err
 	}
@@ -107,48 +171,53 @@ func PromptEBAction(prompt *ctoai.Prompt) (string, error) {
 	return elasticBeanstalkAction, nil
 }
 
-func promptGithubInfo(opsClients *SDKClients) (GithubRepoDetails, error) {
-	githubRepoDetails := GithubRepoDetails{}
+func promptGithubInfo(opsClients *SDKClients, preset GithubRepoDetails) (GithubRepoDetails, error) {
+	githubRepoDetails := preset
 
-	githubUser, err := opsClients.Prompt.Input("GITHUB_USER_NAME", "Github Username", ctoai.OptInputAllowEmpty(false))
-	if err != nil {
-		logger.LogSlackError(opsClients.Ux, err)
-		return githubRepoDetails, err
+	var err error
+	if githubRepoDetails.Username == "" {
+		githubRepoDetails.Username, err = opsClients.Prompt.Input("GITHUB_USER_NAME", "Github Username", ctoai.OptInputAllowEmpty(false))
+		if err != nil {
+			logger.LogSlackError(opsClients.Ux, err)
+			return githubRepoDetails, err
+		}
 	}
-	githubRepoDetails.Username = githubUser
 
-	githubRepo, err := opsClients.Prompt.Input("GITHUB_REPO", "Github Repository", ctoai.OptInputAllowEmpty(false))
-	if err != nil {
-		logger.LogSlackError(opsClients.Ux, err)
-		return githubRepoDetails, err
+	if githubRepoDetails.Repo == "" {
+		githubRepoDetails.Repo, err = opsClients.Prompt.Input("GITHUB_REPO", "Github Repository", ctoai.OptInputAllowEmpty(false))
+		if err != nil {
+			logger.LogSlackError(opsClients.Ux, err)
+			return githubRepoDetails, err
+		}
 	}
-	githubRepoDetails.Repo = githubRepo
 
-	envPlatformChoices := []string{
-		"Node",
-		"Go",
-	}
-	envPlatform, err := opsClients.Prompt.List("EB_ENV_PLATFORM", "Elastic Beanstalk Environment Platform", envPlatformChoices, ctoai.OptListDefaultValue("Node"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
-	if err != nil {
-		logger.LogSlackError(opsClients.Ux, err)
-		return githubRepoDetails, err
+	if githubRepoDetails.Ref == "" && !preset.complete() {
+		githubRepoDetails.Ref, err = opsClients.Prompt.Input("GITHUB_REF", "Branch, tag or commit SHA to deploy (leave empty for the default branch)", ctoai.OptInputAllowEmpty(true))
+		if err != nil {
+			logger.LogSlackError(opsClients.Ux, err)
+			return githubRepoDetails, err
+		}
 	}
-	githubRepoDetails.Platform = envPlatform
 
-	githubRepoPrivate, err := opsClients.Prompt.Confirm("GITHUB_REPO_PUBLIC", "Is this a private repository?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
-	if err != nil {
-		logger.LogSlackError(opsClients.Ux, err)
-		return githubRepoDetails, err
+	githubRepoPrivate := githubRepoDetails.Token != ""
+	if githubRepoDetails.Private != nil {
+		githubRepoPrivate = *githubRepoDetails.Private
+	} else if !githubRepoPrivate {
+		githubRepoPrivate, err = opsClients.Prompt.Confirm("GITHUB_REPO_PUBLIC", "Is this a private repository?", ctoai.OptConfirmFlag("c"), ctoai.OptConfirmDefault(false))
+		if err != nil {
+			logger.LogSlackError(opsClients.Ux, err)
+			return githubRepoDetails, err
+		}
 	}
 
-	if githubRepoPrivate {
+	if !githubRepoPrivate {
+		githubRepoDetails.Token = "public"
+	} else if githubRepoDetails.Token == "" {
 		githubRepoDetails.Token, err = opsClients.Prompt.Secret("GITHUB_ACCESS_TOKEN", "Github Access Token", ctoai.OptSecretFlag("s"))
 		if err != nil {
 			logger.LogSlackError(opsClients.Ux, err)
 			return githubRepoDetails, err
 		}
-	} else {
-		githubRepoDetails.Token = "public"
 	}
 
 	return githubRepoDetails, err
@@ -156,43 +225,62 @@ func promptGithubInfo(opsClients *SDKClients) (GithubRepoDetails, error) {
 
 // AWS
 
-func PromptAWSInfo(prompt *ctoai.Prompt) (string, error) {
-	awsAccessKeyID, err := prompt.Secret("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID", ctoai.OptSecretFlag("s"))
-	if err != nil {
-		return "", err
+type AWSDetails struct {
+	Region string `yaml:"region"`
+}
+
+// AWSRegions are the regions offered when prompting for the AWS region.
+var AWSRegions = []string{"us-east-2",
+	"us-east-1",
+	"us-west-1",
+	"us-west-2",
+	"ap-east-1",
+	"ap-south-1",
+	"ap-northeast-3",
+	"ap-northeast-2",
+	"ap-southeast-1",
+	"ap-southeast-2",
+	"ap-northeast-1",
+	"ca-central-1",
+	"cn-north-1",
+	"cn-northwest-1",
+	"eu-central-1",
+	"eu-west-1",
+	"eu-west-2",
+	"eu-west-3",
+	"eu-north-1",
+	"me-south-1",
+	"sa-east-1",
+	"us-gov-east-1",
+	"us-gov-west-1"}
+
+// PromptAWSInfo prompts for the AWS credentials and region. Credentials already
+// present in the environment and a region given in preset are not prompted for.
+func PromptAWSInfo(prompt Prompter, preset AWSDetails) (string, error) {
+	var err error
+
+	awsAccessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	if awsAccessKeyID == "" {
+		awsAccessKeyID, err = prompt.Secret("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID", ctoai.OptSecretFlag("s"))
+		if err != nil {
+			return "", err
+		}
 	}
 
-	awsSecretAccessKey, err := prompt.Secret("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", ctoai.OptSecretFlag("s"))
-	if err != nil {
-		return "", err
+	awsSecretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if awsSecretAccessKey == "" {
+		awsSecretAccessKey, err = prompt.Secret("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", ctoai.OptSecretFlag("s"))
+		if err != nil {
+			return "", err
+		}
 	}
-	awsRegionChoices := []string{"us-east-2",
-		"us-east-1",
-		"us-west-1",
-		"us-west-2",
-		"ap-east-1",
-		"ap-south-1",
-		"ap-northeast-3",
-		"ap-northeast-2",
-		"ap-southeast-1",
-		"ap-southeast-2",
-		"ap-northeast-1",
-		"ca-central-1",
-		"cn-north-1",
-		"cn-northwest-1",
-		"eu-central-1",
-		"eu-west-1",
-		"eu-west-2",
-		"eu-west-3",
-		"eu-north-1",
-		"me-south-1",
-		"sa-east-1",
-		"us-gov-east-1",
-		"us-gov-west-1"}
-
-	awsRegion, err := prompt.List("AWS_REGION", "AWS Region", awsRegionChoices, ctoai.OptListDefaultValue("eu-west-1"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
-	if err != nil {
-		return "", err
+
+	awsRegion := preset.Region
+	if awsRegion == "" {
+		awsRegion, err = prompt.List("AWS_REGION", "AWS Region", AWSRegions, ctoai.OptListDefaultValue("eu-west-1"), ctoai.OptListFlag("L"), ctoai.OptListAutocomplete(false))
+		if err != nil {
+			return "", err
+		}
 	}
 
 	os.Setenv("AWS_ACCESS_KEY_ID", awsAccessKeyID)
@@ -202,8 +290,8 @@ func PromptAWSInfo(prompt *ctoai.Prompt) (string, error) {
 	return awsRegion, nil
 }
 
-func AWSSetup(prompt *ctoai.Prompt) (*session.Session, string, error) {
-	awsRegion, err := PromptAWSInfo(prompt)
+func AWSSetup(prompt Prompter, preset AWSDetails) (*session.Session, string, error) {
+	awsRegion, err := PromptAWSInfo(prompt, preset)
 	if err != nil {
 		return nil, "", err
 	}
@@ -0,0 +1,271 @@
+// Package state records the resources a deploy creates as it goes, so that a
+// deploy that fails partway can be resumed instead of creating them again.
+package state
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"git.cto.ai/provision/internal/awsrds"
+)
+
+// Step is a stage of a deploy. Steps are recorded once they have completed.
+type Step string
+
+// The steps of a new deploy, in the order they complete.
+const (
+	StepRDSCreated        Step = "rds_created"
+	StepCredentialsStored Step = "credentials_stored"
+	StepRDSAvailable      Step = "rds_available"
+	StepBundleUploaded    Step = "bundle_uploaded"
+	StepAccessGranted     Step = "access_granted"
+	StepAppCreated        Step = "app_created"
+	StepEnvCreated        Step = "env_created"
+	StepVersionCreated    Step = "version_created"
+	StepDatabaseConnected Step = "database_connected"
+	StepVersionDeployed   Step = "version_deployed"
+)
+
+// Statuses of a deployment.
+const (
+	StatusInProgress = "in_progress"
+	StatusComplete   = "complete"
+)
+
+// Deployment is the record of a single deploy. A nil *Deployment records
+// nothing, so callers that do not track state can pass nil.
+type Deployment struct {
+	Name      string    `json:"name"`
+	Action    string    `json:"action"`
+	Region    string    `json:"region"`
+	Status    string    `json:"status"`
+	Steps     []Step    `json:"steps"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Resources Resources `json:"resources"`
+
+	mu    sync.Mutex
+	store Store
+}
+
+// Resources are the resources created by a deploy and the values needed to
+// carry on from where it stopped.
+type Resources struct {
+	Bucket         string        `json:"bucket,omitempty"`
+	BundleKey      string        `json:"bundle_key,omitempty"`
+	AppName        string        `json:"app_name,omitempty"`
+	EnvName        string        `json:"env_name,omitempty"`
+	VersionLabel   string        `json:"version_label,omitempty"`
+	CommitSHA      string        `json:"commit_sha,omitempty"`
+	Platform       string        `json:"platform,omitempty"`
+	RuntimeVersion string        `json:"runtime_version,omitempty"`
+	RDS            *Database     `json:"rds,omitempty"`
+	IngressRules   []IngressRule `json:"ingress_rules,omitempty"`
+}
+
+func (r Resources) empty() bool {
+	return r.Bucket == "" && r.BundleKey == "" && r.AppName == "" && r.EnvName == "" && r.VersionLabel == "" && r.RDS == nil && len(r.IngressRules) == 0
+}
+
+// Database records an RDS database without its password, which stays in the
+// credential store.
+type Database struct {
+	DBName          string `json:"db_name"`
+	ClusterID       string `json:"cluster_id,omitempty"`
+	Platform        string `json:"platform"`
+	EngineVersion   string `json:"engine_version,omitempty"`
+	Username        string `json:"username"`
+	Host            string `json:"host,omitempty"`
+	Port            string `json:"port"`
+	SubnetGroup     string `json:"subnet_group"`
+	SecurityGroupID string `json:"security_group_id"`
+	CredentialStore string `json:"credential_store"`
+	SecretARN       string `json:"secret_arn,omitempty"`
+}
+
+// IngressRule is a security group rule that lets SourceGroupID reach Port of
+// GroupID.
+type IngressRule struct {
+	GroupID       string `json:"group_id"`
+	SourceGroupID string `json:"source_group_id"`
+	Port          int64  `json:"port"`
+}
+
+// NewDatabase returns the record of the database in rdsDetails.
+func NewDatabase(rdsDetails awsrds.RDSDetails) *Database {
+	return &Database{
+		DBName:          rdsDetails.DBName,
+		ClusterID:       rdsDetails.ClusterID,
+		Platform:        rdsDetails.Platform,
+		EngineVersion:   rdsDetails.EngineVersion,
+		Username:        rdsDetails.Username,
+		Host:            rdsDetails.Host,
+		Port:            rdsDetails.Port,
+		SubnetGroup:     rdsDetails.SubnetGroup,
+		SecurityGroupID: rdsDetails.SecurityGroupID,
+		CredentialStore: rdsDetails.CredentialStore,
+		SecretARN:       rdsDetails.SecretARN,
+	}
+}
+
+// Details returns the recorded database as RDSDetails. The password is left
+// empty.
+func (d *Database) Details() awsrds.RDSDetails {
+	enabled := true
+	return awsrds.RDSDetails{
+		Enabled:         &enabled,
+		DBName:          d.DBName,
+		ClusterID:       d.ClusterID,
+		Platform:        d.Platform,
+		EngineVersion:   d.EngineVersion,
+		Username:        d.Username,
+		Host:            d.Host,
+		Port:            d.Port,
+		SubnetGroup:     d.SubnetGroup,
+		SecurityGroupID: d.SecurityGroupID,
+		CredentialStore: d.CredentialStore,
+		SecretARN:       d.SecretARN,
+	}
+}
+
+// New starts the record of a deploy called name and saves it in store.
+func New(store Store, name, action, region string) (*Deployment, error) {
+	now := time.Now().UTC()
+	d := &Deployment{
+		Name:      name,
+		Action:    action,
+		Region:    region,
+		Status:    StatusInProgress,
+		StartedAt: now,
+		UpdatedAt: now,
+		store:     store,
+	}
+
+	return d, store.Save(d)
+}
+
+// Done reports whether step has completed.
+func (d *Deployment) Done(step Step) bool {
+	if d == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return containsStep(d.Steps, step)
+}
+
+// Get returns a copy of the recorded resources.
+func (d *Deployment) Get() Resources {
+	if d == nil {
+		return Resources{}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.Resources
+}
+
+// Complete marks step as completed, applies record to the resources, and
+// saves the deployment. record may be nil.
+func (d *Deployment) Complete(step Step, record func(*Resources)) error {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if record != nil {
+		record(&d.Resources)
+	}
+	if !containsStep(d.Steps, step) {
+		d.Steps = append(d.Steps, step)
+	}
+	d.UpdatedAt = time.Now().UTC()
+
+	return d.save()
+}
+
+// Undo marks steps as no longer completed once their resources are removed,
+// applies record to the resources, and saves the deployment. record may be
+// nil.
+func (d *Deployment) Undo(record func(*Resources), steps ...Step) error {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if record != nil {
+		record(&d.Resources)
+	}
+	var remaining []Step
+	for _, step := range d.Steps {
+		if !containsStep(steps, step) {
+			remaining = append(remaining, step)
+		}
+	}
+	d.Steps = remaining
+	d.UpdatedAt = time.Now().UTC()
+
+	return d.save()
+}
+
+// Discard deletes the deployment from its store, unless it still records
+// resources that a later run can resume with.
+func (d *Deployment) Discard() error {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.Resources.empty() {
+		return nil
+	}
+
+	err := d.store.Delete(d.Name)
+	if err != nil {
+		return fmt.Errorf("❗ Unable to delete the state of deployment %s: %v", d.Name, err)
+	}
+	return nil
+}
+
+// Finish marks the deployment as complete and saves it.
+func (d *Deployment) Finish() error {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.Status = StatusComplete
+	d.UpdatedAt = time.Now().UTC()
+
+	return d.save()
+}
+
+// save writes the deployment to its store. d.mu must be held.
+func (d *Deployment) save() error {
+	err := d.store.Save(d)
+	if err != nil {
+		return fmt.Errorf("❗ Unable to save the state of deployment %s: %v", d.Name, err)
+	}
+	return nil
+}
+
+func containsStep(steps []Step, step Step) bool {
+	for _, s := range steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
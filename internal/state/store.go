@@ -0,0 +1,182 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Backends deployments can be stored in.
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+)
+
+// Backends are the backends that can be configured.
+var Backends = []string{BackendS3, BackendLocal}
+
+// DefaultPath is the directory local state is kept in. It is only as
+// persistent as the container's /tmp: a remote run loses it once the run ends,
+// so resuming needs BackendS3 there, or a path that is kept between runs.
+const DefaultPath = "/tmp/beanstalk-state"
+
+// s3Prefix is the prefix of the state objects in the artifact bucket.
+const s3Prefix = "beanstalk-state/"
+
+// Options choose where deployments are stored.
+type Options struct {
+	// Backend is BackendS3, the default, or BackendLocal.
+	Backend string `yaml:"backend"`
+	// Path is the directory used by BackendLocal.
+	Path string `yaml:"path"`
+}
+
+// Store loads and saves deployments by name.
+type Store interface {
+	// Load returns the deployment name, or nil if there is none.
+	Load(name string) (*Deployment, error)
+	Save(d *Deployment) error
+	Delete(name string) error
+}
+
+// FileStore keeps each deployment in a JSON file in Dir.
+type FileStore struct {
+	Dir string
+}
+
+func (s FileStore) path(name string) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%s.json", name))
+}
+
+func (s FileStore) Load(name string) (*Deployment, error) {
+	content, err := ioutil.ReadFile(s.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return decode(s, content)
+}
+
+func (s FileStore) Save(d *Deployment) error {
+	content, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	// Writing to a temporary file first keeps the previous state intact if
+	// the Op is stopped halfway through the write.
+	tmp := s.path(d.Name) + ".tmp"
+	err = ioutil.WriteFile(tmp, content, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(d.Name))
+}
+
+func (s FileStore) Delete(name string) error {
+	err := os.Remove(s.path(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// S3Store keeps each deployment as a JSON object in Bucket.
+type S3Store struct {
+	Client s3iface.S3API
+	Bucket string
+}
+
+func (s S3Store) key(name string) string {
+	return fmt.Sprintf("%s%s.json", s3Prefix, name)
+}
+
+func (s S3Store) Load(name string) (*Deployment, error) {
+	result, err := s.Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == s3.ErrCodeNoSuchKey {
+				return nil, nil
+			}
+			return nil, aerr
+		}
+		return nil, err
+	}
+	defer result.Body.Close()
+
+	content, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(s, content)
+}
+
+func (s S3Store) Save(d *Deployment) error {
+	content, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.PutObject(&s3.PutObjectInput{
+		Body:                 bytes.NewReader(content),
+		Bucket:               aws.String(s.Bucket),
+		ContentType:          aws.String("application/json"),
+		Key:                  aws.String(s.key(d.Name)),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s S3Store) Delete(name string) error {
+	_, err := s.Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+		return err
+	}
+
+	return nil
+}
+
+// decode parses a saved deployment and attaches it to store.
+func decode(store Store, content []byte) (*Deployment, error) {
+	d := &Deployment{}
+	err := json.Unmarshal(content, d)
+	if err != nil {
+		return nil, fmt.Errorf("❗ Unable to parse the saved deployment state: %v", err)
+	}
+
+	d.store = store
+	return d, nil
+}
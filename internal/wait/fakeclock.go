@@ -0,0 +1,109 @@
+package wait
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a Clock whose time only moves when Advance is called, so that
+// waits can be driven without sleeping.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	added   chan struct{}
+}
+
+type fakeWaiter struct {
+	until time.Time
+	c     chan time.Time
+}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, added: make(chan struct{}, 1)}
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the time once the clock has been
+// advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	c.waiters = append(c.waiters, fakeWaiter{until: c.now.Add(d), c: ch})
+	select {
+	case c.added <- struct{}{}:
+	default:
+	}
+	return ch
+}
+
+// Advance moves the clock forward by d and fires every wake-up that is due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	pending := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.until.After(c.now) {
+			pending = append(pending, waiter)
+			continue
+		}
+		waiter.c <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns the number of wake-ups that have not fired yet.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil waits until at least n wake-ups are pending, which lets a test
+// advance the clock only once the code under test is waiting on it.
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		if c.Waiters() >= n {
+			return
+		}
+		<-c.added
+	}
+}
+
+// AdvanceWhileWaiting moves the clock forward by step whenever a poller waits
+// on it for its next attempt, until done receives the result of the code under
+// test, and returns that result. A poller with a Timeout keeps its deadline
+// pending throughout, so it is waiting for its next attempt once a second
+// wake-up is pending.
+func (c *FakeClock) AdvanceWhileWaiting(step time.Duration, done <-chan error) error {
+	for {
+		select {
+		case err := <-done:
+			return err
+		default:
+		}
+
+		if c.Waiters() >= 2 {
+			c.Advance(step)
+		} else {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
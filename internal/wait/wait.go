@@ -0,0 +1,181 @@
+// Package wait polls for long running AWS operations to finish, backing off
+// between attempts.
+package wait
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Clock tells the time and schedules wake-ups. Pollers use RealClock unless a
+// FakeClock is substituted, either in Poller.Clock or with WithClock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// RealClock is the system clock.
+var RealClock Clock = realClock{}
+
+type clockKey struct{}
+
+// WithClock returns a copy of ctx whose waits use clock, so that a test can
+// drive the waits of code it calls with a FakeClock.
+func WithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+// ClockFrom returns the clock set on ctx by WithClock, or RealClock.
+func ClockFrom(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return clock
+	}
+	return RealClock
+}
+
+// Backoff describes the delays between attempts. Each delay is Multiplier
+// times the previous one, starting at Initial and capped at Max, then spread
+// by up to Jitter (a fraction of the delay) in either direction. A Multiplier
+// below 1 is treated as 1, so that delays never shrink towards a busy loop.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// Constant returns a Backoff that always waits interval.
+func Constant(interval time.Duration) Backoff {
+	return Backoff{Initial: interval, Max: interval, Multiplier: 1}
+}
+
+// Delay returns the delay after attempt (counting from 1), given a random
+// number in [0, 1) for the jitter.
+func (b Backoff) Delay(attempt int, random float64) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(b.Initial)
+	for i := 1; i < attempt && multiplier > 1 && delay < float64(b.Max); i++ {
+		delay *= multiplier
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+
+	delay += delay * b.Jitter * (2*random - 1)
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
+
+// TimeoutError is returned by Poller.Until when the condition is not met in time.
+type TimeoutError struct {
+	Timeout  time.Duration
+	Attempts int
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v and %d attempts", e.Timeout, e.Attempts)
+}
+
+// Progress is called after every attempt that did not finish the wait, with
+// the number of attempts so far, the time spent waiting and the delay before
+// the next attempt.
+type Progress func(attempt int, elapsed, next time.Duration)
+
+// Poller calls a condition until it is met.
+type Poller struct {
+	Backoff Backoff
+	// Timeout bounds the whole wait. Zero means no limit beyond the context.
+	Timeout  time.Duration
+	Progress Progress
+	// Clock defaults to the clock set on the context with WithClock, and
+	// otherwise to RealClock.
+	Clock Clock
+	// Random returns numbers in [0, 1) for the jitter and defaults to math/rand.
+	Random func() float64
+}
+
+// Until calls condition until it returns true or an error, ctx is done, or the
+// poller's timeout passes. Condition errors are returned unchanged; ctx's error
+// is returned when it is done and a *TimeoutError when the timeout passes.
+func (p Poller) Until(ctx context.Context, condition func(attempt int) (bool, error)) error {
+	clock := p.Clock
+	if clock == nil {
+		clock = ClockFrom(ctx)
+	}
+	random := p.Random
+	if random == nil {
+		random = rand.Float64
+	}
+
+	start := clock.Now()
+	var deadline <-chan time.Time
+	if p.Timeout > 0 {
+		deadline = clock.After(p.Timeout)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		done, err := condition(attempt)
+		if err != nil || done {
+			return err
+		}
+
+		next := p.Backoff.Delay(attempt, random())
+		if p.Progress != nil {
+			p.Progress(attempt, clock.Now().Sub(start), next)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return &TimeoutError{Timeout: p.Timeout, Attempts: attempt}
+		case <-clock.After(next):
+		}
+	}
+}
+
+// WithInterrupt returns a copy of ctx that is cancelled when the process
+// receives SIGINT or SIGTERM, so that pending waits stop promptly. Only the
+// first signal is caught: a second one kills the process as usual, so that an
+// operator can still force-quit a cleanup that hangs. Calling the returned
+// function stops listening for the signals.
+func WithInterrupt(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
@@ -0,0 +1,255 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestBackoffDelayGrowsUpToMax(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		if got := b.Delay(i+1, 0.5); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestBackoffDelayJitterBounds(t *testing.T) {
+	b := Backoff{Initial: 10 * time.Second, Max: 10 * time.Second, Multiplier: 1, Jitter: 0.2}
+
+	for _, random := range []float64{0, 0.1, 0.25, 0.5, 0.75, 0.9, 0.999999} {
+		got := b.Delay(1, random)
+		if got < 8*time.Second || got >= 12*time.Second {
+			t.Errorf("Delay(1) with random %v = %v, want within [8s, 12s)", random, got)
+		}
+	}
+
+	if got := b.Delay(1, 0); got != 8*time.Second {
+		t.Errorf("Delay(1) with random 0 = %v, want 8s", got)
+	}
+	if got := b.Delay(1, 0.5); got != 10*time.Second {
+		t.Errorf("Delay(1) with random 0.5 = %v, want 10s", got)
+	}
+}
+
+func TestBackoffDelayMultiplierBelowOneDoesNotShrink(t *testing.T) {
+	for _, multiplier := range []float64{0, 0.5, 0.99} {
+		b := Backoff{Initial: 5 * time.Second, Max: time.Minute, Multiplier: multiplier}
+		for attempt := 1; attempt <= 20; attempt++ {
+			if got := b.Delay(attempt, 0.5); got != 5*time.Second {
+				t.Errorf("Delay(%d) with multiplier %v = %v, want 5s", attempt, multiplier, got)
+			}
+		}
+	}
+}
+
+func TestPollerUntilBacksOff(t *testing.T) {
+	clock := NewFakeClock(epoch)
+
+	var elapsed []time.Duration
+	poller := Poller{
+		Backoff: Backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2},
+		Clock:   clock,
+		Progress: func(attempt int, spent, next time.Duration) {
+			elapsed = append(elapsed, spent)
+		},
+	}
+
+	attempts := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- poller.Until(context.Background(), func(attempt int) (bool, error) {
+			attempts = attempt
+			return attempt == 3, nil
+		})
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(2 * time.Second)
+
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Errorf("condition was called %d times, want 3", attempts)
+	}
+	want := []time.Duration{0, time.Second}
+	if len(elapsed) != len(want) || elapsed[0] != want[0] || elapsed[1] != want[1] {
+		t.Errorf("progress reported %v elapsed, want %v", elapsed, want)
+	}
+}
+
+func TestPollerUntilReturnsConditionError(t *testing.T) {
+	failure := errors.New("failed")
+	poller := Poller{Backoff: Constant(time.Second), Clock: NewFakeClock(epoch)}
+
+	err := poller.Until(context.Background(), func(int) (bool, error) {
+		return false, failure
+	})
+	if err != failure {
+		t.Errorf("Until() = %v, want %v", err, failure)
+	}
+}
+
+func TestPollerUntilTimesOut(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	poller := Poller{Backoff: Constant(3 * time.Second), Timeout: 10 * time.Second, Clock: clock}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- poller.Until(context.Background(), func(int) (bool, error) {
+			return false, nil
+		})
+	}()
+
+	// Attempts run at 0s, 3s, 6s and 9s; the deadline and the next attempt
+	// are both pending between them.
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(2)
+		clock.Advance(3 * time.Second)
+	}
+	clock.BlockUntil(2)
+	clock.Advance(time.Second)
+
+	err := <-done
+	timeout, ok := err.(*TimeoutError)
+	if !ok {
+		t.Fatalf("Until() = %v, want a *TimeoutError", err)
+	}
+	if timeout.Timeout != 10*time.Second || timeout.Attempts != 4 {
+		t.Errorf("Until() = %v, want a 10s timeout after 4 attempts", timeout)
+	}
+}
+
+func TestPollerUntilStopsWhenCancelled(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	poller := Poller{Backoff: Constant(time.Minute), Clock: clock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- poller.Until(ctx, func(int) (bool, error) {
+			return false, nil
+		})
+	}()
+
+	clock.BlockUntil(1)
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Until() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestWithInterruptCancelsPendingWaits(t *testing.T) {
+	ctx, stop := WithInterrupt(context.Background())
+	defer stop()
+
+	clock := NewFakeClock(epoch)
+	poller := Poller{Backoff: Constant(time.Minute), Clock: clock}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- poller.Until(ctx, func(int) (bool, error) {
+			return false, nil
+		})
+	}()
+
+	clock.BlockUntil(1)
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = process.Signal(os.Interrupt)
+	if err != nil {
+		t.Skipf("cannot send an interrupt on this platform: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Until() = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the wait was not cancelled by the interrupt")
+	}
+}
+
+// interruptTwiceEnv makes the test binary interrupt itself twice instead of
+// running TestWithInterruptSecondSignalKills.
+const interruptTwiceEnv = "WAIT_TEST_INTERRUPT_TWICE"
+
+func TestWithInterruptSecondSignalKills(t *testing.T) {
+	if os.Getenv(interruptTwiceEnv) == "1" {
+		ctx, stop := WithInterrupt(context.Background())
+		defer stop()
+
+		process, _ := os.FindProcess(os.Getpid())
+		process.Signal(os.Interrupt)
+		<-ctx.Done()
+
+		process.Signal(os.Interrupt)
+		time.Sleep(5 * time.Second)
+		os.Exit(0)
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("a process cannot interrupt itself on windows")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestWithInterruptSecondSignalKills$")
+	cmd.Env = append(os.Environ(), interruptTwiceEnv+"=1")
+	err := cmd.Run()
+	if err == nil {
+		t.Fatal("the process survived a second interrupt")
+	}
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatal(err)
+	}
+}
+
+func TestWithClockIsUsedByPollers(t *testing.T) {
+	if ClockFrom(context.Background()) != RealClock {
+		t.Errorf("ClockFrom() without a clock is not RealClock")
+	}
+
+	clock := NewFakeClock(epoch)
+	ctx := WithClock(context.Background(), clock)
+	if ClockFrom(ctx) != clock {
+		t.Errorf("ClockFrom() did not return the clock set by WithClock")
+	}
+
+	poller := Poller{Backoff: Constant(time.Hour)}
+	done := make(chan error, 1)
+	go func() {
+		done <- poller.Until(ctx, func(attempt int) (bool, error) {
+			return attempt == 2, nil
+		})
+	}()
+
+	// An hour passes on the fake clock without any real waiting.
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the poller did not use the clock from the context")
+	}
+}
@@ -1,75 +1,514 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"git.cto.ai/provision/internal/awsclients"
 	"git.cto.ai/provision/internal/awseb"
+	"git.cto.ai/provision/internal/awsiam"
 	"git.cto.ai/provision/internal/awsrds"
 	"git.cto.ai/provision/internal/awss3"
 	"git.cto.ai/provision/internal/awsvpc"
+	"git.cto.ai/provision/internal/config"
 	"git.cto.ai/provision/internal/files"
 	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/rollback"
 	"git.cto.ai/provision/internal/setup"
+	"git.cto.ai/provision/internal/state"
+	"git.cto.ai/provision/internal/wait"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 	ctoai "github.com/cto-ai/sdk-go"
 )
 
-func newApp(opsClients *setup.SDKClients, awsSess *session.Session, githubRepoDetails setup.GithubRepoDetails, awsRegion string) error {
-	rdsDetails, rdsBool, err := awsrds.NewRDSSetup(opsClients, awsSess)
-	if err != nil {
+// services are what newApp and updateApp talk to besides the user. Fakes can
+// be substituted for both AWS and GitHub.
+type services struct {
+	aws awsclients.Clients
+	// fetchRepo downloads the repository and bundles it for Elastic Beanstalk.
+	fetchRepo func(opsClients *setup.SDKClients, githubRepoDetails setup.GithubRepoDetails, rdsBool bool, rdsDetails awsrds.RDSDetails, limits files.ExtractLimits) (files.Repo, error)
+}
+
+// newServices returns the services backed by awsSess and GitHub.
+func newServices(awsSess *session.Session, awsRegion string) services {
+	return services{
+		aws:       awsclients.New(awsSess, awsRegion),
+		fetchRepo: files.EBRepoFileSetup,
+	}
+}
+
+// rdsProvisioning waits in the background for a database created by
+// awsrds.NewRDSSetup, then saves its credentials.
+type rdsProvisioning struct {
+	done    chan struct{}
+	details awsrds.RDSDetails
+	err     error
+}
+
+// startRDSProvisioning starts waiting for the database in rdsDetails and
+// records it in deployment once it is available. If that fails, cancel is
+// called so that the rest of the deploy stops too.
+func startRDSProvisioning(ctx context.Context, cancel context.CancelFunc, ux logger.UX, clients awsclients.Clients, deployment *state.Deployment, rdsDetails awsrds.RDSDetails) *rdsProvisioning {
+	p := &rdsProvisioning{done: make(chan struct{})}
+
+	go func() {
+		defer close(p.done)
+
+		p.details, p.err = awsrds.WaitForRDS(ctx, ux, clients.RDS, rdsDetails)
+		if p.err == nil && p.details.SecretARN != "" {
+			p.details, p.err = awsrds.StoreCredentials(ux, clients, p.details)
+		}
+		if p.err == nil {
+			p.err = deployment.Complete(state.StepRDSAvailable, func(r *state.Resources) {
+				r.RDS = state.NewDatabase(p.details)
+			})
+		}
+		if p.err != nil {
+			cancel()
+		}
+	}()
+
+	return p
+}
+
+// wait blocks until the database is available. It may be called more than once.
+func (p *rdsProvisioning) wait() (awsrds.RDSDetails, error) {
+	<-p.done
+	return p.details, p.err
+}
+
+// cause returns the provisioning error if it has already failed, since err is
+// then most likely the cancellation it caused, and err otherwise.
+func (p *rdsProvisioning) cause(err error) error {
+	if p == nil {
 		return err
 	}
 
-	unzippedRepo, err := files.EBRepoFileSetup(opsClients.Ux, githubRepoDetails, rdsBool, rdsDetails)
+	select {
+	case <-p.done:
+		if p.err != nil {
+			return p.err
+		}
+	default:
+	}
+	return err
+}
+
+// newApp creates a new application, resuming the previous deploy of the same
+// application when it did not finish. If it fails, the user can choose to
+// roll back what this run created.
+func newApp(ctx context.Context, opsClients *setup.SDKClients, svc services, githubRepoDetails setup.GithubRepoDetails, awsRegion string, cfg config.Config) error {
+	undo := &rollback.Stack{}
+
+	deployment, err := openDeployment(opsClients, svc.aws, undo, githubRepoDetails, awsRegion, cfg)
+	if err == nil {
+		err = deployNewApp(ctx, opsClients, svc, deployment, undo, githubRepoDetails, awsRegion, cfg)
+	}
 	if err != nil {
+		rolledBack, rollbackErr := offerRollback(opsClients, undo)
+		if rollbackErr != nil {
+			logger.LogSlackError(opsClients.Ux, rollbackErr)
+		}
+		if !rolledBack && deployment != nil {
+			logger.LogSlack(opsClients.Ux, "ℹ️  Progress was saved; run the Op again to resume the deploy.")
+		}
 		return err
 	}
 
-	bucketName, err := awss3.EBS3Setup(opsClients.Ux, awsSess, unzippedRepo, awsRegion)
+	return deployment.Finish()
+}
+
+// offerRollback lists what undo would remove and runs it if the user agrees.
+// It reports whether the rollback was run.
+func offerRollback(opsClients *setup.SDKClients, undo *rollback.Stack) (bool, error) {
+	if undo.Len() == 0 {
+		return false, nil
+	}
+
+	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  This run created:\n   %s", strings.Join(undo.Descriptions(), "\n   ")))
+
+	confirmRollback, err := opsClients.Prompt.Confirm("ROLLBACK", "The deploy failed. Do you want to roll back everything this run created?", ctoai.OptConfirmFlag("b"), ctoai.OptConfirmDefault(false))
 	if err != nil {
-		return err
+		return false, err
 	}
+	if !confirmRollback {
+		return false, nil
+	}
+
+	// The deploy's context may have been cancelled by an interrupt, so the
+	// rollback gets its own.
+	ctx, stop := wait.WithInterrupt(context.Background())
+	defer stop()
+
+	return true, undo.Run(ctx, opsClients.Ux)
+}
 
-	envName, appName, err := awseb.NewEBAppSetup(opsClients.Ux, awsSess, bucketName, unzippedRepo, githubRepoDetails.Platform, awsRegion)
+// openDeployment returns the state of the deploy of the application, resuming
+// an unfinished one if the user agrees.
+func openDeployment(opsClients *setup.SDKClients, clients awsclients.Clients, undo *rollback.Stack, githubRepoDetails setup.GithubRepoDetails, awsRegion string, cfg config.Config) (*state.Deployment, error) {
+	bucketName, bucketCreated, err := awss3.EnsureArtifactBucket(opsClients.Ux, clients, awsRegion)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if bucketCreated {
+		undo.Push(fmt.Sprintf("S3 bucket %s", bucketName), func(ctx context.Context) error {
+			return awss3.DeleteBucketIfEmpty(opsClients.Ux, clients.S3, bucketName)
+		})
+	}
+
+	store := stateStore(clients, bucketName, cfg)
+
+	name := cfg.EB.AppName
+	if name == "" {
+		name = githubRepoDetails.Repo
+	}
+	name = fmt.Sprintf("%s-%s", name, awsRegion)
+
+	deployment, err := store.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if deployment != nil && deployment.Status == state.StatusInProgress {
+		lastStep := "none"
+		if len(deployment.Steps) > 0 {
+			lastStep = string(deployment.Steps[len(deployment.Steps)-1])
+		}
+
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  The deploy of %s started at %s did not finish.\nℹ️  Last completed step: %s", name, deployment.StartedAt.Format(time.RFC3339), lastStep))
+
+		resume, err := opsClients.Prompt.Confirm("STATE_RESUME", "Do you want to resume it instead of starting over?", ctoai.OptConfirmFlag("r"), ctoai.OptConfirmDefault(true))
+		if err != nil {
+			return nil, err
+		}
+		if !resume {
+			deployment = nil
+		}
 	}
 
-	ec2Client := ec2.New(awsSess)
-	EBEnvSecurityGroupID, err := awsvpc.DescribeEBEnvSecurityGroupID(ec2Client, envName)
+	if deployment == nil || deployment.Status != state.StatusInProgress {
+		deployment, err = state.New(store, name, "Create New", awsRegion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	undo.Push(fmt.Sprintf("deploy state of %s", name), func(ctx context.Context) error {
+		return deployment.Discard()
+	})
+
+	return deployment, nil
+}
+
+// stateStore returns the store deployments are kept in, which is bucketName
+// unless the config chooses the local backend.
+func stateStore(clients awsclients.Clients, bucketName string, cfg config.Config) state.Store {
+	switch cfg.State.Backend {
+	case state.BackendLocal:
+		dir := cfg.State.Path
+		if dir == "" {
+			dir = state.DefaultPath
+		}
+		return state.FileStore{Dir: dir}
+	default:
+		return state.S3Store{Client: clients.S3, Bucket: bucketName}
+	}
+}
+
+func deployNewApp(ctx context.Context, opsClients *setup.SDKClients, svc services, deployment *state.Deployment, undo *rollback.Stack, githubRepoDetails setup.GithubRepoDetails, awsRegion string, cfg config.Config) error {
+	rdsDetails, rdsBool, err := setupRDS(opsClients, svc.aws, deployment, undo, cfg.RDS)
 	if err != nil {
 		return err
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+
+	var database *rdsProvisioning
+	defer func() {
+		cancel()
+		if database != nil {
+			database.wait()
+		}
+	}()
+
 	if rdsBool {
-		err = awsvpc.AddEBSGToRDSSG(ec2Client, EBEnvSecurityGroupID, rdsDetails.SecurityGroupID)
+		if rdsDetails.CredentialStore != awsrds.CredentialStorePlaintext && !deployment.Done(state.StepCredentialsStored) {
+			// Saving the credentials now gives the bundle a secret ARN to
+			// reference while the database is still being created. The
+			// endpoint is added to the secret once it is known.
+			rdsDetails, err = awsrds.StoreCredentials(opsClients.Ux, svc.aws, rdsDetails)
+			if err != nil {
+				return err
+			}
+
+			err = deployment.Complete(state.StepCredentialsStored, func(r *state.Resources) {
+				r.RDS = state.NewDatabase(rdsDetails)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		database = startRDSProvisioning(ctx, cancel, opsClients.Ux, svc.aws, deployment, rdsDetails)
+
+		if rdsDetails.CredentialStore == awsrds.CredentialStorePlaintext {
+			logger.LogSlack(opsClients.Ux, "ℹ️  Waiting for the RDS database, since its plaintext endpoint is written into the application bundle...")
+			rdsDetails, err = database.wait()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	ebDetails := cfg.EB
+	var repoPlatform string
+	var appVersion awseb.AppVersion
+	if deployment.Done(state.StepBundleUploaded) {
+		resources := deployment.Get()
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Bundle %s was uploaded by an earlier run. \nℹ️  Skipping to next step...", resources.VersionLabel))
+
+		ebDetails.AppName = resources.AppName
+		if ebDetails.RuntimeVersion == "" {
+			ebDetails.RuntimeVersion = resources.RuntimeVersion
+		}
+		repoPlatform = resources.Platform
+		appVersion = awseb.AppVersion{
+			Label:     resources.VersionLabel,
+			CommitSHA: resources.CommitSHA,
+			S3Bucket:  resources.Bucket,
+			S3Key:     resources.BundleKey,
+		}
+	} else {
+		repo, err := svc.fetchRepo(opsClients, githubRepoDetails, rdsBool, rdsDetails, cfg.Limits)
 		if err != nil {
-			return err
+			return database.cause(err)
+		}
+		defer repo.Cleanup()
+
+		ebDetails.AppName = awseb.AppName(repo.Dir, cfg.EB)
+		if ebDetails.RuntimeVersion == "" {
+			ebDetails.RuntimeVersion = repo.RuntimeVersion
+		}
+		repoPlatform = repo.Platform
+		appVersion = awseb.AppVersion{
+			Label:     awseb.NewVersionLabel(repo.Dir),
+			CommitSHA: repo.CommitSHA,
+		}
+
+		appVersion.S3Bucket, appVersion.S3Key, err = awss3.EBS3Setup(opsClients.Ux, svc.aws, repo.Dir, ebDetails.AppName, appVersion.Label, awsRegion)
+		if err != nil {
+			return database.cause(err)
+		}
+
+		undo.Push(fmt.Sprintf("bundle s3://%s/%s", appVersion.S3Bucket, appVersion.S3Key), func(ctx context.Context) error {
+			err := awss3.DeleteBundle(opsClients.Ux, svc.aws.S3, appVersion.S3Bucket, appVersion.S3Key)
+			if err != nil {
+				return err
+			}
+			return deployment.Undo(func(r *state.Resources) {
+				r.Bucket = ""
+				r.BundleKey = ""
+				r.AppName = ""
+				r.VersionLabel = ""
+				r.CommitSHA = ""
+				r.Platform = ""
+				r.RuntimeVersion = ""
+			}, state.StepBundleUploaded)
+		})
+
+		err = deployment.Complete(state.StepBundleUploaded, func(r *state.Resources) {
+			r.Bucket = appVersion.S3Bucket
+			r.BundleKey = appVersion.S3Key
+			r.AppName = ebDetails.AppName
+			r.VersionLabel = appVersion.Label
+			r.CommitSHA = appVersion.CommitSHA
+			r.Platform = repo.Platform
+			r.RuntimeVersion = repo.RuntimeVersion
+		})
+		if err != nil {
+			return database.cause(err)
 		}
 	}
 
+	if !deployment.Done(state.StepAccessGranted) {
+		instanceProfile := awseb.InstanceProfile(ebDetails)
+		err = grantCredentialAccess(opsClients, svc.aws.IAM, instanceProfile, rdsBool, rdsDetails)
+		if err != nil {
+			return database.cause(err)
+		}
+
+		if rdsBool && rdsDetails.SecretARN != "" {
+			undo.Push(fmt.Sprintf("access of instance profile %s to %s", instanceProfile, rdsDetails.SecretARN), func(ctx context.Context) error {
+				err := awsiam.DeleteInstanceProfilePolicy(opsClients.Ux, svc.aws.IAM, instanceProfile, credentialPolicyName(rdsDetails))
+				if err != nil {
+					return err
+				}
+				return deployment.Undo(nil, state.StepAccessGranted)
+			})
+		}
+
+		err = deployment.Complete(state.StepAccessGranted, nil)
+		if err != nil {
+			return database.cause(err)
+		}
+	}
+
+	// The database is only needed once the environment exists, to let its
+	// instances reach the database before the application is deployed.
+	var connectDatabase func(envName string) error
+	if rdsBool {
+		connectDatabase = func(envName string) error {
+			rdsDetails, err := database.wait()
+			if err != nil {
+				return err
+			}
+
+			if deployment.Done(state.StepDatabaseConnected) {
+				return nil
+			}
+
+			EBEnvSecurityGroupID, err := awsvpc.DescribeEBEnvSecurityGroupID(svc.aws.EC2, envName)
+			if err != nil {
+				return err
+			}
+
+			rdsPort, err := strconv.ParseInt(rdsDetails.Port, 10, 64)
+			if err != nil {
+				return err
+			}
+
+			err = awsvpc.AddEBSGToRDSSG(svc.aws.EC2, EBEnvSecurityGroupID, rdsDetails.SecurityGroupID, rdsPort)
+			if err != nil {
+				return err
+			}
+
+			undo.Push(fmt.Sprintf("ingress from %s to %s", EBEnvSecurityGroupID, rdsDetails.SecurityGroupID), func(ctx context.Context) error {
+				err := awsvpc.RevokeEBSGFromRDSSG(svc.aws.EC2, EBEnvSecurityGroupID, rdsDetails.SecurityGroupID)
+				if err != nil {
+					return err
+				}
+				return deployment.Undo(func(r *state.Resources) {
+					var rules []state.IngressRule
+					for _, rule := range r.IngressRules {
+						if rule.SourceGroupID != EBEnvSecurityGroupID || rule.GroupID != rdsDetails.SecurityGroupID {
+							rules = append(rules, rule)
+						}
+					}
+					r.IngressRules = rules
+				}, state.StepDatabaseConnected)
+			})
+
+			return deployment.Complete(state.StepDatabaseConnected, func(r *state.Resources) {
+				r.IngressRules = append(r.IngressRules, state.IngressRule{
+					GroupID:       rdsDetails.SecurityGroupID,
+					SourceGroupID: EBEnvSecurityGroupID,
+					Port:          rdsPort,
+				})
+			})
+		}
+	}
+
+	_, appName, err := awseb.NewEBAppSetup(ctx, opsClients.Ux, svc.aws.EB, appVersion, repoPlatform, ebDetails, deployment, undo, connectDatabase)
+	if err != nil {
+		return database.cause(err)
+	}
+
 	logger.LogSlack(opsClients.Ux, fmt.Sprintf("🌐 Elastic Beanstalk Application: https://%s.console.aws.amazon.com/elasticbeanstalk/home?region=%s#/application/overview?applicationName=%s", awsRegion, awsRegion, appName))
 	return nil
 }
 
-func updateApp(opsClients *setup.SDKClients, awsSess *session.Session, githubRepoDetails setup.GithubRepoDetails, awsRegion string) error {
-	rdsDetails, rdsBool, err := awsrds.UpdateRDSSetup(opsClients, awsSess, awsRegion)
+// setupRDS creates the database, or picks up the one recorded in deployment
+// by an earlier run.
+func setupRDS(opsClients *setup.SDKClients, clients awsclients.Clients, deployment *state.Deployment, undo *rollback.Stack, preset awsrds.RDSDetails) (awsrds.RDSDetails, bool, error) {
+	if !deployment.Done(state.StepRDSCreated) {
+		rdsDetails, rdsBool, err := awsrds.NewRDSSetup(opsClients, clients, preset, undo)
+		if err != nil {
+			return rdsDetails, rdsBool, err
+		}
+
+		if rdsBool {
+			undo.Push(fmt.Sprintf("RDS database %s and its credentials", rdsDetails.DBName), func(ctx context.Context) error {
+				return deleteDatabase(ctx, opsClients, clients, deployment, rdsDetails)
+			})
+		}
+
+		err = deployment.Complete(state.StepRDSCreated, func(r *state.Resources) {
+			if rdsBool {
+				r.RDS = state.NewDatabase(rdsDetails)
+			}
+		})
+		return rdsDetails, rdsBool, err
+	}
+
+	resources := deployment.Get()
+	if resources.RDS == nil {
+		return awsrds.RDSDetails{}, false, nil
+	}
+
+	rdsDetails := resources.RDS.Details()
+	logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  RDS database %s was created by an earlier run. \nℹ️  Skipping to next step...", rdsDetails.DBName))
+
+	if preset.Password != "" {
+		rdsDetails.Password = preset.Password
+		return rdsDetails, true, nil
+	}
+
+	rdsDetails, err := awsrds.RecoverPassword(opsClients, clients, rdsDetails)
+	return rdsDetails, true, err
+}
+
+func updateApp(ctx context.Context, opsClients *setup.SDKClients, svc services, githubRepoDetails setup.GithubRepoDetails, awsRegion string, cfg config.Config) error {
+	ebDetails, err := awseb.UpdateEBInfo(opsClients, svc.aws.EB, cfg.EB)
+	if err != nil {
+		return err
+	}
+
+	rdsDetails, rdsBool, err := awsrds.UpdateRDSSetup(opsClients, svc.aws.RDS, cfg.RDS)
 	if err != nil {
 		return err
 	}
 
-	unzippedRepo, err := files.EBRepoFileSetup(opsClients.Ux, githubRepoDetails, rdsBool, rdsDetails)
+	if rdsBool && rdsDetails.DBName != "" {
+		rdsDetails, err = awsrds.StoreCredentials(opsClients.Ux, svc.aws, rdsDetails)
+		if err != nil {
+			return err
+		}
+
+		if rdsDetails.SecretARN != "" {
+			instanceProfile, err := awseb.EnvInstanceProfile(svc.aws.EB, ebDetails.AppName, ebDetails.EnvName)
+			if err != nil {
+				return err
+			}
+
+			err = grantCredentialAccess(opsClients, svc.aws.IAM, instanceProfile, rdsBool, rdsDetails)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	repo, err := svc.fetchRepo(opsClients, githubRepoDetails, rdsBool, rdsDetails, cfg.Limits)
 	if err != nil {
 		return err
 	}
+	defer repo.Cleanup()
+
+	appVersion := awseb.AppVersion{
+		Label:     awseb.NewVersionLabel(repo.Dir),
+		CommitSHA: repo.CommitSHA,
+	}
 
-	bucketName, err := awss3.EBS3Setup(opsClients.Ux, awsSess, unzippedRepo, awsRegion)
+	appVersion.S3Bucket, appVersion.S3Key, err = awss3.EBS3Setup(opsClients.Ux, svc.aws, repo.Dir, ebDetails.AppName, appVersion.Label, awsRegion)
 	if err != nil {
 		return err
 	}
 
-	appName, err := awseb.UpdateEBAppSetup(opsClients, awsSess, bucketName, unzippedRepo, awsRegion)
+	appName, err := awseb.UpdateEBAppSetup(ctx, opsClients, svc.aws.EB, appVersion, ebDetails)
 	if err != nil {
 		return err
 	}
@@ -78,7 +517,80 @@ func updateApp(opsClients *setup.SDKClients, awsSess *session.Session, githubRep
 	return nil
 }
 
+// rollbackApp points an environment back at a version that was deployed
+// before.
+func rollbackApp(ctx context.Context, opsClients *setup.SDKClients, svc services, awsRegion string, cfg config.Config) error {
+	ebDetails, err := awseb.PromptRollbackInfo(opsClients, svc.aws.EB, cfg.EB)
+	if err != nil {
+		return err
+	}
+
+	err = awseb.RollbackEnvironment(ctx, opsClients.Ux, svc.aws.EB, ebDetails.AppName, ebDetails.EnvName, ebDetails.VersionLabel)
+	if err != nil {
+		return err
+	}
+
+	logger.LogSlack(opsClients.Ux, fmt.Sprintf("🌐 Elastic Beanstalk Application: https://%s.console.aws.amazon.com/elasticbeanstalk/home?region=%s#/application/overview?applicationName=%s", awsRegion, awsRegion, ebDetails.AppName))
+	return nil
+}
+
+// deleteDatabase deletes the database in rdsDetails and its credentials once
+// the user confirms it, after taking a final snapshot. The DB subnet group and
+// security group created for it go too, once it is gone.
+func deleteDatabase(ctx context.Context, opsClients *setup.SDKClients, clients awsclients.Clients, deployment *state.Deployment, rdsDetails awsrds.RDSDetails) error {
+	confirmDelete, err := opsClients.Prompt.Confirm("ROLLBACK_RDS", fmt.Sprintf("Delete RDS database %s? A final snapshot is taken before it is deleted.", rdsDetails.DBName), ctoai.OptConfirmFlag("d"), ctoai.OptConfirmDefault(false))
+	if err != nil {
+		return err
+	}
+	if !confirmDelete {
+		logger.LogSlack(opsClients.Ux, fmt.Sprintf("ℹ️  Keeping RDS database %s and its credentials.", rdsDetails.DBName))
+		return nil
+	}
+
+	_, err = awsrds.DeleteRDS(ctx, opsClients.Ux, clients.RDS, rdsDetails)
+	if err != nil {
+		return err
+	}
+
+	err = awsrds.DeleteCredentials(opsClients.Ux, clients, rdsDetails)
+	if err != nil {
+		return err
+	}
+
+	err = deployment.Undo(func(r *state.Resources) {
+		r.RDS = nil
+	}, state.StepRDSCreated, state.StepCredentialsStored, state.StepRDSAvailable)
+	if err != nil {
+		return err
+	}
+
+	placement, err := awsrds.OwnPlacement(clients.EC2, rdsDetails)
+	if err != nil {
+		return err
+	}
+	return awsrds.DeletePlacement(ctx, opsClients.Ux, clients.RDS, clients.EC2, rdsDetails, placement)
+}
+
+// grantCredentialAccess lets instances running with instanceProfile read the
+// RDS credentials from the store they were saved in.
+func grantCredentialAccess(opsClients *setup.SDKClients, iamClient iamiface.IAMAPI, instanceProfile string, rdsBool bool, rdsDetails awsrds.RDSDetails) error {
+	if !rdsBool || rdsDetails.SecretARN == "" {
+		return nil
+	}
+
+	return awsiam.PutInstanceProfilePolicy(opsClients.Ux, iamClient, instanceProfile, credentialPolicyName(rdsDetails), awsrds.CredentialReadActions(rdsDetails.CredentialStore), rdsDetails.SecretARN)
+}
+
+// credentialPolicyName returns the name of the inline policy that grants
+// access to the credentials of the database in rdsDetails.
+func credentialPolicyName(rdsDetails awsrds.RDSDetails) string {
+	return fmt.Sprintf("beanstalk-rds-credentials-%s", rdsDetails.DBName)
+}
+
 func main() {
+	ctx, stop := wait.WithInterrupt(context.Background())
+	defer stop()
+
 	opsClients := setup.SDKClients{
 		Ux:     ctoai.NewUx(),
 		Prompt: ctoai.NewPrompt(),
@@ -91,35 +603,54 @@ func main() {
 		return
 	}
 
-	githubRepoDetails, err := setup.GithubSetup(&opsClients)
+	cfg, err := config.Load(config.Path())
 	if err != nil {
 		logger.LogSlackError(opsClients.Ux, err)
 		return
 	}
 
-	awsSess, awsRegion, err := setup.AWSSetup(opsClients.Prompt)
+	elasticBeanstalkAction, err := setup.PromptEBAction(opsClients.Prompt, cfg.EB.Action)
 	if err != nil {
 		logger.LogSlackError(opsClients.Ux, err)
 		return
 	}
 
-	elasticBeanstalkAction, err := setup.PromptEBAction(opsClients.Prompt)
+	// Destroy and Rollback only work with what is already in AWS, so they
+	// need no repository.
+	var githubRepoDetails setup.GithubRepoDetails
+	if elasticBeanstalkAction != "Destroy" && elasticBeanstalkAction != "Rollback" {
+		githubRepoDetails, err = setup.GithubSetup(&opsClients, cfg.Github)
+		if err != nil {
+			logger.LogSlackError(opsClients.Ux, err)
+			return
+		}
+	}
+
+	awsSess, awsRegion, err := setup.AWSSetup(opsClients.Prompt, cfg.AWS)
 	if err != nil {
 		logger.LogSlackError(opsClients.Ux, err)
 		return
 	}
 
-	if elasticBeanstalkAction == "Create New" {
-		err := newApp(&opsClients, awsSess, githubRepoDetails, awsRegion)
-		if err != nil {
-			logger.LogSlackError(opsClients.Ux, err)
-			return
-		}
-	} else {
-		err := updateApp(&opsClients, awsSess, githubRepoDetails, awsRegion)
-		if err != nil {
-			logger.LogSlackError(opsClients.Ux, err)
-			return
-		}
+	svc := newServices(awsSess, awsRegion)
+
+	switch {
+	case cfg.Plan.Enabled:
+		err = showPlan(&opsClients, svc, elasticBeanstalkAction, githubRepoDetails, awsRegion, cfg)
+	case elasticBeanstalkAction == "Create New":
+		err = newApp(ctx, &opsClients, svc, githubRepoDetails, awsRegion, cfg)
+	case elasticBeanstalkAction == "Destroy":
+		err = destroyApp(ctx, &opsClients, svc, awsRegion, cfg)
+	case elasticBeanstalkAction == "Rollback":
+		err = rollbackApp(ctx, &opsClients, svc, awsRegion, cfg)
+	default:
+		err = updateApp(ctx, &opsClients, svc, githubRepoDetails, awsRegion, cfg)
+	}
+	if errors.Is(err, context.Canceled) {
+		err = errors.New("❗ Interrupted. AWS operations already started keep running and can be followed in the AWS console.")
+	}
+	if err != nil {
+		logger.LogSlackError(opsClients.Ux, err)
+		return
 	}
 }
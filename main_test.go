@@ -0,0 +1,616 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"git.cto.ai/provision/internal/awseb"
+	"git.cto.ai/provision/internal/awsrds"
+	"git.cto.ai/provision/internal/awss3"
+	"git.cto.ai/provision/internal/awsvpc"
+	"git.cto.ai/provision/internal/config"
+	"git.cto.ai/provision/internal/fakeaws"
+	"git.cto.ai/provision/internal/fakeops"
+	"git.cto.ai/provision/internal/files"
+	"git.cto.ai/provision/internal/plan"
+	"git.cto.ai/provision/internal/setup"
+	"git.cto.ai/provision/internal/wait"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const testRegion = "us-east-1"
+
+var testRepoDetails = setup.GithubRepoDetails{Repo: "demo"}
+
+// testServices stands in for GitHub with a Node.js repository at commit,
+// unpacked under workspace, and for AWS with fake.
+type testServices struct {
+	workspace string
+	commit    string
+
+	mu      sync.Mutex
+	fetches int
+}
+
+func (s *testServices) services(fake *fakeaws.AWS) services {
+	return services{aws: fake.Clients(), fetchRepo: s.fetchRepo}
+}
+
+func (s *testServices) fetchRepo(opsClients *setup.SDKClients, githubRepoDetails setup.GithubRepoDetails, rdsBool bool, rdsDetails awsrds.RDSDetails, limits files.ExtractLimits) (files.Repo, error) {
+	s.mu.Lock()
+	s.fetches++
+	s.mu.Unlock()
+
+	dir := filepath.Join(s.workspace, "demo-"+s.commit)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return files.Repo{}, err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"name": "demo", "scripts": {"start": "node app.js"}}`), 0644)
+	if err != nil {
+		return files.Repo{}, err
+	}
+
+	return files.BundleRepo(opsClients, files.Repo{Dir: dir, CommitSHA: s.commit, Platform: "Node"}, rdsBool, rdsDetails)
+}
+
+func (s *testServices) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+// newTestAWS returns a fake AWS whose default VPC has private subnets in two
+// zones for the database.
+func newTestAWS() *fakeaws.AWS {
+	fake := fakeaws.New(testRegion)
+	fake.EC2.AddPrivateSubnet(fakeaws.DefaultVPCID, "a")
+	fake.EC2.AddPrivateSubnet(fakeaws.DefaultVPCID, "b")
+	return fake
+}
+
+func newTestServices(t *testing.T, commit string) *testServices {
+	t.Helper()
+
+	workspace, err := ioutil.TempDir("", "main-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServices{workspace: workspace, commit: commit}
+}
+
+func testConfig() config.Config {
+	var cfg config.Config
+	cfg.EB.AppName = "demo"
+	cfg.EB.EnvName = "production"
+	cfg.RDS = awsrds.RDSDetails{
+		Enabled:          aws.Bool(true),
+		DBName:           "demodb",
+		Platform:         "postgres",
+		Username:         "demo",
+		CredentialStore:  awsrds.CredentialStoreSecretsManager,
+		GeneratePassword: aws.Bool(true),
+	}
+	return cfg
+}
+
+// checkDeployed checks that the environment runs commit and can reach the
+// database through its credentials.
+func checkDeployed(t *testing.T, fake *fakeaws.AWS, commit string) {
+	t.Helper()
+
+	env := fake.EB.Environment("production")
+	if env == nil {
+		t.Fatal("environment production was not created")
+	}
+	if label := aws.StringValue(env.VersionLabel); !strings.HasPrefix(label, "demo-"+commit+"-") {
+		t.Errorf("environment runs version %s, want one of commit %s", label, commit)
+	}
+
+	if fake.RDS.DBInstance("demodb") == nil {
+		t.Error("database demodb was not created")
+	}
+	if _, ok := fake.SecretsManager.SecretString("beanstalk/rds/demodb"); !ok {
+		t.Error("credentials of demodb were not stored")
+	}
+}
+
+func TestNewAppDeploys(t *testing.T) {
+	fake := newTestAWS()
+	repos := newTestServices(t, "abc123")
+	defer os.RemoveAll(repos.workspace)
+
+	prompt := fakeops.NewPrompt()
+	opsClients, ux := fakeops.NewSDKClients(prompt)
+
+	err := newApp(context.Background(), opsClients, repos.services(fake), testRepoDetails, testRegion, testConfig())
+	if err != nil {
+		t.Fatalf("newApp() error = %v\n%s", err, ux.Output())
+	}
+
+	checkDeployed(t, fake, "abc123")
+	if len(prompt.Asked()) != 0 {
+		t.Errorf("prompts %v were asked, want none", prompt.Asked())
+	}
+	if !strings.Contains(ux.Output(), "🌐 Elastic Beanstalk Application:") {
+		t.Errorf("output does not link to the application:\n%s", ux.Output())
+	}
+}
+
+func TestUpdateAppDeploysNewVersion(t *testing.T) {
+	fake := newTestAWS()
+	repos := newTestServices(t, "abc123")
+	defer os.RemoveAll(repos.workspace)
+
+	opsClients, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+	err := newApp(context.Background(), opsClients, repos.services(fake), testRepoDetails, testRegion, testConfig())
+	if err != nil {
+		t.Fatalf("newApp() error = %v\n%s", err, ux.Output())
+	}
+
+	repos.commit = "def456"
+	prompt := fakeops.NewPrompt().Answer("RDS_DB_PASSWORD", "rotated-password", "rotated-password").
+		Answer("RDS_BOOL", true)
+	opsClients, ux = fakeops.NewSDKClients(prompt)
+	err = updateApp(context.Background(), opsClients, repos.services(fake), testRepoDetails, testRegion, testConfig())
+	if err != nil {
+		t.Fatalf("updateApp() error = %v\n%s", err, ux.Output())
+	}
+
+	checkDeployed(t, fake, "def456")
+	if len(prompt.Unused()) != 0 {
+		t.Errorf("prompts %v were not asked", prompt.Unused())
+	}
+
+	value, _ := fake.SecretsManager.SecretString("beanstalk/rds/demodb")
+	var secret struct {
+		Host     string `json:"host"`
+		Password string `json:"password"`
+	}
+	err = json.Unmarshal([]byte(value), &secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Host == "" || secret.Password != "rotated-password" {
+		t.Errorf("stored credentials = %s, want the endpoint of demodb and the entered password", value)
+	}
+}
+
+func TestNewAppFailsWhenDatabaseIsNotAvailable(t *testing.T) {
+	fake := newTestAWS()
+	fake.RDS.InitialStatus = "creating"
+	repos := newTestServices(t, "abc123")
+	defer os.RemoveAll(repos.workspace)
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx := wait.WithClock(context.Background(), clock)
+	prompt := fakeops.NewPrompt().Answer("ROLLBACK", false)
+	opsClients, ux := fakeops.NewSDKClients(prompt)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- newApp(ctx, opsClients, repos.services(fake), testRepoDetails, testRegion, testConfig())
+	}()
+
+	err := clock.AdvanceWhileWaiting(time.Minute, done)
+	want := "RDS database demodb was not available after 1h0m0s"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("newApp() error = %v, want one containing %q\n%s", err, want, ux.Output())
+	}
+
+	if len(prompt.Unused()) != 0 {
+		t.Errorf("the rollback was not offered")
+	}
+	if !strings.Contains(ux.Output(), "Progress was saved") {
+		t.Errorf("output does not say that progress was saved:\n%s", ux.Output())
+	}
+	if env := fake.EB.Environment("production"); env != nil && env.VersionLabel != nil {
+		t.Errorf("version %s was deployed without a database", aws.StringValue(env.VersionLabel))
+	}
+}
+
+// failingEnvironments fails to create any Elastic Beanstalk environment.
+type failingEnvironments struct {
+	*fakeaws.ElasticBeanstalk
+}
+
+func (failingEnvironments) CreateEnvironment(*elasticbeanstalk.CreateEnvironmentInput) (*elasticbeanstalk.EnvironmentDescription, error) {
+	return nil, errors.New("environment limit exceeded")
+}
+
+func TestNewAppRollbackDeletesDatabasePlacement(t *testing.T) {
+	fake := newTestAWS()
+	repos := newTestServices(t, "abc123")
+	defer os.RemoveAll(repos.workspace)
+
+	svc := repos.services(fake)
+	svc.aws.EB = failingEnvironments{fake.EB}
+	prompt := fakeops.NewPrompt().Answer("ROLLBACK", true).Answer("ROLLBACK_RDS", true)
+	opsClients, ux := fakeops.NewSDKClients(prompt)
+
+	err := newApp(context.Background(), opsClients, svc, testRepoDetails, testRegion, testConfig())
+	if err == nil || !strings.Contains(err.Error(), "environment limit exceeded") {
+		t.Fatalf("newApp() error = %v, want the environment creation error\n%s", err, ux.Output())
+	}
+
+	if len(prompt.Unused()) != 0 {
+		t.Fatalf("prompts %v were not asked\n%s", prompt.Unused(), ux.Output())
+	}
+	if fake.RDS.DBInstance("demodb") != nil {
+		t.Error("database demodb was not deleted")
+	}
+	if fake.RDS.SubnetGroup(awsrds.SubnetGroupName("demodb")) != nil {
+		t.Error("DB subnet group demodb-subnets was not deleted")
+	}
+	groupID, err := awsvpc.FindSecurityGroup(fake.EC2, fakeaws.DefaultVPCID, awsrds.SecurityGroupName("demodb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groupID != "" {
+		t.Errorf("security group %s was not deleted", groupID)
+	}
+	if strings.Contains(ux.Output(), "Unable to roll back") {
+		t.Errorf("rollback failed:\n%s", ux.Output())
+	}
+}
+
+func TestNewAppResumesAfterInterrupt(t *testing.T) {
+	fake := newTestAWS()
+	fake.RDS.InitialStatus = "creating"
+	repos := newTestServices(t, "abc123")
+	defer os.RemoveAll(repos.workspace)
+
+	clock := wait.NewFakeClock(time.Now())
+	ctx, stop := wait.WithInterrupt(wait.WithClock(context.Background(), clock))
+	defer stop()
+
+	prompt := fakeops.NewPrompt().Answer("ROLLBACK", false)
+	opsClients, ux := fakeops.NewSDKClients(prompt)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- newApp(ctx, opsClients, repos.services(fake), testRepoDetails, testRegion, testConfig())
+	}()
+
+	// Interrupt the run once the environment exists and the deploy waits
+	// for the database.
+	for fake.EB.Environment("production") == nil {
+		select {
+		case err := <-done:
+			t.Fatalf("newApp() returned %v before the environment was created\n%s", err, ux.Output())
+		case <-time.After(time.Millisecond):
+		}
+	}
+	clock.BlockUntil(2)
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = process.Signal(os.Interrupt)
+	if err != nil {
+		t.Skipf("cannot send an interrupt on this platform: %v", err)
+	}
+
+	err = <-done
+	if err != context.Canceled {
+		t.Fatalf("newApp() error = %v, want %v\n%s", err, context.Canceled, ux.Output())
+	}
+
+	// The database becomes available while nothing is running, and the
+	// next run picks up where the interrupted one stopped.
+	fake.RDS.SetStatus("demodb", "available")
+
+	prompt = fakeops.NewPrompt().Answer("STATE_RESUME", true)
+	opsClients, ux = fakeops.NewSDKClients(prompt)
+	err = newApp(context.Background(), opsClients, repos.services(fake), testRepoDetails, testRegion, testConfig())
+	if err != nil {
+		t.Fatalf("resumed newApp() error = %v\n%s", err, ux.Output())
+	}
+
+	checkDeployed(t, fake, "abc123")
+	if len(prompt.Unused()) != 0 {
+		t.Errorf("the resume was not offered")
+	}
+	if n := repos.fetchCount(); n != 1 {
+		t.Errorf("repository was fetched %d times, want once", n)
+	}
+	for _, skipped := range []string{"RDS database demodb was created by an earlier run", "was uploaded by an earlier run"} {
+		if !strings.Contains(ux.Output(), skipped) {
+			t.Errorf("output does not contain %q:\n%s", skipped, ux.Output())
+		}
+	}
+}
+
+func TestDestroyAppRemovesDeployedApp(t *testing.T) {
+	tests := []struct {
+		name           string
+		deleteDatabase bool
+	}{
+		{name: "keeping the database", deleteDatabase: false},
+		{name: "deleting the database", deleteDatabase: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newTestAWS()
+			repos := newTestServices(t, "abc123")
+			defer os.RemoveAll(repos.workspace)
+
+			opsClients, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+			err := newApp(context.Background(), opsClients, repos.services(fake), testRepoDetails, testRegion, testConfig())
+			if err != nil {
+				t.Fatalf("newApp() error = %v\n%s", err, ux.Output())
+			}
+			rdsGroupID, err := awsvpc.FindSecurityGroup(fake.EC2, fakeaws.DefaultVPCID, awsrds.SecurityGroupName("demodb"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.EC2.IngressRules(rdsGroupID)) == 0 {
+				t.Fatal("the environment was not let into the database")
+			}
+
+			prompt := fakeops.NewPrompt().Answer("DESTROY_CONFIRM", true).Answer("DESTROY_RDS", tt.deleteDatabase)
+			opsClients, ux = fakeops.NewSDKClients(prompt)
+			err = destroyApp(context.Background(), opsClients, repos.services(fake), testRegion, testConfig())
+			if err != nil {
+				t.Fatalf("destroyApp() error = %v\n%s", err, ux.Output())
+			}
+			if len(prompt.Unused()) != 0 {
+				t.Errorf("prompts %v were not asked", prompt.Unused())
+			}
+			listed := "RDS database demodb, then its DB subnet group demodb-subnets and security group " + rdsGroupID
+			if !strings.Contains(ux.Output(), listed) {
+				t.Errorf("output does not list %q:\n%s", listed, ux.Output())
+			}
+
+			if exists, err := awseb.ApplicationExists(fake.EB, "demo"); err != nil || exists {
+				t.Errorf("ApplicationExists() = %v, %v after destroy, want false", exists, err)
+			}
+			if fake.EB.Environment("production") != nil {
+				t.Error("environment production was not terminated")
+			}
+			// The bundles and the deploy state are kept in the artifact
+			// bucket, which is only deleted once it is empty.
+			bucket, err := awss3.ArtifactBucketName(fake.STS, testRegion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists, err := awss3.BucketExists(fake.S3, bucket); err != nil || exists {
+				t.Errorf("BucketExists(%s) = %v, %v after destroy, want false", bucket, exists, err)
+			}
+			if rules := fake.EC2.IngressRules(rdsGroupID); len(rules) != 0 {
+				t.Errorf("security group %s still has ingress rules %v", rdsGroupID, rules)
+			}
+
+			snapshot := regexp.MustCompile(`Final snapshot: (\S+)`).FindStringSubmatch(ux.Output())
+			if !tt.deleteDatabase {
+				if fake.RDS.DBInstance("demodb") == nil {
+					t.Error("database demodb was deleted")
+				}
+				if snapshot != nil {
+					t.Errorf("final snapshot %s was taken of a database that was kept", snapshot[1])
+				}
+				if _, ok := fake.SecretsManager.SecretString("beanstalk/rds/demodb"); !ok {
+					t.Error("credentials of demodb were deleted")
+				}
+				if fake.RDS.SubnetGroup(awsrds.SubnetGroupName("demodb")) == nil {
+					t.Error("DB subnet group of the kept database was deleted")
+				}
+				return
+			}
+
+			if fake.RDS.DBInstance("demodb") != nil {
+				t.Error("database demodb was not deleted")
+			}
+			if snapshot == nil {
+				t.Fatalf("output does not name a final snapshot:\n%s", ux.Output())
+			}
+			if source, ok := fake.RDS.Snapshot(snapshot[1]); !ok || source != "demodb" {
+				t.Errorf("Snapshot(%s) = %q, %v, want one of demodb", snapshot[1], source, ok)
+			}
+			if _, ok := fake.SecretsManager.SecretString("beanstalk/rds/demodb"); ok {
+				t.Error("credentials of demodb were not deleted")
+			}
+			if fake.RDS.SubnetGroup(awsrds.SubnetGroupName("demodb")) != nil {
+				t.Error("DB subnet group demodb-subnets was not deleted")
+			}
+			if name, err := awsvpc.DescribeSecurityGroupName(fake.EC2, rdsGroupID); err != nil || name != "" {
+				t.Errorf("security group %s = %q, %v after destroy, want it deleted", rdsGroupID, name, err)
+			}
+		})
+	}
+}
+
+// accountState describes what fake holds, so that a test can tell whether
+// anything in it was changed.
+func accountState(t *testing.T, fake *fakeaws.AWS) string {
+	t.Helper()
+
+	apps, err := fake.EB.DescribeApplications(&elasticbeanstalk.DescribeApplicationsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envs, err := fake.EB.DescribeEnvironments(&elasticbeanstalk.DescribeEnvironmentsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := fake.EB.DescribeApplicationVersions(&elasticbeanstalk.DescribeApplicationVersionsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances, err := fake.RDS.DescribeDBInstances(&rds.DescribeDBInstancesInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subnetGroups, err := fake.RDS.DescribeDBSubnetGroups(&rds.DescribeDBSubnetGroupsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := fake.EC2.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := awss3.ArtifactBucketName(fake.STS, testRegion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The artifact bucket does not exist before the first deploy.
+	objects, listErr := fake.S3.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	secret, _ := fake.SecretsManager.SecretString("beanstalk/rds/demodb")
+
+	content, err := json.Marshal([]interface{}{apps, envs, versions, instances, subnetGroups, groups, objects, fmt.Sprint(listErr), secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// planChanges returns the change p lists for each resource, by type and name.
+func planChanges(p *plan.Plan) map[string]plan.Change {
+	changes := map[string]plan.Change{}
+	for _, resource := range p.Resources {
+		changes[resource.Type+" "+resource.Name] = resource.Change
+	}
+	return changes
+}
+
+// checkPlanChanges checks that p lists the change in want for each resource,
+// and no other resources.
+func checkPlanChanges(t *testing.T, p *plan.Plan, want map[string]plan.Change) {
+	t.Helper()
+
+	got := planChanges(p)
+	for resource, change := range want {
+		if got[resource] != change {
+			t.Errorf("plan lists %s as %q, want %q", resource, got[resource], change)
+		}
+	}
+	for resource, change := range got {
+		if _, ok := want[resource]; !ok {
+			t.Errorf("plan lists unexpected %s as %q", resource, change)
+		}
+	}
+}
+
+func TestPlanNewAppInFreshAccount(t *testing.T) {
+	fake := newTestAWS()
+	before := accountState(t, fake)
+
+	p, err := planNewApp(fake.Clients(), testRepoDetails, testRegion, testConfig())
+	if err != nil {
+		t.Fatalf("planNewApp() error = %v", err)
+	}
+	if after := accountState(t, fake); after != before {
+		t.Errorf("planNewApp() changed the account:\nbefore %s\nafter  %s", before, after)
+	}
+
+	bucket := "beanstalk-artifacts-" + fakeaws.AccountID + "-" + testRegion
+	checkPlanChanges(t, p, map[string]plan.Change{
+		"S3 bucket " + bucket:                                 plan.Create,
+		"DB subnet group demodb-subnets":                      plan.Create,
+		"security group demodb-rds":                           plan.Create,
+		"RDS database demodb":                                 plan.Create,
+		"secret beanstalk/rds/demodb":                         plan.Create,
+		"S3 object s3://" + bucket + "/demo/":                 plan.Create,
+		"IAM policy beanstalk-rds-credentials-demodb":         plan.Create,
+		"Elastic Beanstalk application demo":                  plan.Create,
+		"Elastic Beanstalk environment production":            plan.Create,
+		"Elastic Beanstalk application version (new version)": plan.Create,
+		"security group rule ingress to demodb-rds":           plan.Create,
+	})
+	if p.Count(plan.NoChange) != 0 || p.Count(plan.Update) != 0 {
+		t.Errorf("plan of a fresh account lists %d unchanged and %d updated resources, want none", p.Count(plan.NoChange), p.Count(plan.Update))
+	}
+	if len(p.Warnings) != 0 {
+		t.Errorf("plan of a fresh account warns %q, want no warnings", p.Warnings)
+	}
+}
+
+func TestPlanExistingApp(t *testing.T) {
+	fake := newTestAWS()
+	repos := newTestServices(t, "abc123")
+	defer os.RemoveAll(repos.workspace)
+
+	opsClients, ux := fakeops.NewSDKClients(fakeops.NewPrompt())
+	err := newApp(context.Background(), opsClients, repos.services(fake), testRepoDetails, testRegion, testConfig())
+	if err != nil {
+		t.Fatalf("newApp() error = %v\n%s", err, ux.Output())
+	}
+	before := accountState(t, fake)
+	version := aws.StringValue(fake.EB.Environment("production").VersionLabel)
+	bucket := "beanstalk-artifacts-" + fakeaws.AccountID + "-" + testRegion
+
+	t.Run("new app", func(t *testing.T) {
+		p, err := planNewApp(fake.Clients(), testRepoDetails, testRegion, testConfig())
+		if err != nil {
+			t.Fatalf("planNewApp() error = %v", err)
+		}
+		if after := accountState(t, fake); after != before {
+			t.Errorf("planNewApp() changed the account:\nbefore %s\nafter  %s", before, after)
+		}
+
+		checkPlanChanges(t, p, map[string]plan.Change{
+			"S3 bucket " + bucket:                                 plan.NoChange,
+			"DB subnet group demodb-subnets":                      plan.Update,
+			"security group demodb-rds":                           plan.NoChange,
+			"RDS database demodb":                                 plan.NoChange,
+			"secret beanstalk/rds/demodb":                         plan.Create,
+			"S3 object s3://" + bucket + "/demo/":                 plan.Create,
+			"IAM policy beanstalk-rds-credentials-demodb":         plan.Create,
+			"Elastic Beanstalk application demo":                  plan.NoChange,
+			"Elastic Beanstalk environment production":            plan.NoChange,
+			"Elastic Beanstalk application version (new version)": plan.Create,
+			"security group rule ingress to demodb-rds":           plan.Create,
+		})
+		// Creating what already exists would fail, which the plan warns of.
+		if len(p.Warnings) != 2 {
+			t.Errorf("plan warns %q, want warnings about the database and the environment", p.Warnings)
+		}
+	})
+
+	t.Run("update app", func(t *testing.T) {
+		prompt := fakeops.NewPrompt()
+		opsClients, _ := fakeops.NewSDKClients(prompt)
+		p, err := planUpdateApp(opsClients, fake.Clients(), testRegion, testConfig())
+		if err != nil {
+			t.Fatalf("planUpdateApp() error = %v", err)
+		}
+		if after := accountState(t, fake); after != before {
+			t.Errorf("planUpdateApp() changed the account:\nbefore %s\nafter  %s", before, after)
+		}
+		if len(prompt.Asked()) != 0 {
+			t.Errorf("prompts %v were asked, want none", prompt.Asked())
+		}
+
+		checkPlanChanges(t, p, map[string]plan.Change{
+			"S3 bucket " + bucket:                                 plan.NoChange,
+			"RDS database demodb":                                 plan.NoChange,
+			"secret beanstalk/rds/demodb":                         plan.Update,
+			"IAM policy beanstalk-rds-credentials-demodb":         plan.Update,
+			"S3 object s3://" + bucket + "/demo/":                 plan.Create,
+			"Elastic Beanstalk application demo":                  plan.NoChange,
+			"Elastic Beanstalk application version (new version)": plan.Create,
+			"Elastic Beanstalk environment production":            plan.Update,
+		})
+		for _, resource := range p.Resources {
+			if resource.Type == "Elastic Beanstalk environment" && !strings.Contains(resource.Detail, version) {
+				t.Errorf("environment update %q does not name the version it replaces, %s", resource.Detail, version)
+			}
+		}
+	})
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"git.cto.ai/provision/internal/awsclients"
+	"git.cto.ai/provision/internal/awseb"
+	"git.cto.ai/provision/internal/awsrds"
+	"git.cto.ai/provision/internal/awss3"
+	"git.cto.ai/provision/internal/awsvpc"
+	"git.cto.ai/provision/internal/config"
+	"git.cto.ai/provision/internal/logger"
+	"git.cto.ai/provision/internal/plan"
+	"git.cto.ai/provision/internal/setup"
+	"git.cto.ai/provision/internal/state"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// showPlan prints what elasticBeanstalkAction would change, without changing
+// anything.
+func showPlan(opsClients *setup.SDKClients, svc services, elasticBeanstalkAction string, githubRepoDetails setup.GithubRepoDetails, awsRegion string, cfg config.Config) error {
+	var p *plan.Plan
+	var err error
+	switch elasticBeanstalkAction {
+	case "Create New":
+		p, err = planNewApp(svc.aws, githubRepoDetails, awsRegion, cfg)
+	case "Update Existing":
+		p, err = planUpdateApp(opsClients, svc.aws, awsRegion, cfg)
+	default:
+		return fmt.Errorf("❗ No plan can be shown for %s", elasticBeanstalkAction)
+	}
+	if err != nil {
+		return err
+	}
+
+	rendered, err := p.Render(cfg.Plan.Format)
+	if err != nil {
+		return err
+	}
+
+	logger.LogSlack(opsClients.Ux, rendered)
+	return nil
+}
+
+// planNewApp works out what newApp would create, using only read-only calls.
+func planNewApp(clients awsclients.Clients, githubRepoDetails setup.GithubRepoDetails, awsRegion string, cfg config.Config) (*plan.Plan, error) {
+	p := plan.New("Create New", awsRegion)
+
+	bucketName, bucketExists, err := planArtifactBucket(p, clients, awsRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	appName := cfg.EB.AppName
+	if appName == "" {
+		appName = githubRepoDetails.Repo
+	}
+
+	if bucketExists || cfg.State.Backend == state.BackendLocal {
+		name := fmt.Sprintf("%s-%s", appName, awsRegion)
+		deployment, err := stateStore(clients, bucketName, cfg).Load(name)
+		if err != nil {
+			return nil, err
+		}
+		if deployment != nil && deployment.Status == state.StatusInProgress {
+			p.Warn("The deploy of %s started at %s did not finish. The Op offers to resume it, which skips the steps it completed.", name, deployment.StartedAt.Format(time.RFC3339))
+		}
+	}
+
+	rdsBool, err := planNewRDS(p, clients, cfg.RDS)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Add(plan.Create, "S3 object", fmt.Sprintf("s3://%s/%s/", bucketName, appName), "bundle of the new application version")
+
+	rdsDetails := cfg.RDS
+	if rdsBool && rdsDetails.CredentialStore != awsrds.CredentialStorePlaintext {
+		p.Add(plan.Create, "IAM policy", credentialPolicyName(rdsDetails), fmt.Sprintf("lets instance profile %s read the RDS credentials", awseb.InstanceProfile(cfg.EB)))
+	}
+
+	appExists, err := awseb.ApplicationExists(clients.EB, appName)
+	if err != nil {
+		return nil, err
+	}
+	if appExists {
+		p.Add(plan.NoChange, "Elastic Beanstalk application", appName, "already exists")
+	} else {
+		p.Add(plan.Create, "Elastic Beanstalk application", appName, "")
+	}
+
+	envName := cfg.EB.EnvName
+	if envName == "" {
+		p.Add(plan.Create, "Elastic Beanstalk environment", "(named after the new version)", "")
+	} else {
+		env, err := awseb.FindEnvironment(clients.EB, appName, envName)
+		if err != nil {
+			return nil, err
+		}
+		if env != nil {
+			p.Add(plan.NoChange, "Elastic Beanstalk environment", envName, "already exists")
+			p.Warn("Elastic Beanstalk environment %s already exists, so creating it would fail. Use Update Existing to deploy to it.", envName)
+		} else {
+			p.Add(plan.Create, "Elastic Beanstalk environment", envName, fmt.Sprintf("instance profile %s", awseb.InstanceProfile(cfg.EB)))
+		}
+	}
+
+	p.Add(plan.Create, "Elastic Beanstalk application version", "(new version)", "")
+
+	if rdsBool {
+		p.Add(plan.Create, "security group rule", fmt.Sprintf("ingress to %s", awsrds.SecurityGroupName(rdsDetails.DBName)), "from the instances of the new environment")
+	}
+
+	return p, nil
+}
+
+// planUpdateApp works out what updateApp would change, using only read-only
+// calls. The application and environment are prompted for when the config
+// leaves them out.
+func planUpdateApp(opsClients *setup.SDKClients, clients awsclients.Clients, awsRegion string, cfg config.Config) (*plan.Plan, error) {
+	p := plan.New("Update Existing", awsRegion)
+
+	ebDetails, err := awseb.UpdateEBInfo(opsClients, clients.EB, cfg.EB)
+	if err != nil {
+		return nil, err
+	}
+
+	appExists, err := awseb.ApplicationExists(clients.EB, ebDetails.AppName)
+	if err != nil {
+		return nil, err
+	}
+	if !appExists {
+		return nil, fmt.Errorf("❗ Elastic Beanstalk application %s does not exist", ebDetails.AppName)
+	}
+
+	env, err := awseb.FindEnvironment(clients.EB, ebDetails.AppName, ebDetails.EnvName)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		return nil, fmt.Errorf("❗ Elastic Beanstalk environment %s of %s does not exist", ebDetails.EnvName, ebDetails.AppName)
+	}
+
+	bucketName, _, err := planArtifactBucket(p, clients, awsRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	rdsDetails := cfg.RDS
+	switch {
+	case rdsDetails.Enabled == nil:
+		p.Warn("rds.enabled is not set, so the RDS database to connect is asked for during the deploy.")
+	case *rdsDetails.Enabled && rdsDetails.DBName != "":
+		exists, err := awsrds.RDSExists(clients.RDS, rdsDetails)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("❗ RDS database %s does not exist", rdsDetails.DBName)
+		}
+		p.Add(plan.NoChange, "RDS database", rdsDetails.DBName, "")
+
+		if rdsDetails.CredentialStore != awsrds.CredentialStorePlaintext {
+			p.Add(plan.Update, credentialType(rdsDetails.CredentialStore), awsrds.SecretName(rdsDetails.CredentialStore, rdsDetails.DBName), "")
+
+			instanceProfile, err := awseb.EnvInstanceProfile(clients.EB, ebDetails.AppName, ebDetails.EnvName)
+			if err != nil {
+				return nil, err
+			}
+			p.Add(plan.Update, "IAM policy", credentialPolicyName(rdsDetails), fmt.Sprintf("lets instance profile %s read the RDS credentials", instanceProfile))
+		}
+	}
+
+	p.Add(plan.Create, "S3 object", fmt.Sprintf("s3://%s/%s/", bucketName, ebDetails.AppName), "bundle of the new application version")
+	p.Add(plan.NoChange, "Elastic Beanstalk application", ebDetails.AppName, "")
+	p.Add(plan.Create, "Elastic Beanstalk application version", "(new version)", "")
+	p.Add(plan.Update, "Elastic Beanstalk environment", ebDetails.EnvName, fmt.Sprintf("deploys the new version in place of %s", aws.StringValue(env.VersionLabel)))
+
+	return p, nil
+}
+
+// planArtifactBucket adds the artifact bucket to p, and returns its name and
+// whether it exists.
+func planArtifactBucket(p *plan.Plan, clients awsclients.Clients, awsRegion string) (string, bool, error) {
+	bucketName, err := awss3.ArtifactBucketName(clients.STS, awsRegion)
+	if err != nil {
+		return "", false, err
+	}
+
+	exists, err := awss3.BucketExists(clients.S3, bucketName)
+	if err != nil {
+		return "", false, err
+	}
+
+	if exists {
+		p.Add(plan.NoChange, "S3 bucket", bucketName, "")
+	} else {
+		p.Add(plan.Create, "S3 bucket", bucketName, "")
+	}
+	return bucketName, exists, nil
+}
+
+// planNewRDS adds the database awsrds.NewRDSSetup would create to p, and
+// reports whether one would be created.
+func planNewRDS(p *plan.Plan, clients awsclients.Clients, rdsDetails awsrds.RDSDetails) (bool, error) {
+	if rdsDetails.Enabled == nil || (*rdsDetails.Enabled && rdsDetails.DBName == "") {
+		p.Warn("The RDS database is not fully configured, so whether one is created is asked during the deploy.")
+		return false, nil
+	}
+	if !*rdsDetails.Enabled {
+		return false, nil
+	}
+
+	vpcID, err := awsrds.PlacementVPC(clients.RDS, clients.EC2, rdsDetails.SubnetGroup)
+	if err != nil {
+		return false, err
+	}
+
+	if rdsDetails.SubnetGroup != "" {
+		p.Add(plan.NoChange, "DB subnet group", rdsDetails.SubnetGroup, "")
+	} else {
+		_, private, err := awsrds.PlacementSubnets(clients.EC2, vpcID, rdsDetails.AllowPublicSubnets)
+		if err != nil {
+			p.Warn("%s", strings.TrimPrefix(err.Error(), "❗ "))
+		} else if !private {
+			p.Warn("VPC %s has no private subnets, so the RDS database would use its public subnets. It would not be publicly accessible.", vpcID)
+		}
+
+		name := awsrds.SubnetGroupName(rdsDetails.DBName)
+		exists, err := awsrds.SubnetGroupExists(clients.RDS, name)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			p.Add(plan.Update, "DB subnet group", name, fmt.Sprintf("points at the private subnets of %s", vpcID))
+		} else {
+			p.Add(plan.Create, "DB subnet group", name, fmt.Sprintf("from the private subnets of %s", vpcID))
+		}
+	}
+
+	securityGroup := awsrds.SecurityGroupName(rdsDetails.DBName)
+	groupID, err := awsvpc.FindSecurityGroup(clients.EC2, vpcID, securityGroup)
+	if err != nil {
+		return false, err
+	}
+	if groupID != "" {
+		p.Add(plan.NoChange, "security group", securityGroup, groupID)
+	} else {
+		p.Add(plan.Create, "security group", securityGroup, fmt.Sprintf("in %s", vpcID))
+	}
+
+	exists, err := awsrds.RDSExists(clients.RDS, rdsDetails)
+	if err != nil {
+		return false, err
+	}
+
+	resourceType := "RDS database"
+	if engine, _ := awsrds.LookupEngine(rdsDetails.Platform); engine.Cluster {
+		resourceType = "RDS database cluster"
+	}
+	if exists {
+		p.Add(plan.NoChange, resourceType, rdsDetails.DBName, "already exists")
+		p.Warn("%s %s already exists, so creating it would fail.", resourceType, rdsDetails.DBName)
+	} else {
+		p.Add(plan.Create, resourceType, rdsDetails.DBName, strings.TrimSpace(fmt.Sprintf("%s %s", rdsDetails.Platform, rdsDetails.EngineVersion)))
+	}
+
+	if rdsDetails.CredentialStore != awsrds.CredentialStorePlaintext {
+		credentialStore := rdsDetails.CredentialStore
+		if credentialStore == "" {
+			credentialStore = awsrds.CredentialStoreSecretsManager
+		}
+		p.Add(plan.Create, credentialType(credentialStore), awsrds.SecretName(credentialStore, rdsDetails.DBName), "RDS credentials")
+	}
+
+	return true, nil
+}
+
+// credentialType names the kind of resource credentials are kept in.
+func credentialType(credentialStore string) string {
+	if credentialStore == awsrds.CredentialStoreSSM {
+		return "SSM parameter"
+	}
+	return "secret"
+}